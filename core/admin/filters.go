@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+// parseFilter build a condition from the filters of the search body, a filter is one of
+//
+//	{"column": "email", "op": "like", "value": "%@example.com"}
+//	{"and": [filter, ...]}
+//	{"or": [filter, ...]}
+//	{"not": filter}
+//
+// ops are eq, ne, gt, gte, lt, lte, like, in, nin, null and notnull
+func parseFilter(v any) (orm.Condition, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return orm.Condition{}, fmt.Errorf("filter should be an object, got %T", v)
+	}
+	if list, ok := m["and"]; ok {
+		conds, err := parseFilters(list)
+		return orm.And(conds...), err
+	}
+	if list, ok := m["or"]; ok {
+		conds, err := parseFilters(list)
+		return orm.Or(conds...), err
+	}
+	if f, ok := m["not"]; ok {
+		cond, err := parseFilter(f)
+		return orm.Not(cond), err
+	}
+	column, _ := m["column"].(string)
+	if column == "" {
+		return orm.Condition{}, errors.New("filter without column")
+	}
+	op, _ := m["op"].(string)
+	value := m["value"]
+	switch strings.ToLower(op) {
+	case "", "eq":
+		return orm.Eq(column, value), nil
+	case "ne":
+		return orm.Ne(column, value), nil
+	case "gt":
+		return orm.Gt(column, value), nil
+	case "gte":
+		return orm.Gte(column, value), nil
+	case "lt":
+		return orm.Lt(column, value), nil
+	case "lte":
+		return orm.Lte(column, value), nil
+	case "like":
+		return orm.Like(column, value), nil
+	case "in":
+		return orm.In(column, value), nil
+	case "nin":
+		return orm.NotIn(column, value), nil
+	case "null":
+		return orm.IsNull(column), nil
+	case "notnull":
+		return orm.NotNull(column), nil
+	default:
+		return orm.Condition{}, fmt.Errorf("filter op %q not handled", op)
+	}
+}
+
+func parseFilters(v any) ([]orm.Condition, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("filters should be a list, got %T", v)
+	}
+	conds := make([]orm.Condition, 0, len(list))
+	for _, f := range list {
+		cond, err := parseFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// withTrashed apply the trash filter of the admin table views, "with" or "only" soft deleted rows
+func withTrashed(b *orm.BuilderM, trashed string) *orm.BuilderM {
+	switch trashed {
+	case "with":
+		return b.WithTrashed()
+	case "only":
+		return b.OnlyTrashed()
+	}
+	return b
+}
@@ -3,11 +3,67 @@ package models
 import "time"
 
 type User struct {
+	Id            int       `json:"id,omitempty" orm:"pk"`
+	Uuid          string    `json:"uuid,omitempty" orm:"size:40"`
+	Email         string    `json:"email,omitempty" orm:"size:50;iunique"`
+	Password      string    `json:"password,omitempty" orm:"size:150"`
+	IsAdmin       bool      `json:"is_admin,omitempty" orm:"default:false"`
+	Image         string    `json:"image,omitempty" orm:"size:100;default:''"`
+	CreatedAt     time.Time `json:"created_at,omitempty" orm:"now"`
+	EmailVerified bool      `json:"email_verified,omitempty" orm:"default:false"`
+}
+
+// UserTotp hold the encrypted TOTP secret of a user, the second factor is active once Confirmed
+type UserTotp struct {
+	Id          int       `json:"id,omitempty" orm:"pk"`
+	UserId      int       `json:"user_id,omitempty" orm:"fk:users.id:cascade;unique"`
+	Secret      string    `json:"-" orm:"size:255"`
+	Confirmed   bool      `json:"confirmed,omitempty" orm:"default:false"`
+	LastCounter int64     `json:"-" orm:"default:0"`
+	CreatedAt   time.Time `json:"created_at,omitempty" orm:"now"`
+}
+
+// RecoveryCode is a one time code that replace the TOTP code, only its sha256 is stored
+type RecoveryCode struct {
+	Id     int    `json:"id,omitempty" orm:"pk"`
+	UserId int    `json:"user_id,omitempty" orm:"fk:users.id:cascade;index"`
+	Code   string `json:"-" orm:"size:64;unique"`
+	Used   bool   `json:"used,omitempty" orm:"default:false"`
+}
+
+// LoginAttempt is the audit trail of every login attempt
+type LoginAttempt struct {
+	Id        int       `json:"id,omitempty" orm:"pk"`
+	Email     string    `json:"email,omitempty" orm:"size:150;index"`
+	Ip        string    `json:"ip,omitempty" orm:"size:64"`
+	Success   bool      `json:"success,omitempty" orm:"default:false"`
+	Reason    string    `json:"reason,omitempty" orm:"size:50;default:''"`
+	UserAgent string    `json:"user_agent,omitempty" orm:"size:255;default:''"`
+	CreatedAt time.Time `json:"created_at,omitempty" orm:"now"`
+}
+
+// LoginLockout count recent failures of a target (email:... or ip:...), LockedUntil is a unix timestamp
+type LoginLockout struct {
+	Id          int    `json:"id,omitempty" orm:"pk"`
+	Target      string `json:"target,omitempty" orm:"size:200;unique"`
+	Failures    int    `json:"failures,omitempty" orm:"default:0"`
+	LockedUntil int64  `json:"locked_until,omitempty" orm:"default:0"`
+	LastFailure int64  `json:"last_failure,omitempty" orm:"default:0"`
+}
+
+// Identity link a user to its account at an OAuth2 / OIDC provider
+type Identity struct {
 	Id        int       `json:"id,omitempty" orm:"pk"`
-	Uuid      string    `json:"uuid,omitempty" orm:"size:40"`
-	Email     string    `json:"email,omitempty" orm:"size:50;iunique"`
-	Password  string    `json:"password,omitempty" orm:"size:150"`
-	IsAdmin   bool      `json:"is_admin,omitempty" orm:"default:false"`
-	Image     string    `json:"image,omitempty" orm:"size:100;default:''"`
+	UserId    int       `json:"user_id,omitempty" orm:"fk:users.id:cascade"`
+	Provider  string    `json:"provider,omitempty" orm:"size:50;uindex:provider,subject"`
+	Subject   string    `json:"subject,omitempty" orm:"size:255"`
+	Email     string    `json:"email,omitempty" orm:"size:150;default:''"`
 	CreatedAt time.Time `json:"created_at,omitempty" orm:"now"`
 }
+
+// AutocertCache hold certificates and ACME account keys generated by autocert, Data is encrypted with the app secret
+type AutocertCache struct {
+	Id   int    `json:"id,omitempty" orm:"pk"`
+	Name string `json:"name,omitempty" orm:"size:255;unique"`
+	Data string `json:"-" orm:"text"`
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+// IMPORT_BATCH is the number of rows decoded from an import file before being inserted
+var IMPORT_BATCH = 1000
+
+// writeRows write rows to w as a json array, one row at a time
+func writeRows(w io.Writer, rows *orm.Rows[map[string]any]) error {
+	defer rows.Close()
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for first := true; rows.Next(); first = false {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(rows.Value()); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// importRows insert the rows of the json array read from r in table, by batches of IMPORT_BATCH rows,
+// in a transaction, so nothing is imported if a row fail
+func importRows(ctx context.Context, r io.Reader, table string) (int, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return 0, errors.New("invalid json file: expecting an array of rows")
+	}
+	n := 0
+	err := orm.Transaction(ctx, orm.DefaultDB, func(tx *orm.Tx) error {
+		batch := make([]map[string]any, 0, IMPORT_BATCH)
+		insert := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if _, err := tx.Table(table).InsertMany(batch); err != nil {
+				return err
+			}
+			n += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		for dec.More() {
+			row := map[string]any{}
+			if err := dec.Decode(&row); err != nil {
+				return errors.New("invalid json file: " + err.Error())
+			}
+			batch = append(batch, row)
+			if len(batch) >= IMPORT_BATCH {
+				if err := insert(); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return errors.New("invalid json file: " + err.Error())
+		}
+		return insert()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/admin"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+const email = "admin-tests@gmail.com"
+
+func init() {
+	r := kamux.Router{}
+	r.LoadEnv("../../../.env")
+	orm.UseCache = false
+	err := orm.InitDB()
+	if logger.CheckError(err) {
+		return
+	}
+	err = orm.Migrate()
+	if logger.CheckError(err) {
+		return
+	}
+	if _, err := orm.Table("users").Where("email = ?", email).One(); err != nil {
+		logger.CheckError(orm.CreateUser(email, "olaolaola", 0))
+	}
+}
+
+// formContext return a context posting fields as a multipart form
+func formContext(t *testing.T, fields map[string]string) (*kamux.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/admin/update/row", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	return &kamux.Context{ResponseWriter: rec, Request: req, Params: map[string]string{}}, rec
+}
+
+func TestUpdateRowPostUnknownColumn(t *testing.T) {
+	user, err := orm.Table("users").Where("email = ?", email).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := fmt.Sprint(user["id"])
+	for _, key := range []string{"nope", "is_admin = 1, email"} {
+		c, rec := formContext(t, map[string]string{"table": "users", "row_id": id, key: "1"})
+		admin.UpdateRowPost(c)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown column") {
+			t.Errorf("key %q should be refused, got %d %s", key, rec.Code, rec.Body.String())
+		}
+	}
+	user, err = orm.Table("users").Where("email = ?", email).One()
+	if err != nil || user["is_admin"] == int64(1) || user["is_admin"] == true {
+		t.Errorf("user should not be changed, got %v %v", user, err)
+	}
+}
+
+func TestLoginPOSTSecondFactor(t *testing.T) {
+	const adminEmail = "admin-2fa-tests@gmail.com"
+	if _, err := orm.Table("users").Where("email = ?", adminEmail).One(); err != nil {
+		if err := orm.CreateUser(adminEmail, "olaolaola", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	force := settings.Config.Force2FA
+	settings.Config.Force2FA = true
+	t.Cleanup(func() { settings.Config.Force2FA = force })
+
+	req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(`{"email":"`+adminEmail+`","password":"olaolaola"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "10.0.1.1:1234"
+	rec := httptest.NewRecorder()
+	admin.LoginPOSTView(&kamux.Context{ResponseWriter: rec, Request: req, Params: map[string]string{}})
+
+	res := map[string]any{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if rec.Code != http.StatusOK || res["success"] == nil || res["2fa"] != true || res["redirect"] != "/auth/2fa/setup" {
+		t.Errorf("login should ask for a second factor, got %d %v", rec.Code, res)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session" {
+			t.Error("no session should be set before the second factor")
+		}
+	}
+}
@@ -20,6 +20,7 @@ func UrlPatterns(r *kamux.Router) {
 	r.POST("/admin/login", kamux.Auth(LoginPOSTView))
 	r.GET("/admin/logout", LogoutView)
 	r.POST("/admin/delete/row", kamux.Admin(DeleteRowPost))
+	r.POST("/admin/restore/row", kamux.Admin(RestoreRowPost))
 	r.POST("/admin/update/row", kamux.Admin(UpdateRowPost))
 	r.POST("/admin/create/row", kamux.Admin(CreateModelView))
 	r.POST("/admin/drop/table", kamux.Admin(DropTablePost))
@@ -1,16 +1,18 @@
 package admin
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/kamalshkeir/kago/core/auth"
 	"github.com/kamalshkeir/kago/core/kamux"
 	"github.com/kamalshkeir/kago/core/orm"
 	"github.com/kamalshkeir/kago/core/settings"
@@ -35,51 +37,59 @@ var LoginView = func(c *kamux.Context) {
 
 var LoginPOSTView = func(c *kamux.Context) {
 	requestData := c.BodyJson()
-	email := requestData["email"]
-	passRequest := requestData["password"]
+	email, _ := requestData["email"].(string)
+	passRequest, _ := requestData["password"].(string)
 
-	data, err := orm.Table("users").Where("email = ?", email).One()
-	if err != nil {
-		c.Status(500).Json(map[string]any{
-			"error": err.Error(),
+	if wait, ok := auth.CheckLoginAllowed(c, email); !ok {
+		c.SetHeader("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		c.Status(http.StatusTooManyRequests).Json(map[string]any{
+			"error": auth.ErrTooManyAttempts.Error(),
 		})
 		return
 	}
-	if data["email"] == "" || data["email"] == nil {
-		c.Status(http.StatusNotFound).Json(map[string]any{
-			"error": "User doesn not Exist",
+	// same error and same timing whatever failed, to not reveal which emails exist
+	fail := func(reason string) {
+		auth.LoginFailed(c, email, reason)
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": auth.ErrInvalidCredentials.Error(),
 		})
+	}
+
+	data, err := orm.Table("users").Where("email = ?", email).One()
+	passDB, _ := data["password"].(string)
+	if err != nil || data["email"] == "" || data["email"] == nil {
+		auth.ComparePassword(passRequest, "")
+		fail("unknown email")
+		return
+	}
+	if !auth.ComparePassword(passRequest, passDB) {
+		fail("wrong password")
 		return
 	}
 	if data["is_admin"] == int64(0) || data["is_admin"] == 0 || data["is_admin"] == false {
-		c.Status(http.StatusForbidden).Json(map[string]any{
-			"error": "Not Allowed to access this page",
-		})
+		fail("not admin")
 		return
 	}
 
-	if passDB, ok := data["password"].(string); ok {
-		if pp, ok := passRequest.(string); ok {
-			match, err := hash.ComparePasswordToHash(pp, passDB)
-			if !match || err != nil {
-				c.Status(http.StatusForbidden).Json(map[string]any{
-					"error": "Wrong Password",
-				})
-				return
-			} else {
-				if uuid, ok := data["uuid"].(string); ok {
-					if kamux.SESSION_ENCRYPTION {
-						uuid, err = encryptor.Encrypt(uuid)
-						logger.CheckError(err)
-					}
-					c.SetCookie("session", uuid)
-					c.Json(map[string]any{
-						"success": "U Are Logged In",
-					})
-					return
-				}
-			}
+	if uuid, ok := data["uuid"].(string); ok {
+		if next, ok := auth.RequireSecondFactor(c, uuid); ok {
+			c.Json(map[string]any{
+				"success":  "second factor required",
+				"2fa":      true,
+				"redirect": next,
+			})
+			return
 		}
+		auth.LoginSucceeded(c, email)
+		if kamux.SESSION_ENCRYPTION {
+			uuid, err = encryptor.Encrypt(uuid)
+			logger.CheckError(err)
+		}
+		c.SetCookie("session", uuid)
+		c.Json(map[string]any{
+			"success": "U Are Logged In",
+		})
+		return
 	}
 }
 
@@ -101,9 +111,11 @@ var AllModelsGet = func(c *kamux.Context) {
 	if t.Pk != "" && t.Pk != "id" {
 		idString = t.Pk
 	}
-	rows, err := orm.Table(model).OrderBy("-" + idString).Limit(PAGINATION_PER).Page(1).All()
+	// trash filter of tables with a softdelete column, 'with' or 'only'
+	trashed := c.QueryParam("trashed")
+	rows, err := withTrashed(orm.Table(model), trashed).OrderBy("-" + idString).Limit(PAGINATION_PER).Page(1).All()
 	if err != nil {
-		rows, err = orm.Table(model).All()
+		rows, err = withTrashed(orm.Table(model), trashed).All()
 		if err != nil {
 			// usualy should not use error string because it divulge information, but here only admin use it, so no worry
 			if err.Error() != "no data found" {
@@ -124,6 +136,8 @@ var AllModelsGet = func(c *kamux.Context) {
 			"dbcolumns":  dbCols,
 			"pk":         t.Pk,
 			"columnsOrdered":t.Columns,
+			"softdelete": orm.SoftDeleteColumn(model,orm.DefaultDB),
+			"trashed":    trashed,
 		})
 	} else {
 		logger.Error("dbType not known, do you have .env", settings.Config.Db.Type, err)
@@ -143,20 +157,40 @@ var AllModelsSearch = func(c *kamux.Context) {
 	}
 
 	body := c.BodyJson()
+	if _, ok := body["query"]; ok {
+		// raw sql queries are not accepted anymore, they must not be silently ignored either
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "query is not supported, use filters",
+		})
+		return
+	}
 	
 	blder := orm.Table(model)
-	if query,ok := body["query"];ok {
-		if v,ok := query.(string);ok {
-			if v != "" {
-				blder.Where(v)
-			}
-		} 
-	} 
+	// filters are checked against the columns of the table, never sent as sql
+	if filters, ok := body["filters"]; ok && filters != nil {
+		cond, err := parseFilter(filters)
+		if err != nil {
+			c.Status(http.StatusBadRequest).Json(map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		blder.WhereCond(cond)
+	}
+	if trashed, ok := body["trashed"].(string); ok {
+		withTrashed(blder, trashed)
+	}
 
 	oB := ""
 	t, _ := orm.GetMemoryTable(model,orm.DefaultDB)
 	if orderby,ok := body["orderby"];ok {
 		if v,ok := orderby.(string);ok && v != ""{
+			if !utils.SliceContains(orm.TableColumns(model, orm.DefaultDB), strings.TrimLeft(v, "+-")) {
+				c.Status(http.StatusBadRequest).Json(map[string]any{
+					"error": "unknown column " + v,
+				})
+				return
+			}
 			oB=v
 		} else {
 			oB="-"+t.Pk
@@ -196,6 +230,7 @@ var AllModelsSearch = func(c *kamux.Context) {
 	c.Json(map[string]any{
 		"rows":data,
 		"cols":t.Columns,
+		"softdelete":orm.SoftDeleteColumn(model,orm.DefaultDB),
 	})
 }
 
@@ -209,7 +244,13 @@ var DeleteRowPost = func(c *kamux.Context) {
 				if t.Pk != "" && t.Pk != "id" {
 					idString = t.Pk
 				}
-				modelDB, err := orm.Table(mm).Where(idString+" = ?", data["id"]).One()
+				// rows of tables with a softdelete column are only marked as deleted, unless force is given
+				force, _ := data["force"].(bool)
+				blder := orm.Table(mm)
+				if force {
+					blder.WithTrashed()
+				}
+				modelDB, err := blder.Where(idString+" = ?", data["id"]).One()
 				if logger.CheckError(err) {
 					logger.Info("data received DeleteRowPost:", data)
 					c.Status(http.StatusBadRequest).Json(map[string]any{
@@ -217,14 +258,19 @@ var DeleteRowPost = func(c *kamux.Context) {
 					})
 					return
 				}
-				if val, ok := modelDB["image"]; ok {
+				softDeleted := !force && orm.SoftDeleteColumn(mm,orm.DefaultDB) != ""
+				if val, ok := modelDB["image"]; ok && !softDeleted {
 					if vv, ok := val.(string); ok && vv != "" {
 						_ = c.DeleteFile(vv)
 					}
 				}
 
 				if idS, ok := data["id"].(string); ok {
-					_, err = orm.Table(mm).Where(idString+" = ?", idS).Delete()
+					if force {
+						_, err = orm.Table(mm).Where(idString+" = ?", idS).ForceDelete()
+					} else {
+						_, err = orm.Table(mm).Where(idString+" = ?", idS).Delete()
+					}
 
 					if err != nil {
 						c.Status(http.StatusBadRequest).Json(map[string]any{
@@ -253,6 +299,39 @@ var DeleteRowPost = func(c *kamux.Context) {
 	}
 }
 
+var RestoreRowPost = func(c *kamux.Context) {
+	data := c.BodyJson()
+	mm, ok := data["model_name"].(string)
+	if !ok {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "expecting model_name to be string",
+		})
+		return
+	}
+	idString := "id"
+	t, _ := orm.GetMemoryTable(mm,orm.DefaultDB)
+	if t.Pk != "" && t.Pk != "id" {
+		idString = t.Pk
+	}
+	n, err := orm.Table(mm).Where(idString+" = ?", data["id"]).Restore()
+	if logger.CheckError(err) {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	if n == 0 {
+		c.Status(http.StatusNotFound).Json(map[string]any{
+			"error": "no deleted row found",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "Restored !",
+		"id":      data["id"],
+	})
+}
+
 var CreateModelView = func(c *kamux.Context) {
 	parseErr := c.Request.ParseMultipartForm(int64(kamux.MultipartSize))
 	if parseErr != nil {
@@ -379,28 +458,16 @@ var UpdateRowPost = func(c *kamux.Context) {
 	toUpdate := map[string]any{}
 	for key, val := range data {
 		if !utils.SliceContains(ignored, key) {
-			if modelDB[key] == val[0] {
-				// no changes for bool
+			if fmt.Sprint(modelDB[key]) == val[0] {
+				// no changes
 				continue
 			}
 			toUpdate[key] = val[0]
 		}
 	}
 
-	s := ""
-	values := []any{}
 	if len(toUpdate) > 0 {
-		for col, v := range toUpdate {
-			if s == "" {
-				s += col + "= ?"
-			} else {
-				s += "," + col + "= ?"
-			}
-			values = append(values, v)
-		}
-	}
-	if s != "" {
-		_, err := orm.Table(data["table"][0]).Where(idString+" = ?", id).Set(s, values...)
+		_, err := orm.Table(data["table"][0]).Where(idString+" = ?", id).Update(toUpdate)
 		if err != nil {
 			c.Status(http.StatusBadRequest).Json(map[string]any{
 				"error": err.Error(),
@@ -408,7 +475,7 @@ var UpdateRowPost = func(c *kamux.Context) {
 			return
 		}
 	}
-	s = ""
+	s := ""
 	if len(files) > 0 {
 		for f := range files {
 			if s == "" {
@@ -454,13 +521,17 @@ func handleFilesUpload(files map[string][]*multipart.FileHeader, model string, i
 					err := c.DeleteFile(v)
 					if err != nil {
 						//le fichier existe pas
-						_, err := orm.Table(model).Where(idString+" = ?", id).Set(key+" = ?", uploadedImage)
-						logger.CheckError(err)
+						_, err := orm.Table(model).Where(idString+" = ?", id).Update(map[string]any{key: uploadedImage})
+						if err != nil {
+							return err
+						}
 						continue
 					} else {
 						//le fichier existe et donc supprimer
-						_, err := orm.Table(model).Where(idString+" = ?", id).Set(key+" = ?", uploadedImage)
-						logger.CheckError(err)
+						_, err := orm.Table(model).Where(idString+" = ?", id).Update(map[string]any{key: uploadedImage})
+						if err != nil {
+							return err
+						}
 						continue
 					}
 				}
@@ -505,13 +576,17 @@ var ExportView = func(c *kamux.Context) {
 		})
 		return
 	}
-	data, err := orm.Table(table).All()
-	logger.CheckError(err)
-
-	data_bytes, err := json.Marshal(data)
-	logger.CheckError(err)
-
-	c.Download(data_bytes, table+".json")
+	// rows are streamed to the response, the table is never loaded in memory, soft deleted rows are exported too
+	rows, err := orm.Table(table).WithTrashed().Rows()
+	if logger.CheckError(err) {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.SetHeader("Content-Disposition", "attachment; filename="+strconv.Quote(table+".json"))
+	c.SetHeader("Content-Type", "application/json")
+	logger.CheckError(writeRows(c.ResponseWriter, rows))
 }
 
 var ImportView = func(c *kamux.Context) {
@@ -523,48 +598,54 @@ var ImportView = func(c *kamux.Context) {
 		})
 		return
 	}
-	// upload file and return bytes of file
-	_, dataBytes, err := c.UploadFile("thefile", "backup", "json")
+	file, header, err := c.Request.FormFile("thefile")
 	if logger.CheckError(err) {
 		c.Status(http.StatusBadRequest).Json(map[string]any{
 			"error": err.Error(),
 		})
 		return
 	}
+	defer file.Close()
+	if !strings.HasSuffix(header.Filename, ".json") {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "expecting a .json file",
+		})
+		return
+	}
 
-	// get old data and backup
-	modelsOld,_ := orm.Table(table).All()
-	if len(modelsOld) > 0 {
-		modelsOldBytes,err := json.Marshal(modelsOld)
-		if !logger.CheckError(err) {
-			_ = os.MkdirAll(settings.MEDIA_DIR+"/backup/", 0664)
+	// backup old data and the uploaded file
+	err = os.MkdirAll(settings.MEDIA_DIR+"/backup/", 0664)
+	if !logger.CheckError(err) {
+		if rows,err := orm.Table(table).WithTrashed().Rows();err == nil {
 			dst, err := os.Create(settings.MEDIA_DIR + "/backup/" +table+"-"+ time.Now().Format("2006-01-02")+".json")
+			if !logger.CheckError(err) {
+				logger.CheckError(writeRows(dst, rows))
+				dst.Close()
+			} else {
+				rows.Close()
+			}
+		}
+		dst, err := os.Create(settings.MEDIA_DIR + "/backup/" + filepath.Base(header.Filename))
+		if !logger.CheckError(err) {
+			_,err = io.Copy(dst, file)
 			logger.CheckError(err)
-			defer dst.Close()
-			_,err = dst.Write(modelsOldBytes)
-			logger.CheckError(err)
+			dst.Close()
 		}
+		_,err = file.Seek(0, io.SeekStart)
+		logger.CheckError(err)
 	}
-	
 
-	// fill list_map
-	list_map := []map[string]any{}
-	json.Unmarshal(dataBytes, &list_map)
-	// create models in database
-	cols := []string{}
-	values := []any{}
-	for _, m := range list_map {
-		for k, v := range m {
-			cols = append(cols, k)
-			values = append(values, v)
-		}
-		_, _ = orm.Table(table).Insert(strings.Join(cols, ","), values)
-		cols = cols[:0]
-		values = values[:0]
+	// create models in database, streaming the file by batches, nothing is imported if a row fail
+	n, err := importRows(c.Request.Context(), file, table)
+	if logger.CheckError(err) {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "import failed: " + err.Error(),
+		})
+		return
 	}
 
 	c.Json(map[string]any{
-		"success": fmt.Sprintf("Import Done , you can see uploaded backups at ./%s/backup folder",settings.MEDIA_DIR),
+		"success": fmt.Sprintf("Import Done , %d rows imported, you can see uploaded backups at ./%s/backup folder",n,settings.MEDIA_DIR),
 	})
 }
 
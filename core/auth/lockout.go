@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/encryption/hash"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kstrct"
+)
+
+var (
+	// LOGIN_FREE_ATTEMPTS is the number of failures allowed for an account before backoff start
+	LOGIN_FREE_ATTEMPTS = 5
+	// LOGIN_IP_FREE_ATTEMPTS is higher, many users can share the same ip
+	LOGIN_IP_FREE_ATTEMPTS = 20
+	// LOGIN_BACKOFF is the first lockout duration, it double on every new failure up to LOGIN_MAX_LOCKOUT
+	LOGIN_BACKOFF     = 2 * time.Second
+	LOGIN_MAX_LOCKOUT = 30 * time.Minute
+	// LOGIN_FAILURES_TTL reset the failure count when there was no failure for this long
+	LOGIN_FAILURES_TTL = 24 * time.Hour
+
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrTooManyAttempts    = errors.New("too many attempts, try again later")
+)
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// CheckLoginAllowed return false and the time to wait if the account or the ip of the request is locked,
+// the blocked attempt is recorded in the audit table
+func CheckLoginAllowed(c *kamux.Context, email string) (time.Duration, bool) {
+	ip := clientIP(c)
+	rows, err := orm.Query(orm.DefaultDB, "select locked_until from login_lockouts where target in (?, ?) and locked_until > ?", emailTarget(email), ipTarget(ip), time.Now().Unix())
+	if err != nil || len(rows) == 0 {
+		return 0, true
+	}
+	var until int64
+	for _, row := range rows {
+		if v := toInt64(row["locked_until"]); v > until {
+			until = v
+		}
+	}
+	audit(c, email, ip, false, "locked")
+	return time.Until(time.Unix(until, 0)).Round(time.Second) + time.Second, false
+}
+
+// LoginFailed record a failed attempt and lock the account and the ip with exponential backoff
+func LoginFailed(c *kamux.Context, email, reason string) {
+	ip := clientIP(c)
+	audit(c, email, ip, false, reason)
+	if email != "" {
+		registerFailure(emailTarget(email), LOGIN_FREE_ATTEMPTS)
+	}
+	registerFailure(ipTarget(ip), LOGIN_IP_FREE_ATTEMPTS)
+}
+
+// LoginSucceeded record the attempt and reset the failures of the account, the ip counter is kept
+// so one valid account cannot be used to reset a password spraying ip
+func LoginSucceeded(c *kamux.Context, email string) {
+	audit(c, email, clientIP(c), true, "")
+	_, err := orm.Table("login_lockouts").Where("target = ?", emailTarget(email)).Delete()
+	logger.CheckError(err)
+}
+
+// ComparePassword is like hash.ComparePasswordToHash but take the same time when the user does not exist, pass an empty hash in this case
+func ComparePassword(password, hashed string) bool {
+	if hashed == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = hash.GenerateHash("kago-dummy-password")
+		})
+		_, _ = hash.ComparePasswordToHash(password, dummyHash)
+		return false
+	}
+	match, err := hash.ComparePasswordToHash(password, hashed)
+	return match && err == nil
+}
+
+// Lockouts return targets currently locked or with failures
+func Lockouts() ([]models.LoginLockout, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select * from login_lockouts order by locked_until desc")
+	if err != nil {
+		if strings.Contains(err.Error(), "no data") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := make([]models.LoginLockout, 0, len(rows))
+	for _, row := range rows {
+		l := models.LoginLockout{}
+		if err := kstrct.FillFromMap(&l, row); err == nil {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
+
+// ClearLockout remove the lockout of target (email:... or ip:...), or all lockouts if target is empty
+func ClearLockout(target string) error {
+	b := orm.Table("login_lockouts")
+	if target == "" {
+		b.Where("id > ?", 0)
+	} else {
+		b.Where("target = ?", target)
+	}
+	_, err := b.Delete()
+	return err
+}
+
+// registerFailure count a failure of target in sql, so concurrent failures are all counted, and lock it if needed
+func registerFailure(target string, free int) {
+	now := time.Now()
+	_, err := orm.Table("login_lockouts").Upsert("target", "", map[string]any{"target": target})
+	if logger.CheckError(err) {
+		return
+	}
+	// failures older than LOGIN_FAILURES_TTL are forgotten
+	_, err = orm.Table("login_lockouts").Where("target = ?", target).Set("failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END, last_failure = ?", now.Add(-LOGIN_FAILURES_TTL).Unix(), now.Unix())
+	if logger.CheckError(err) {
+		return
+	}
+	rows, err := orm.Query(orm.DefaultDB, "select failures from login_lockouts where target = ?", target)
+	if logger.CheckError(err) {
+		return
+	}
+	failures := int(toInt64(rows[0]["failures"]))
+	if failures <= free {
+		return
+	}
+	// a concurrent failure counted after this one set a longer lockout, keep it
+	_, err = orm.Table("login_lockouts").Where("target = ? AND failures = ?", target, failures).Set("locked_until = ?", now.Add(backoff(failures-free)).Unix())
+	logger.CheckError(err)
+}
+
+func backoff(n int) time.Duration {
+	d := LOGIN_BACKOFF
+	for i := 1; i < n && d < LOGIN_MAX_LOCKOUT; i++ {
+		d *= 2
+	}
+	if d > LOGIN_MAX_LOCKOUT {
+		return LOGIN_MAX_LOCKOUT
+	}
+	return d
+}
+
+func audit(c *kamux.Context, email, ip string, success bool, reason string) {
+	ok := 0
+	if success {
+		ok = 1
+	}
+	_, err := orm.Table("login_attempts").Insert("email,ip,success,reason,user_agent", []any{
+		truncate(email, 150), truncate(ip, 64), ok, reason, truncate(c.Request.UserAgent(), 255),
+	})
+	logger.CheckError(err)
+}
+
+func clientIP(c *kamux.Context) string {
+	ip := c.GetUserIP()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
+func emailTarget(email string) string {
+	return truncate("email:"+strings.ToLower(strings.TrimSpace(email)), 200)
+}
+
+func ipTarget(ip string) string {
+	return "ip:" + ip
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func toInt64(v any) int64 {
+	switch t := v.(type) {
+	case int64:
+		return t
+	case int:
+		return int64(t)
+	case string:
+		i, _ := strconv.ParseInt(t, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// LoginAttempts return the last n login attempts, most recent first
+func LoginAttempts(n int) ([]models.LoginAttempt, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select * from login_attempts order by id desc limit "+strconv.Itoa(n))
+	if err != nil {
+		if strings.Contains(err.Error(), "no data") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := make([]models.LoginAttempt, 0, len(rows))
+	for _, row := range rows {
+		a := models.LoginAttempt{}
+		if err := kstrct.FillFromMap(&a, row); err == nil {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+var LockoutsView = func(c *kamux.Context) {
+	lockouts, err := Lockouts()
+	logger.CheckError(err)
+	attempts, err := LoginAttempts(100)
+	logger.CheckError(err)
+	now := time.Now().Unix()
+	locked := map[string]string{}
+	for _, l := range lockouts {
+		if l.LockedUntil > now {
+			locked[l.Target] = time.Unix(l.LockedUntil, 0).Format("2006-01-02 15:04:05")
+		}
+	}
+	c.Html("auth/lockouts.html", map[string]any{
+		"lockouts": lockouts,
+		"locked":   locked,
+		"attempts": attempts,
+	})
+}
+
+var LockoutsClearPOSTView = func(c *kamux.Context) {
+	target, _ := c.BodyJson()["target"].(string)
+	if err := ClearLockout(target); logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to clear lockout",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "lockout cleared",
+	})
+}
@@ -0,0 +1,222 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CLOCK_SKEW is tolerated when checking exp and iat of id tokens
+var CLOCK_SKEW = time.Minute
+
+var ErrInvalidIdToken = errors.New("oauth: invalid id token")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet cache the provider public keys, refreshed when an unknown kid is seen
+type keySet struct {
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// verifyIdToken check the signature against the provider JWKS, then iss, aud, exp, iat and nonce
+func (p *Provider) verifyIdToken(ctx context.Context, token, nonce string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidIdToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, ErrInvalidIdToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidIdToken
+	}
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) != nil {
+			return Claims{}, ErrInvalidIdToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 {
+			return Claims{}, ErrInvalidIdToken
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, sum[:], r, s) {
+			return Claims{}, ErrInvalidIdToken
+		}
+	default:
+		return Claims{}, ErrInvalidIdToken
+	}
+
+	raw := map[string]any{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return Claims{}, ErrInvalidIdToken
+	}
+	if iss, _ := raw["iss"].(string); p.Issuer != "" && strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return Claims{}, fmt.Errorf("%w: issuer mismatch", ErrInvalidIdToken)
+	}
+	if !audienceContains(raw["aud"], p.ClientID) {
+		return Claims{}, fmt.Errorf("%w: audience mismatch", ErrInvalidIdToken)
+	}
+	now := time.Now()
+	exp, _ := raw["exp"].(float64)
+	if exp == 0 || now.Add(-CLOCK_SKEW).After(time.Unix(int64(exp), 0)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidIdToken)
+	}
+	if iat, ok := raw["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(CLOCK_SKEW)) {
+		return Claims{}, fmt.Errorf("%w: issued in the future", ErrInvalidIdToken)
+	}
+	if n, _ := raw["nonce"].(string); n != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIdToken)
+	}
+	claims := claimsFromMap(raw)
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidIdToken)
+	}
+	return claims, nil
+}
+
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if p.JWKSURL == "" {
+		return nil, errors.New("oauth: no JWKSURL to verify id token")
+	}
+	p.mu.Lock()
+	if p.keys == nil {
+		p.keys = &keySet{}
+	}
+	ks := p.keys
+	p.mu.Unlock()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if k, ok := ks.find(kid); ok {
+		return k, nil
+	}
+	// unknown kid, the provider may have rotated its keys, but do not hammer it
+	if time.Since(ks.fetchedAt) < 10*time.Second && ks.keys != nil {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIdToken, kid)
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := p.getJson(ctx, p.JWKSURL, "", &set); err != nil {
+		return nil, err
+	}
+	ks.keys = map[string]crypto.PublicKey{}
+	ks.fetchedAt = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			ks.keys[k.Kid] = pub
+		}
+	}
+	if k, ok := ks.find(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIdToken, kid)
+}
+
+func (ks *keySet) find(kid string) (crypto.PublicKey, bool) {
+	if k, ok := ks.keys[kid]; ok {
+		return k, true
+	}
+	// tokens without kid are accepted only if there is one key
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("oauth: curve %s not supported", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("oauth: invalid EC key")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("oauth: key type %s not supported", k.Kty)
+}
+
+func decodeSegment(seg string, dest any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dest)
+}
+
+func audienceContains(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Package oauth let users login with any OAuth2 or OpenID Connect provider (authorization code + PKCE)
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/utils/safemap"
+)
+
+// Provider is a generic OAuth2 / OIDC provider, set Issuer for OIDC providers supporting discovery,
+// or set AuthURL, TokenURL and UserInfoURL (and JWKSURL to verify id tokens) manually
+type Provider struct {
+	// Name is used in urls: /auth/oauth/{Name}/login and /auth/oauth/{Name}/callback
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	JWKSURL      string
+	// Scopes default to openid email profile when Issuer is set
+	Scopes []string
+	// RedirectURL is the full callback url registered at the provider, built from the request if empty
+	RedirectURL string
+	// AllowSignup create a new user when no account match the identity
+	AllowSignup bool
+	// TrustEmail link accounts using the email given by a plain OAuth2 userinfo, OIDC use the email_verified claim
+	TrustEmail bool
+	// HTTPClient is used for every request to the provider, http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	mu         sync.Mutex
+	discovered bool
+	keys       *keySet
+}
+
+// Claims is the identity returned by the provider
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Raw           map[string]any
+}
+
+var (
+	providers = safemap.New[string, *Provider]()
+	// HTTP_TIMEOUT is applied to every request to a provider
+	HTTP_TIMEOUT = 10 * time.Second
+)
+
+// Register add a provider, it can then be used at /auth/oauth/{Name}/login
+func Register(p *Provider) error {
+	if p.Name == "" || p.ClientID == "" {
+		return errors.New("oauth: provider Name and ClientID are required")
+	}
+	if p.Issuer == "" && (p.AuthURL == "" || p.TokenURL == "") {
+		return errors.New("oauth: set Issuer, or AuthURL and TokenURL")
+	}
+	if len(p.Scopes) == 0 && p.Issuer != "" {
+		p.Scopes = []string{"openid", "email", "profile"}
+	}
+	providers.Set(p.Name, p)
+	return nil
+}
+
+// Get return the provider registered with this name
+func Get(name string) (*Provider, bool) {
+	return providers.Get(name)
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (p *Provider) isOIDC() bool {
+	for _, s := range p.Scopes {
+		if s == "openid" {
+			return true
+		}
+	}
+	return false
+}
+
+// discover fill missing endpoints from the issuer openid configuration, only once
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered || p.Issuer == "" {
+		return nil
+	}
+	conf := struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}{}
+	err := p.getJson(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", "", &conf)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSuffix(conf.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return fmt.Errorf("oauth: issuer mismatch, got %q", conf.Issuer)
+	}
+	if p.AuthURL == "" {
+		p.AuthURL = conf.AuthorizationEndpoint
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = conf.TokenEndpoint
+	}
+	if p.UserInfoURL == "" {
+		p.UserInfoURL = conf.UserinfoEndpoint
+	}
+	if p.JWKSURL == "" {
+		p.JWKSURL = conf.JwksURI
+	}
+	p.discovered = true
+	return nil
+}
+
+// authCodeURL return the url to redirect the user to
+func (p *Provider) authCodeURL(redirectURL, state, challenge, nonce string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("state", state)
+	v.Set("code_challenge", challenge)
+	v.Set("code_challenge_method", "S256")
+	if len(p.Scopes) > 0 {
+		v.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if nonce != "" {
+		v.Set("nonce", nonce)
+	}
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + v.Encode()
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+// exchange trade the authorization code and the PKCE verifier for tokens
+func (p *Provider) exchange(ctx context.Context, code, verifier, redirectURL string) (tokenResponse, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("client_id", p.ClientID)
+	v.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		v.Set("client_secret", p.ClientSecret)
+	}
+	tr := tokenResponse{}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return tr, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return tr, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return tr, err
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return tr, fmt.Errorf("oauth: bad token response (%d)", resp.StatusCode)
+	}
+	if tr.Error != "" {
+		return tr, fmt.Errorf("oauth: %s %s", tr.Error, tr.ErrorDesc)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return tr, fmt.Errorf("oauth: token endpoint returned %d", resp.StatusCode)
+	}
+	return tr, nil
+}
+
+// userInfo read the claims from the userinfo endpoint using the access token
+func (p *Provider) userInfo(ctx context.Context, accessToken string) (Claims, error) {
+	raw := map[string]any{}
+	if err := p.getJson(ctx, p.UserInfoURL, accessToken, &raw); err != nil {
+		return Claims{}, err
+	}
+	claims := claimsFromMap(raw)
+	if claims.Subject == "" {
+		// plain OAuth2 apis usually use id
+		switch id := raw["id"].(type) {
+		case string:
+			claims.Subject = id
+		case float64:
+			claims.Subject = strconv.FormatFloat(id, 'f', -1, 64)
+		}
+	}
+	if p.TrustEmail && claims.Email != "" {
+		claims.EmailVerified = true
+	}
+	return claims, nil
+}
+
+func (p *Provider) getJson(ctx context.Context, u, bearer string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth: GET %s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dest)
+}
+
+func claimsFromMap(raw map[string]any) Claims {
+	c := Claims{Raw: raw}
+	c.Subject, _ = raw["sub"].(string)
+	c.Email, _ = raw["email"].(string)
+	c.Name, _ = raw["name"].(string)
+	switch v := raw["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		// some providers send it as a string
+		c.EmailVerified = v == "true"
+	}
+	return c
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/auth/oauth"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+func init() {
+	r := kamux.Router{}
+	r.LoadEnv("../../../../.env")
+	orm.UseCache = false
+	err := orm.InitDB()
+	if logger.CheckError(err) {
+		return
+	}
+	err = orm.Migrate()
+	logger.CheckError(err)
+}
+
+// fakeProvider is a minimal OIDC provider, it approve every authorization request
+type fakeProvider struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	signKey *rsa.PrivateKey
+	email   string
+	mu      sync.Mutex
+	codes   map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T, email string) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeProvider{key: key, signKey: key, email: email, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := base64.RawURLEncoding.EncodeToString([]byte(time.Now().String()))
+		f.mu.Lock()
+		f.codes[code] = q
+		f.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		auth, ok := f.codes[r.PostForm.Get("code")]
+		delete(f.codes, r.PostForm.Get("code"))
+		f.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") ||
+			r.PostForm.Get("client_id") != "kago" || r.PostForm.Get("client_secret") != "secret" ||
+			r.PostForm.Get("redirect_uri") != auth.Get("redirect_uri") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token": f.sign(t, map[string]any{
+				"iss":            f.URL,
+				"aud":            "kago",
+				"sub":            "subject-" + f.email,
+				"email":          f.email,
+				"email_verified": true,
+				"nonce":          auth.Get("nonce"),
+				"iat":            time.Now().Unix(),
+				"exp":            time.Now().Add(time.Minute).Unix(),
+			}),
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeProvider) sign(t *testing.T, claims map[string]any) string {
+	h, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.signKey, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func context(method, target string, cookies []*http.Cookie) (*kamux.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, nil)
+	for _, ck := range cookies {
+		req.AddCookie(ck)
+	}
+	rec := httptest.NewRecorder()
+	return &kamux.Context{ResponseWriter: rec, Request: req, Params: map[string]string{"provider": "fake"}}, rec
+}
+
+// login run the whole flow and return the callback response, tamper can modify the callback url
+func login(t *testing.T, f *fakeProvider, tamper func(u *url.URL)) *httptest.ResponseRecorder {
+	c, rec := context("GET", "/auth/oauth/fake/login?next=/dashboard", nil)
+	oauth.LoginView(c)
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), f.URL+"/authorize") {
+		t.Fatal("login should redirect to the provider", rec.Code, rec.Header().Get("Location"))
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(callback)
+	}
+	c, rec = context("GET", callback.RequestURI(), rec.Result().Cookies())
+	oauth.CallbackView(c)
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) string {
+	for _, ck := range rec.Result().Cookies() {
+		if ck.Name == "session" {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+func TestOIDCLoginSignup(t *testing.T) {
+	f := newFakeProvider(t, "oidc@gmail.com")
+	defer f.Close()
+	err := oauth.Register(&oauth.Provider{Name: "fake", ClientID: "kago", ClientSecret: "secret", Issuer: f.URL, AllowSignup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := login(t, f, nil)
+	if rec.Code != http.StatusOK || sessionCookie(rec) == "" {
+		t.Fatal("login failed", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "/dashboard") {
+		t.Error("should redirect to next", rec.Body.String())
+	}
+	rows, err := orm.Query(orm.DefaultDB, "select u.email from users_identities i join users u on u.id = i.user_id where i.provider = ? and i.subject = ?", "fake", "subject-oidc@gmail.com")
+	if err != nil || rows[0]["email"] != "oidc@gmail.com" {
+		t.Fatal("identity not linked", rows, err)
+	}
+
+	// second login use the existing identity
+	rec = login(t, f, nil)
+	if rec.Code != http.StatusOK || sessionCookie(rec) == "" {
+		t.Fatal("second login failed", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOIDCRejected(t *testing.T) {
+	f := newFakeProvider(t, "rejected@gmail.com")
+	defer f.Close()
+	err := oauth.Register(&oauth.Provider{Name: "fake", ClientID: "kago", ClientSecret: "secret", Issuer: f.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := login(t, f, func(u *url.URL) {
+		q := u.Query()
+		q.Set("state", "forged")
+		u.RawQuery = q.Encode()
+	})
+	if rec.Code != http.StatusBadRequest || sessionCookie(rec) != "" {
+		t.Error("forged state accepted", rec.Code)
+	}
+
+	// id token signed by another key
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.signKey = other
+	rec = login(t, f, nil)
+	if rec.Code != http.StatusUnauthorized || sessionCookie(rec) != "" {
+		t.Error("bad signature accepted", rec.Code)
+	}
+	f.signKey = f.key
+
+	// valid token but signup is not allowed and no account exist
+	rec = login(t, f, nil)
+	if rec.Code != http.StatusForbidden || sessionCookie(rec) != "" {
+		t.Error("unknown identity should not login", rec.Code)
+	}
+}
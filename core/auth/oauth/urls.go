@@ -0,0 +1,8 @@
+package oauth
+
+import "github.com/kamalshkeir/kago/core/kamux"
+
+func UrlPatterns(r *kamux.Router) {
+	r.GET("/auth/oauth/provider:str/login", kamux.Auth(LoginView))
+	r.GET("/auth/oauth/provider:str/callback", CallbackView)
+}
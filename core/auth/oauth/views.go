@@ -0,0 +1,280 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/auth"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kstrct"
+)
+
+const stateCookie = "oauth_state"
+
+var (
+	// STATE_TTL is the time the user has to complete the login at the provider
+	STATE_TTL = 10 * time.Minute
+	// REDIRECT_AFTER_LOGIN is used when the login url has no next param
+	REDIRECT_AFTER_LOGIN = "/"
+	ErrNoAccount         = errors.New("oauth: no account linked to this identity")
+)
+
+type loginState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Verifier string `json:"v"`
+	Nonce    string `json:"n,omitempty"`
+	Next     string `json:"r,omitempty"`
+	// Link is the uuid of the logged in user starting the flow, the identity is added to this account
+	Link   string `json:"l,omitempty"`
+	Expire int64  `json:"e"`
+}
+
+var LoginView = func(c *kamux.Context) {
+	p, ok := Get(c.Params["provider"])
+	if !ok {
+		c.Status(http.StatusNotFound).Text("unknown provider")
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), HTTP_TIMEOUT)
+	defer cancel()
+	if err := p.discover(ctx); logger.CheckError(err) {
+		c.Status(http.StatusBadGateway).Text("provider unavailable")
+		return
+	}
+	st := loginState{
+		Provider: p.Name,
+		State:    randomString(32),
+		Verifier: randomString(32),
+		Next:     safeNext(c.QueryParam("next")),
+		Expire:   time.Now().Add(STATE_TTL).Unix(),
+	}
+	if p.isOIDC() {
+		st.Nonce = randomString(16)
+	}
+	if user, ok := c.User(); ok {
+		st.Link = user.Uuid
+	}
+	b, err := json.Marshal(st)
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Text("unable to start login")
+		return
+	}
+	value, err := encryptor.Encrypt(string(b))
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Text("unable to start login")
+		return
+	}
+	// Lax, the cookie has to be sent back when the provider redirect to the callback
+	http.SetCookie(c.ResponseWriter, &http.Cookie{
+		Name:     stateCookie,
+		Value:    value,
+		Path:     "/auth/oauth/",
+		MaxAge:   int(STATE_TTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   kamux.COOKIES_Secure || c.Scheme() == "https",
+	})
+	sum := sha256.Sum256([]byte(st.Verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	c.Status(http.StatusFound).Redirect(p.authCodeURL(redirectURL(c, p), st.State, challenge, st.Nonce))
+}
+
+var CallbackView = func(c *kamux.Context) {
+	p, ok := Get(c.Params["provider"])
+	if !ok {
+		c.Status(http.StatusNotFound).Text("unknown provider")
+		return
+	}
+	st, err := readState(c, p)
+	http.SetCookie(c.ResponseWriter, &http.Cookie{Name: stateCookie, Path: "/auth/oauth/", MaxAge: -1})
+	if err != nil {
+		c.Status(http.StatusBadRequest).Text("login expired or invalid, please try again")
+		return
+	}
+	if e := c.QueryParam("error"); e != "" {
+		c.Status(http.StatusBadRequest).Text("login refused by the provider: " + e)
+		return
+	}
+	code := c.QueryParam("code")
+	if code == "" {
+		c.Status(http.StatusBadRequest).Text("missing code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), HTTP_TIMEOUT)
+	defer cancel()
+	if err := p.discover(ctx); logger.CheckError(err) {
+		c.Status(http.StatusBadGateway).Text("provider unavailable")
+		return
+	}
+	tokens, err := p.exchange(ctx, code, st.Verifier, redirectURL(c, p))
+	if logger.CheckError(err) {
+		c.Status(http.StatusBadGateway).Text("unable to complete login with the provider")
+		return
+	}
+	var claims Claims
+	switch {
+	case tokens.IdToken != "":
+		claims, err = p.verifyIdToken(ctx, tokens.IdToken, st.Nonce)
+	case p.isOIDC():
+		err = errors.New("oauth: no id token returned")
+	case p.UserInfoURL != "":
+		claims, err = p.userInfo(ctx, tokens.AccessToken)
+	default:
+		err = errors.New("oauth: set UserInfoURL for OAuth2 providers")
+	}
+	if err == nil && claims.Subject == "" {
+		err = errors.New("oauth: no subject returned")
+	}
+	if logger.CheckError(err) {
+		c.Status(http.StatusUnauthorized).Text("unable to verify your identity")
+		return
+	}
+
+	user, err := resolveUser(p, claims, st.Link)
+	if err != nil {
+		logger.Error(err)
+		c.Status(http.StatusForbidden).Text("no account is linked to this identity")
+		return
+	}
+	if next, ok := auth.RequireSecondFactor(c, user.Uuid); ok {
+		redirectPage(c, next)
+		return
+	}
+	auth.LoginSucceeded(c, user.Email)
+	auth.SetSession(c, user.Uuid)
+	redirectPage(c, st.Next)
+}
+
+// LinkIdentity link the identity of a provider to user
+func LinkIdentity(provider string, claims Claims, user models.User) error {
+	_, err := orm.Table("users_identities").Insert("user_id,provider,subject,email", []any{user.Id, provider, claims.Subject, claims.Email})
+	return err
+}
+
+// UnlinkIdentity remove the identity of a provider from user
+func UnlinkIdentity(provider string, userId int) error {
+	_, err := orm.Table("users_identities").Where("provider = ? AND user_id = ?", provider, userId).Delete()
+	return err
+}
+
+// resolveUser find the user of an identity, linking it to the logged in user, or to the account with the same verified email,
+// or to a new account if p.AllowSignup
+func resolveUser(p *Provider, claims Claims, linkUuid string) (models.User, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select user_id from users_identities where provider = ? and subject = ?", p.Name, claims.Subject)
+	if err == nil {
+		return userWhere("id = ?", rows[0]["user_id"])
+	}
+	if linkUuid != "" {
+		user, err := userWhere("uuid = ?", linkUuid)
+		if err != nil {
+			return user, err
+		}
+		return user, LinkIdentity(p.Name, claims, user)
+	}
+	if claims.Email == "" {
+		return models.User{}, ErrNoAccount
+	}
+	// never link on an email the provider did not verify, anyone could take over the account
+	if claims.EmailVerified {
+		if user, err := userWhere("lower(email) = ?", strings.ToLower(claims.Email)); err == nil {
+			return user, LinkIdentity(p.Name, claims, user)
+		}
+	}
+	if !p.AllowSignup {
+		return models.User{}, ErrNoAccount
+	}
+	if err := orm.CreateUser(claims.Email, randomString(32), 0); err != nil {
+		return models.User{}, err
+	}
+	user, err := userWhere("email = ?", claims.Email)
+	if err != nil {
+		return user, err
+	}
+	if claims.EmailVerified {
+		_, err = orm.Table("users").Where("id = ?", user.Id).Set("email_verified = ?", 1)
+		logger.CheckError(err)
+	}
+	return user, LinkIdentity(p.Name, claims, user)
+}
+
+func userWhere(query string, arg any) (models.User, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select * from users where "+query, arg)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{}
+	if err := kstrct.FillFromMap(&user, rows[0]); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func readState(c *kamux.Context, p *Provider) (loginState, error) {
+	st := loginState{}
+	value, err := c.GetCookie(stateCookie)
+	if err != nil || value == "" {
+		return st, errors.New("oauth: no state cookie")
+	}
+	decrypted, err := encryptor.Decrypt(value)
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal([]byte(decrypted), &st); err != nil {
+		return st, err
+	}
+	if st.Provider != p.Name || time.Now().Unix() > st.Expire {
+		return st, errors.New("oauth: state expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(st.State), []byte(c.QueryParam("state"))) != 1 {
+		return st, errors.New("oauth: state mismatch")
+	}
+	return st, nil
+}
+
+func redirectURL(c *kamux.Context, p *Provider) string {
+	if p.RedirectURL != "" {
+		return p.RedirectURL
+	}
+	return c.BaseURL() + "/auth/oauth/" + p.Name + "/callback"
+}
+
+// redirectPage redirect from the browser, a Strict session cookie set during a redirect chain started
+// by another site would not be sent on the next request
+func redirectPage(c *kamux.Context, to string) {
+	to = template.HTMLEscapeString(safeNext(to))
+	c.SetHeader("Content-Type", "text/html; charset=utf-8")
+	c.WriteHeader(http.StatusOK)
+	fmt.Fprintf(c.ResponseWriter, `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=%s"></head><body><a href="%s">Continue</a></body></html>`, to, to)
+}
+
+// safeNext only allow local paths, to not be used as an open redirect
+func safeNext(next string) string {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return REDIRECT_AFTER_LOGIN
+	}
+	return next
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/auth"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kago/core/utils/mailer"
+)
+
+const email = "reset@gmail.com"
+
+var outbox = &mailer.Outbox{}
+var reLink = regexp.MustCompile(`token=([^"<\s]+)`)
+
+func init() {
+	r := kamux.Router{}
+	r.LoadEnv("../../../.env")
+	orm.UseCache = false
+	err := orm.InitDB()
+	if logger.CheckError(err) {
+		return
+	}
+	err = orm.Migrate()
+	if logger.CheckError(err) {
+		return
+	}
+	if _, err := orm.Table("users").Where("email = ?", email).One(); err != nil {
+		err = orm.CreateUser(email, "olaolaola", 0)
+		logger.CheckError(err)
+	}
+	mailer.Default = outbox
+}
+
+func tokenFromOutbox(t *testing.T) string {
+	msg, ok := outbox.Last(email)
+	if !ok {
+		t.Fatal("no email captured for", email)
+	}
+	m := reLink.FindStringSubmatch(msg.Body)
+	if len(m) < 2 {
+		t.Fatal("no token found in email body", msg.Body)
+	}
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestResetPasswordToken(t *testing.T) {
+	user, err := orm.Model[models.User]().Where("email = ?", email).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.SendResetPasswordEmail("http://localhost:9313", user); err != nil {
+		t.Fatal(err)
+	}
+	token := tokenFromOutbox(t)
+	u, _, err := auth.CheckToken(auth.PURPOSE_RESET_PASSWORD, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != email {
+		t.Error("token belong to", u.Email, "expected", email)
+	}
+	if _, _, err := auth.CheckToken(auth.PURPOSE_VERIFY_EMAIL, token); err == nil {
+		t.Error("token should not be valid for another purpose")
+	}
+	if err := auth.SetPassword(u, "newpassword"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := auth.CheckToken(auth.PURPOSE_RESET_PASSWORD, token); err == nil {
+		t.Error("token should be invalid after password change")
+	}
+}
+
+func TestVerifyEmailToken(t *testing.T) {
+	user, err := orm.Model[models.User]().Where("email = ?", email).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.SendVerificationEmail("http://localhost:9313", user); err != nil {
+		t.Fatal(err)
+	}
+	token := tokenFromOutbox(t)
+	if _, _, err := auth.CheckToken(auth.PURPOSE_VERIFY_EMAIL, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := auth.CheckToken(auth.PURPOSE_VERIFY_EMAIL, token+"x"); err == nil {
+		t.Error("tampered token should be invalid")
+	}
+}
+
+func TestForgotPasswordForgedHost(t *testing.T) {
+	old := settings.Config.Host
+	settings.Config.Host = "localhost"
+	t.Cleanup(func() { settings.Config.Host = old })
+	forgot := func(host string) bool {
+		outbox.Flush()
+		c, rec := newContext("POST", `{"email":"`+email+`"}`, "10.0.0.9")
+		c.Request.Host = host
+		auth.ForgotPasswordPOSTView(c)
+		if rec.Code != http.StatusOK {
+			t.Fatal("unexpected status", rec.Code)
+		}
+		_, ok := outbox.Last(email)
+		return ok
+	}
+
+	if forgot("evil.com") {
+		t.Error("no email should be sent for a forged host")
+	}
+	if !forgot("localhost:9313") {
+		t.Fatal("email should be sent for HOST")
+	}
+	msg, _ := outbox.Last(email)
+	if !strings.Contains(msg.Body, "http://localhost:9313/auth/password/reset") {
+		t.Error("link should use the request host", msg.Body)
+	}
+
+	auth.BASE_URL = "https://example.com/"
+	t.Cleanup(func() { auth.BASE_URL = "" })
+	if !forgot("evil.com") {
+		t.Fatal("email should be sent when BASE_URL is set")
+	}
+	msg, _ = outbox.Last(email)
+	if strings.Contains(msg.Body, "evil.com") || !strings.Contains(msg.Body, "https://example.com/auth/password/reset") {
+		t.Error("link should use BASE_URL", msg.Body)
+	}
+}
+
+func TestChangeEmailUsed(t *testing.T) {
+	const taken = "taken@gmail.com"
+	if _, err := orm.Table("users").Where("email = ?", taken).One(); err != nil {
+		if err := orm.CreateUser(taken, "olaolaola", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err := orm.Model[models.User]().Where("email = ?", email).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const key utils.ContextKey = "user"
+	c, rec := newContext("POST", `{"email":"Taken@gmail.com"}`, "10.0.0.10")
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), key, user))
+	auth.ChangeEmailPOSTView(c)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "email already used") {
+		t.Errorf("a used email should be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// taken after the link was sent
+	r := kamux.Router{}
+	if err := r.AddLocalTemplates("../templates"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeToken(auth.PURPOSE_CHANGE_EMAIL, user, taken, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, rec = newContext("GET", "", "10.0.0.10")
+	c.Request.URL.RawQuery = "token=" + url.QueryEscape(token)
+	auth.ConfirmChangeEmailView(c)
+	if rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "already used") {
+		t.Errorf("confirm should refuse a used email, got %d %s", rec.Code, rec.Body.String())
+	}
+	if u, err := orm.Model[models.User]().Where("id = ?", user.Id).One(); err != nil || u.Email != email {
+		t.Errorf("email should not change, got %q %v", u.Email, err)
+	}
+}
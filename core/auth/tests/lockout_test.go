@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/admin"
+	"github.com/kamalshkeir/kago/core/auth"
+	"github.com/kamalshkeir/kago/core/kamux"
+)
+
+func newContext(method, body, ip string) (*kamux.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/admin/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	return &kamux.Context{ResponseWriter: rec, Request: req, Params: map[string]string{}}, rec
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	const target = "locked@gmail.com"
+	defer auth.ClearLockout("")
+	for i := 0; i < auth.LOGIN_FREE_ATTEMPTS; i++ {
+		c, _ := newContext("POST", "", "10.0.0.1")
+		if _, ok := auth.CheckLoginAllowed(c, target); !ok {
+			t.Fatal("locked before the free attempts, at", i)
+		}
+		auth.LoginFailed(c, target, "wrong password")
+	}
+	c, _ := newContext("POST", "", "10.0.0.1")
+	auth.LoginFailed(c, target, "wrong password")
+	wait, ok := auth.CheckLoginAllowed(c, target)
+	if ok || wait <= 0 {
+		t.Fatal("account should be locked", wait)
+	}
+	// the account is locked from any ip
+	c, _ = newContext("POST", "", "10.0.0.2")
+	if _, ok := auth.CheckLoginAllowed(c, target); ok {
+		t.Error("account should be locked from another ip")
+	}
+
+	if err := auth.ClearLockout("email:" + target); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.CheckLoginAllowed(c, target); !ok {
+		t.Error("lockout should be cleared")
+	}
+}
+
+func TestLoginUniformError(t *testing.T) {
+	defer auth.ClearLockout("")
+	c, unknown := newContext("POST", `{"email":"nobody@gmail.com","password":"olaolaola"}`, "10.0.0.3")
+	admin.LoginPOSTView(c)
+	c, wrong := newContext("POST", `{"email":"`+email+`","password":"wrongwrong"}`, "10.0.0.3")
+	admin.LoginPOSTView(c)
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", unknown.Code, wrong.Code)
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Errorf("errors should be identical, got %q and %q", unknown.Body.String(), wrong.Body.String())
+	}
+	attempts, err := auth.LoginAttempts(2)
+	if err != nil || len(attempts) != 2 {
+		t.Fatal("attempts not recorded", err)
+	}
+	if attempts[0].Reason != "wrong password" || attempts[1].Reason != "unknown email" || attempts[0].Ip != "10.0.0.3" {
+		t.Error("bad audit", attempts)
+	}
+}
+
+func TestLockoutConcurrentFailures(t *testing.T) {
+	const target = "burst@gmail.com"
+	defer auth.ClearLockout("")
+	n := 30
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			c, _ := newContext("POST", "", "10.0.0.4")
+			auth.LoginFailed(c, target, "wrong password")
+		}()
+	}
+	close(start)
+	wg.Wait()
+	lockouts, err := auth.Lockouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range lockouts {
+		if l.Target == "email:"+target && l.Failures != n {
+			t.Errorf("every concurrent failure should be counted, got %d expected %d", l.Failures, n)
+		}
+		if l.Target == "ip:10.0.0.4" && l.Failures != n {
+			t.Errorf("ip failures: got %d expected %d", l.Failures, n)
+		}
+	}
+	c, _ := newContext("POST", "", "10.0.0.5")
+	if _, ok := auth.CheckLoginAllowed(c, target); ok {
+		t.Error("account should be locked after a burst of failures")
+	}
+}
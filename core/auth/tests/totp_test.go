@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/auth"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/qrcode"
+	"github.com/kamalshkeir/kago/core/utils/totp"
+)
+
+func TestTotpRFC6238(t *testing.T) {
+	// test vectors from RFC 6238 appendix B, SHA1
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	totp.DIGITS = 8
+	defer func() { totp.DIGITS = 6 }()
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for ts, want := range vectors {
+		got, err := totp.Code(secret, time.Unix(ts, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("at %d got %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestTotpEnrollAndLogin(t *testing.T) {
+	user, err := orm.Model[models.User]().Where("email = ?", email).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.DisableTotp(user.Id)
+
+	secret, uri, err := auth.EnrollTotp(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/") || !strings.Contains(uri, "secret="+secret) {
+		t.Error("bad uri", uri)
+	}
+	if _, err := qrcode.Encode(uri, qrcode.M); err != nil {
+		t.Error(err)
+	}
+	if auth.TotpEnabled(user.Id) {
+		t.Fatal("totp should not be enabled before confirmation")
+	}
+
+	// use the previous period for confirmation and the current one for login, each code work once
+	prev, _ := totp.Code(secret, time.Now().Add(-totp.PERIOD))
+	codes, err := auth.ConfirmTotp(user, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != auth.RECOVERY_CODES_COUNT || !auth.TotpEnabled(user.Id) {
+		t.Fatal("totp not enabled", codes)
+	}
+	if err := auth.CheckSecondFactor(user.Id, prev); err == nil {
+		t.Error("a code should not be accepted twice")
+	}
+	now, _ := totp.Code(secret, time.Now())
+	if err := auth.CheckSecondFactor(user.Id, now); err != nil {
+		t.Error(err)
+	}
+
+	if err := auth.CheckSecondFactor(user.Id, codes[0]); err != nil {
+		t.Error(err)
+	}
+	if err := auth.CheckSecondFactor(user.Id, codes[0]); err == nil {
+		t.Error("a recovery code should be used only once")
+	}
+	if err := auth.CheckSecondFactor(user.Id, "aaaaa-bbbbb"); err == nil {
+		t.Error("unknown recovery code accepted")
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kstrct"
+)
+
+const (
+	PURPOSE_RESET_PASSWORD = "reset-password"
+	PURPOSE_VERIFY_EMAIL   = "verify-email"
+	PURPOSE_CHANGE_EMAIL   = "change-email"
+)
+
+var (
+	RESET_PASSWORD_TTL = time.Hour
+	VERIFY_EMAIL_TTL   = 48 * time.Hour
+	CHANGE_EMAIL_TTL   = 24 * time.Hour
+	ErrInvalidToken    = errors.New("invalid or expired token")
+)
+
+type tokenPayload struct {
+	Purpose string `json:"p"`
+	Uuid    string `json:"u"`
+	Expire  int64  `json:"e"`
+	Data    string `json:"d,omitempty"`
+}
+
+// MakeToken create a signed token for user, the signature include the user password, email and verified state,
+// so the token stop working as soon as one of them change (single use) or when it expire
+func MakeToken(purpose string, user models.User, data string, ttl time.Duration) (string, error) {
+	if user.Uuid == "" {
+		return "", errors.New("user has no uuid")
+	}
+	p := tokenPayload{
+		Purpose: purpose,
+		Uuid:    user.Uuid,
+		Expire:  time.Now().Add(ttl).Unix(),
+		Data:    data,
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + sign(payload, user), nil
+}
+
+// CheckToken verify token signature, purpose and expiration and return the user it was made for with its data
+func CheckToken(purpose, token string) (models.User, string, error) {
+	payload, sig, found := strings.Cut(token, ".")
+	if !found || payload == "" || sig == "" {
+		return models.User{}, "", ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return models.User{}, "", ErrInvalidToken
+	}
+	p := tokenPayload{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return models.User{}, "", ErrInvalidToken
+	}
+	if p.Purpose != purpose || p.Uuid == "" || time.Now().Unix() > p.Expire {
+		return models.User{}, "", ErrInvalidToken
+	}
+	user, err := userByUuid(p.Uuid)
+	if err != nil {
+		return models.User{}, "", ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(payload, user))) {
+		return models.User{}, "", ErrInvalidToken
+	}
+	return user, p.Data, nil
+}
+
+// userByUuid read the user without the orm cache, so a token is never checked against a stale password or email
+func userByUuid(uuid string) (models.User, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select * from users where uuid = ?", uuid)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{}
+	if err := kstrct.FillFromMap(&user, rows[0]); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func sign(payload string, user models.User) string {
+	mac := hmac.New(sha256.New, []byte(encryptor.Secret()))
+	mac.Write([]byte(payload))
+	// user state, any change invalidate all tokens already sent
+	mac.Write([]byte{0})
+	mac.Write([]byte(user.Password))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(user.Email)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatBool(user.EmailVerified)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kago/core/utils/totp"
+	"github.com/kamalshkeir/kstrct"
+)
+
+const PURPOSE_LOGIN_2FA = "login-2fa"
+
+var (
+	// TOTP_ISSUER is the name shown in authenticator apps
+	TOTP_ISSUER          = "Kago"
+	RECOVERY_CODES_COUNT = 10
+	LOGIN_2FA_TTL        = 5 * time.Minute
+	ErrInvalidCode       = errors.New("invalid code")
+	ErrTotpNotEnrolled   = errors.New("two factor authentication is not enabled")
+)
+
+// TotpEnabled return true if user confirmed a TOTP enrollment
+func TotpEnabled(userId int) bool {
+	t, err := userTotp(userId)
+	return err == nil && t.Confirmed
+}
+
+// EnrollTotp generate a new secret for user and return it with its otpauth:// uri,
+// the second factor is not active until ConfirmTotp is called with a valid code
+func EnrollTotp(user models.User) (string, string, error) {
+	if TotpEnabled(user.Id) {
+		return "", "", errors.New("two factor authentication already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := encryptor.Encrypt(secret)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = orm.Table("users_totp").Where("user_id = ?", user.Id).Delete()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = orm.Table("users_totp").Insert("user_id,secret,confirmed,last_counter", []any{user.Id, encrypted, 0, 0})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(TOTP_ISSUER, user.Email, secret), nil
+}
+
+// ConfirmTotp activate the pending enrollment of user if code is valid and return new recovery codes, to show only once
+func ConfirmTotp(user models.User, code string) ([]string, error) {
+	t, err := userTotp(user.Id)
+	if err != nil {
+		return nil, ErrTotpNotEnrolled
+	}
+	if t.Confirmed {
+		return nil, errors.New("two factor authentication already enabled")
+	}
+	if err := checkTotpCode(t, code); err != nil {
+		return nil, err
+	}
+	_, err = orm.Table("users_totp").Where("id = ?", t.Id).Set("confirmed = ?", 1)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateRecoveryCodes(user.Id)
+}
+
+// DisableTotp remove the second factor and the recovery codes of user
+func DisableTotp(userId int) error {
+	_, err := orm.Table("users_totp").Where("user_id = ?", userId).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = orm.Table("users_recovery_codes").Where("user_id = ?", userId).Delete()
+	return err
+}
+
+// CheckSecondFactor accept a TOTP code or an unused recovery code, both can be used only once
+func CheckSecondFactor(userId int, code string) error {
+	t, err := userTotp(userId)
+	if err != nil || !t.Confirmed {
+		return ErrTotpNotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if len(strings.ReplaceAll(code, " ", "")) == totp.DIGITS {
+		return checkTotpCode(t, code)
+	}
+	n, err := orm.Table("users_recovery_codes").Where("user_id = ? AND code = ? AND used = ?", userId, hashRecoveryCode(code), 0).Set("used = ?", 1)
+	if err != nil || n != 1 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// GenerateRecoveryCodes replace all recovery codes of user and return them in clear, only hashes are stored
+func GenerateRecoveryCodes(userId int) ([]string, error) {
+	_, err := orm.Table("users_recovery_codes").Where("user_id = ?", userId).Delete()
+	if err != nil {
+		return nil, err
+	}
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, 0, RECOVERY_CODES_COUNT)
+	for i := 0; i < RECOVERY_CODES_COUNT; i++ {
+		b := make([]byte, 10)
+		for j := range b {
+			// rand.Int is uniform, a byte modulo the alphabet would favor its first letters
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return nil, err
+			}
+			b[j] = alphabet[n.Int64()]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		_, err = orm.Table("users_recovery_codes").Insert("user_id,code,used", []any{userId, hashRecoveryCode(code), 0})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// checkTotpCode validate code and store its counter, so the same code cannot be used twice
+func checkTotpCode(t models.UserTotp, code string) error {
+	secret, err := encryptor.Decrypt(t.Secret)
+	if err != nil {
+		return err
+	}
+	counter, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidCode
+	}
+	n, err := orm.Table("users_totp").Where("id = ? AND last_counter < ?", t.Id, counter).Set("last_counter = ?", counter)
+	if err != nil || n != 1 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// userTotp read without the orm cache, the row change on every login
+func userTotp(userId int) (models.UserTotp, error) {
+	rows, err := orm.Query(orm.DefaultDB, "select * from users_totp where user_id = ?", userId)
+	if err != nil {
+		return models.UserTotp{}, err
+	}
+	t := models.UserTotp{}
+	if err := kstrct.FillFromMap(&t, rows[0]); err != nil {
+		return models.UserTotp{}, err
+	}
+	return t, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
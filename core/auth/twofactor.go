@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kago/core/utils/qrcode"
+)
+
+const pendingCookie = "session_2fa"
+
+// RequireSecondFactor is called after a valid password, if the user has to pass a second step it store a short lived
+// pending login in a cookie and return the url to continue, the session cookie should not be set in this case
+func RequireSecondFactor(c *kamux.Context, uuid string) (string, bool) {
+	user, err := userByUuid(uuid)
+	if err != nil {
+		return "", false
+	}
+	enabled := TotpEnabled(user.Id)
+	if !enabled && !(settings.Config.Force2FA && user.IsAdmin) {
+		return "", false
+	}
+	token, err := MakeToken(PURPOSE_LOGIN_2FA, user, "", LOGIN_2FA_TTL)
+	if logger.CheckError(err) {
+		return "", false
+	}
+	c.SetCookie(pendingCookie, token)
+	if enabled {
+		return "/admin/login/2fa", true
+	}
+	return "/auth/2fa/setup", true
+}
+
+var TwoFactorLoginView = func(c *kamux.Context) {
+	if _, ok := pendingUser(c); !ok {
+		c.Status(http.StatusTemporaryRedirect).Redirect("/admin/login")
+		return
+	}
+	c.Html("auth/login_2fa.html", nil)
+}
+
+var TwoFactorLoginPOSTView = func(c *kamux.Context) {
+	user, ok := pendingUser(c)
+	if !ok {
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": "login expired, please login again",
+		})
+		return
+	}
+	if wait, ok := CheckLoginAllowed(c, user.Email); !ok {
+		c.SetHeader("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		c.Status(http.StatusTooManyRequests).Json(map[string]any{
+			"error": ErrTooManyAttempts.Error(),
+		})
+		return
+	}
+	code, _ := c.BodyJson()["code"].(string)
+	if err := CheckSecondFactor(user.Id, code); err != nil {
+		LoginFailed(c, user.Email, "wrong 2fa code")
+		c.Status(http.StatusForbidden).Json(map[string]any{
+			"error": ErrInvalidCode.Error(),
+		})
+		return
+	}
+	LoginSucceeded(c, user.Email)
+	c.DeleteCookie(pendingCookie)
+	SetSession(c, user.Uuid)
+	c.Json(map[string]any{
+		"success":  "U Are Logged In",
+		"redirect": "/admin",
+	})
+}
+
+var TotpSetupView = func(c *kamux.Context) {
+	user, ok := c.User()
+	pending := false
+	if !ok {
+		if user, ok = pendingUser(c); !ok {
+			c.Status(http.StatusTemporaryRedirect).Redirect("/admin/login")
+			return
+		}
+		pending = true
+	}
+	if TotpEnabled(user.Id) {
+		c.Html("auth/setup_2fa.html", map[string]any{
+			"enabled": true,
+			"email":   user.Email,
+		})
+		return
+	}
+	secret, uri, err := EnrollTotp(user)
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Text("unable to enroll two factor authentication")
+		return
+	}
+	qr, err := qrcode.Encode(uri, qrcode.M)
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Text("unable to enroll two factor authentication")
+		return
+	}
+	c.Html("auth/setup_2fa.html", map[string]any{
+		"qr":     template.HTML(qr.SVG(4)),
+		"secret": secret,
+		"uri":    uri,
+		"forced": pending,
+	})
+}
+
+var TotpSetupPOSTView = func(c *kamux.Context) {
+	user, ok := c.User()
+	pending := false
+	if !ok {
+		if user, ok = pendingUser(c); !ok {
+			c.Status(http.StatusUnauthorized).Json(map[string]any{
+				"error": "you need to be logged in",
+			})
+			return
+		}
+		pending = true
+	}
+	code, _ := c.BodyJson()["code"].(string)
+	codes, err := ConfirmTotp(user, code)
+	if err != nil {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	res := map[string]any{
+		"success":        "two factor authentication enabled",
+		"recovery_codes": codes,
+	}
+	if pending {
+		// enrollment forced at login, it count as the second step
+		LoginSucceeded(c, user.Email)
+		c.DeleteCookie(pendingCookie)
+		SetSession(c, user.Uuid)
+		res["redirect"] = "/admin"
+	}
+	c.Json(res)
+}
+
+var TotpDisablePOSTView = func(c *kamux.Context) {
+	user, ok := c.User()
+	if !ok {
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": "you need to be logged in",
+		})
+		return
+	}
+	if settings.Config.Force2FA && user.IsAdmin {
+		c.Status(http.StatusForbidden).Json(map[string]any{
+			"error": "two factor authentication is required for admins",
+		})
+		return
+	}
+	code, _ := c.BodyJson()["code"].(string)
+	if err := CheckSecondFactor(user.Id, code); err != nil {
+		c.Status(http.StatusForbidden).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	if logger.CheckError(DisableTotp(user.Id)) {
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to disable two factor authentication",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "two factor authentication disabled",
+	})
+}
+
+var RecoveryCodesPOSTView = func(c *kamux.Context) {
+	user, ok := c.User()
+	if !ok {
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": "you need to be logged in",
+		})
+		return
+	}
+	code, _ := c.BodyJson()["code"].(string)
+	if err := CheckSecondFactor(user.Id, code); err != nil {
+		c.Status(http.StatusForbidden).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	codes, err := GenerateRecoveryCodes(user.Id)
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to generate recovery codes",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success":        "new recovery codes generated, the old ones no longer work",
+		"recovery_codes": codes,
+	})
+}
+
+// pendingUser return the user that passed the password step, from the pending login cookie
+func pendingUser(c *kamux.Context) (models.User, bool) {
+	token, err := c.GetCookie(pendingCookie)
+	if err != nil || token == "" {
+		return models.User{}, false
+	}
+	user, _, err := CheckToken(PURPOSE_LOGIN_2FA, token)
+	if err != nil {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// SetSession log the user in by setting the session cookie, encrypted if kamux.SESSION_ENCRYPTION
+func SetSession(c *kamux.Context, uuid string) {
+	if kamux.SESSION_ENCRYPTION {
+		var err error
+		uuid, err = encryptor.Encrypt(uuid)
+		logger.CheckError(err)
+	}
+	c.SetCookie("session", uuid)
+}
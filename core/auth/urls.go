@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+func UrlPatterns(r *kamux.Router) {
+	err := r.AddEmbededTemplates(pagesFS, "templates")
+	logger.CheckError(err)
+	r.GET("/auth/password/forgot", ForgotPasswordView)
+	r.POST("/auth/password/forgot", ForgotPasswordPOSTView)
+	r.GET("/auth/password/reset", ResetPasswordView)
+	r.POST("/auth/password/reset", ResetPasswordPOSTView)
+	r.GET("/auth/email/verify", VerifyEmailView)
+	r.POST("/auth/email/verify", kamux.Auth(SendVerificationPOSTView))
+	r.GET("/auth/email/change", kamux.Auth(ChangeEmailView))
+	r.POST("/auth/email/change", kamux.Auth(ChangeEmailPOSTView))
+	r.GET("/auth/email/change/confirm", ConfirmChangeEmailView)
+	r.GET("/admin/login/2fa", TwoFactorLoginView)
+	r.POST("/admin/login/2fa", TwoFactorLoginPOSTView)
+	r.GET("/auth/2fa/setup", kamux.Auth(TotpSetupView))
+	r.POST("/auth/2fa/setup", kamux.Auth(TotpSetupPOSTView))
+	r.POST("/auth/2fa/disable", kamux.Auth(TotpDisablePOSTView))
+	r.POST("/auth/2fa/recovery", kamux.Auth(RecoveryCodesPOSTView))
+	r.GET("/admin/lockouts", kamux.Admin(LockoutsView))
+	r.POST("/admin/lockouts/clear", kamux.Admin(LockoutsClearPOSTView))
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/encryption/hash"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kago/core/utils/mailer"
+)
+
+//go:embed templates
+var pagesFS embed.FS
+
+//go:embed emails/*.html
+var emailsFS embed.FS
+
+var emails = template.Must(template.ParseFS(emailsFS, "emails/*.html"))
+
+// BASE_URL is used to build links sent by email, if empty it is taken from the request when its host is HOST or one of DOMAINS
+var BASE_URL = ""
+
+// ErrUntrustedHost is returned when BASE_URL is empty and the host of the request is neither HOST nor one of DOMAINS
+var ErrUntrustedHost = errors.New("untrusted host, set auth.BASE_URL to send links by email")
+
+// ErrEmailUsed is returned when changing to an email already belonging to a user
+var ErrEmailUsed = errors.New("email already used")
+var PASSWORD_MIN_LENGTH = 8
+
+var ForgotPasswordView = func(c *kamux.Context) {
+	c.Html("auth/forgot_password.html", nil)
+}
+
+var ForgotPasswordPOSTView = func(c *kamux.Context) {
+	data := c.BodyJson()
+	email, _ := data["email"].(string)
+	email = strings.TrimSpace(email)
+	if email == "" {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "email is required",
+		})
+		return
+	}
+	user, err := orm.Model[models.User]().Where("email = ?", email).One()
+	if err == nil {
+		var base string
+		base, err = baseUrl(c)
+		if err == nil {
+			err = SendResetPasswordEmail(base, user)
+		}
+		logger.CheckError(err)
+	}
+	// same response if the user exist or not
+	c.Json(map[string]any{
+		"success": "if an account exist for this email, a reset link has been sent",
+	})
+}
+
+var ResetPasswordView = func(c *kamux.Context) {
+	token := c.QueryParam("token")
+	_, _, err := CheckToken(PURPOSE_RESET_PASSWORD, token)
+	c.Html("auth/reset_password.html", map[string]any{
+		"token": token,
+		"valid": err == nil,
+	})
+}
+
+var ResetPasswordPOSTView = func(c *kamux.Context) {
+	data := c.BodyJson()
+	token, _ := data["token"].(string)
+	password, _ := data["password"].(string)
+	user, _, err := CheckToken(PURPOSE_RESET_PASSWORD, token)
+	if err != nil {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := SetPassword(user, password); err != nil {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "password changed, you can login with your new password",
+	})
+}
+
+var VerifyEmailView = func(c *kamux.Context) {
+	user, _, err := CheckToken(PURPOSE_VERIFY_EMAIL, c.QueryParam("token"))
+	if err == nil {
+		_, err = orm.Table("users").Where("id = ?", user.Id).Set("email_verified = ?", 1)
+		logger.CheckError(err)
+	}
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+	}
+	c.Html("auth/verify_email.html", map[string]any{
+		"success": err == nil,
+		"email":   user.Email,
+	})
+}
+
+var SendVerificationPOSTView = func(c *kamux.Context) {
+	user, ok := c.User()
+	if !ok {
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": "you need to be logged in",
+		})
+		return
+	}
+	if user.EmailVerified {
+		c.Json(map[string]any{
+			"success": "email already verified",
+		})
+		return
+	}
+	base, err := baseUrl(c)
+	if err == nil {
+		err = SendVerificationEmail(base, user)
+	}
+	if err != nil {
+		logger.Error(err)
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to send email",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "verification email sent to " + user.Email,
+	})
+}
+
+var ChangeEmailView = func(c *kamux.Context) {
+	if _, ok := c.User(); !ok {
+		c.Status(http.StatusTemporaryRedirect).Redirect("/admin/login")
+		return
+	}
+	c.Html("auth/change_email.html", nil)
+}
+
+var ChangeEmailPOSTView = func(c *kamux.Context) {
+	user, ok := c.User()
+	if !ok {
+		c.Status(http.StatusUnauthorized).Json(map[string]any{
+			"error": "you need to be logged in",
+		})
+		return
+	}
+	data := c.BodyJson()
+	email, _ := data["email"].(string)
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") || strings.EqualFold(email, user.Email) {
+		c.Status(http.StatusBadRequest).Json(map[string]any{
+			"error": "invalid email",
+		})
+		return
+	}
+	if err := checkEmailFree(email); err != nil {
+		if errors.Is(err, ErrEmailUsed) {
+			c.Status(http.StatusBadRequest).Json(map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		logger.Error(err)
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to check email",
+		})
+		return
+	}
+	base, err := baseUrl(c)
+	var token string
+	if err == nil {
+		token, err = MakeToken(PURPOSE_CHANGE_EMAIL, user, email, CHANGE_EMAIL_TTL)
+	}
+	if err == nil {
+		err = sendEmail(email, "Confirm your new email", "change_email.html", map[string]any{
+			"Link":  base + "/auth/email/change/confirm?token=" + url.QueryEscape(token),
+			"Email": email,
+			"Ttl":   CHANGE_EMAIL_TTL.String(),
+		})
+	}
+	if logger.CheckError(err) {
+		c.Status(http.StatusInternalServerError).Json(map[string]any{
+			"error": "unable to send email",
+		})
+		return
+	}
+	c.Json(map[string]any{
+		"success": "a confirmation link has been sent to " + email,
+	})
+}
+
+var ConfirmChangeEmailView = func(c *kamux.Context) {
+	user, email, err := CheckToken(PURPOSE_CHANGE_EMAIL, c.QueryParam("token"))
+	if err == nil {
+		// the email may have been taken since the link was sent
+		err = checkEmailFree(email)
+	}
+	if err == nil {
+		_, err = orm.Table("users").Where("id = ?", user.Id).Set("email = ?, email_verified = ?", email, 1)
+		if !logger.CheckError(err) {
+			// let the old address know, in case it was not the owner
+			err := sendEmail(user.Email, "Your email has been changed", "email_changed.html", map[string]any{
+				"Email": email,
+			})
+			logger.CheckError(err)
+		}
+	}
+	used := errors.Is(err, ErrEmailUsed)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+	}
+	c.Html("auth/verify_email.html", map[string]any{
+		"success": err == nil,
+		"email":   email,
+		"used":    used,
+	})
+}
+
+// SendResetPasswordEmail send a reset password link to user, valid RESET_PASSWORD_TTL
+func SendResetPasswordEmail(baseUrl string, user models.User) error {
+	token, err := MakeToken(PURPOSE_RESET_PASSWORD, user, "", RESET_PASSWORD_TTL)
+	if err != nil {
+		return err
+	}
+	return sendEmail(user.Email, "Reset your password", "reset_password.html", map[string]any{
+		"Link":  baseUrl + "/auth/password/reset?token=" + url.QueryEscape(token),
+		"Email": user.Email,
+		"Ttl":   RESET_PASSWORD_TTL.String(),
+	})
+}
+
+// SendVerificationEmail send an email verification link to user, valid VERIFY_EMAIL_TTL
+func SendVerificationEmail(baseUrl string, user models.User) error {
+	token, err := MakeToken(PURPOSE_VERIFY_EMAIL, user, "", VERIFY_EMAIL_TTL)
+	if err != nil {
+		return err
+	}
+	return sendEmail(user.Email, "Verify your email", "verify_email.html", map[string]any{
+		"Link":  baseUrl + "/auth/email/verify?token=" + url.QueryEscape(token),
+		"Email": user.Email,
+		"Ttl":   VERIFY_EMAIL_TTL.String(),
+	})
+}
+
+// SetPassword hash and set the new password, the user uuid is rotated so all sessions and tokens already sent are invalidated
+func SetPassword(user models.User, password string) error {
+	if len(password) < PASSWORD_MIN_LENGTH {
+		return errors.New("password too short")
+	}
+	hashed, err := hash.GenerateHash(password)
+	if err != nil {
+		return err
+	}
+	uuid, err := utils.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	_, err = orm.Table("users").Where("id = ?", user.Id).Set("password = ?, uuid = ?", hashed, uuid)
+	return err
+}
+
+// checkEmailFree return ErrEmailUsed if email belong to a user, or the error of the query
+func checkEmailFree(email string) error {
+	n, err := orm.Table("users").Where("lower(email) = ?", strings.ToLower(email)).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrEmailUsed
+	}
+	return nil
+}
+
+func sendEmail(to, subject, templateName string, data map[string]any) error {
+	var buff bytes.Buffer
+	if err := emails.ExecuteTemplate(&buff, templateName, data); err != nil {
+		return err
+	}
+	return mailer.Send(subject, buff.String(), to)
+}
+
+// baseUrl return BASE_URL, or the base url of the request if its host is trusted, so a forged Host header cannot put links to another site in emails
+func baseUrl(c *kamux.Context) (string, error) {
+	if BASE_URL != "" {
+		return strings.TrimSuffix(BASE_URL, "/"), nil
+	}
+	host := proxy.Host(c.Request)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	trusted := []string{settings.Config.Host}
+	if settings.Config.Domains != "" {
+		trusted = append(trusted, strings.Split(settings.Config.Domains, ",")...)
+	}
+	for _, t := range trusted {
+		if t = strings.TrimSpace(t); t != "" && strings.EqualFold(t, host) {
+			return c.BaseURL(), nil
+		}
+	}
+	return "", ErrUntrustedHost
+}
@@ -0,0 +1,73 @@
+package kamux
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/acme/autocert"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+)
+
+// ACMEDirectory is the ACME server used to generate certificates, letsencrypt staging or a private CA can be used
+var ACMEDirectory = autocert.DefaultACMEDirectory
+
+// DbCertCache is an autocert.Cache storing certificates and account keys in the table autocert_cache,
+// data is encrypted with settings.Secret, instances sharing the database and the SECRET (or the secret file) share certificates
+type DbCertCache struct {
+	// Database is the name of the database, the default one if empty
+	Database string
+}
+
+var _ autocert.Cache = DbCertCache{}
+
+// Get return autocert.ErrCacheMiss if name is not found, not cached by the orm, another instance may have changed it
+func (d DbCertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	rows, err := orm.Query(d.Database, "select data from autocert_cache where name = ?", name)
+	if err != nil || len(rows) == 0 {
+		return nil, autocert.ErrCacheMiss
+	}
+	data, _ := rows[0]["data"].(string)
+	decrypted, err := encryptor.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(decrypted), nil
+}
+
+func (d DbCertCache) Put(ctx context.Context, name string, data []byte) error {
+	if encryptor.Secret() == "" {
+		return errors.New("autocert cache: set SECRET to store certificates in the database")
+	}
+	encrypted, err := encryptor.Encrypt(string(data))
+	if err != nil {
+		return err
+	}
+	n, err := orm.Table("autocert_cache").Database(d.Database).Context(ctx).Where("name = ?", name).Set("data = ?", encrypted)
+	if err == nil && n > 0 {
+		return nil
+	}
+	_, err = orm.Table("autocert_cache").Database(d.Database).Context(ctx).Insert("name,data", []any{name, encrypted})
+	if err != nil {
+		// inserted by another instance in the meantime
+		_, err = orm.Table("autocert_cache").Database(d.Database).Context(ctx).Where("name = ?", name).Set("data = ?", encrypted)
+	}
+	return err
+}
+
+func (d DbCertCache) Delete(ctx context.Context, name string) error {
+	_, err := orm.Table("autocert_cache").Database(d.Database).Context(ctx).Where("name = ?", name).Delete()
+	return err
+}
+
+func certCache() autocert.Cache {
+	switch settings.Config.CertsCache {
+	case "db":
+		return DbCertCache{}
+	case "":
+		return autocert.DirCache("certs")
+	default:
+		return autocert.DirCache(settings.Config.CertsCache)
+	}
+}
@@ -0,0 +1,176 @@
+package kamux
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// CertsReloadInterval is how often certificate files are checked for changes
+var CertsReloadInterval = 30 * time.Second
+
+// CertReloader serve certificates loaded from files to tls.Config.GetCertificate, pairs are selected by SNI,
+// files are reloaded when they change or on SIGHUP, the last good certificate is kept if a reload fail
+type CertReloader struct {
+	mu     sync.RWMutex
+	pairs  []*certPair
+	byName map[string]*tls.Certificate
+}
+
+type certPair struct {
+	certFile, keyFile string
+	cert              *tls.Certificate
+	stamp             string
+}
+
+// AddCertificate serve the certificate pair over TLS, it is reloaded when files change, CERT and KEY are added by Run
+func (router *Router) AddCertificate(certFile, keyFile string) error {
+	if router.certReloader == nil {
+		router.certReloader = NewCertReloader()
+	}
+	return router.certReloader.Add(certFile, keyFile)
+}
+
+func NewCertReloader() *CertReloader {
+	return &CertReloader{byName: map[string]*tls.Certificate{}}
+}
+
+// Add load a certificate pair, the first one added is used for clients without SNI or with an unknown name
+func (cr *CertReloader) Add(certFile, keyFile string) error {
+	p := &certPair{certFile: certFile, keyFile: keyFile}
+	if err := p.load(); err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	cr.pairs = append(cr.pairs, p)
+	cr.index()
+	cr.mu.Unlock()
+	return nil
+}
+
+// Reload reload changed pairs, or all pairs if force, errors are logged and the previous certificate is kept
+func (cr *CertReloader) Reload(force bool) {
+	cr.mu.RLock()
+	pairs := append([]*certPair{}, cr.pairs...)
+	cr.mu.RUnlock()
+	changed := false
+	for _, p := range pairs {
+		cr.mu.RLock()
+		stamp := p.stamp
+		cr.mu.RUnlock()
+		if !force && stamp == fileStamp(p.certFile, p.keyFile) {
+			continue
+		}
+		next := &certPair{certFile: p.certFile, keyFile: p.keyFile}
+		if err := next.load(); err != nil {
+			logger.Error("unable to reload certificate", p.certFile, ":", err)
+			continue
+		}
+		cr.mu.Lock()
+		p.cert, p.stamp = next.cert, next.stamp
+		cr.mu.Unlock()
+		changed = true
+		logger.Printfs("grCertificate %s reloaded", p.certFile)
+	}
+	if changed {
+		cr.mu.Lock()
+		cr.index()
+		cr.mu.Unlock()
+	}
+}
+
+// Watch reload certificates every CertsReloadInterval if files changed, and on SIGHUP, until stop is closed
+func (cr *CertReloader) Watch(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(CertsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			cr.Reload(true)
+		case <-ticker.C:
+			cr.Reload(false)
+		}
+	}
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (cr *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	if len(cr.pairs) == 0 {
+		return nil, errors.New("no certificate loaded")
+	}
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := cr.byName[name]; ok {
+		return cert, nil
+	}
+	// wildcard certificates match one label
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := cr.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return cr.pairs[0].cert, nil
+}
+
+// index map every name of the certificates to its pair, first pairs win, cr.mu must be held
+func (cr *CertReloader) index() {
+	cr.byName = map[string]*tls.Certificate{}
+	for _, p := range cr.pairs {
+		leaf := p.cert.Leaf
+		names := append([]string{}, leaf.DNSNames...)
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = append(names, leaf.Subject.CommonName)
+		}
+		for _, ip := range leaf.IPAddresses {
+			names = append(names, ip.String())
+		}
+		for _, n := range names {
+			n = strings.ToLower(n)
+			if _, ok := cr.byName[n]; !ok {
+				cr.byName[n] = p.cert
+			}
+		}
+	}
+}
+
+func (p *certPair) load() error {
+	stamp := fileStamp(p.certFile, p.keyFile)
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	p.cert, p.stamp = &cert, stamp
+	return nil
+}
+
+// fileStamp change when one of the files is modified or replaced
+func fileStamp(files ...string) string {
+	stamp := ""
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			stamp += fmt.Sprintf("%d-%d;", fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			stamp += "-;"
+		}
+	}
+	return stamp
+}
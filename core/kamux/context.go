@@ -13,8 +13,11 @@ import (
 	"strings"
 
 	"github.com/kamalshkeir/kago/core/admin/models"
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/geoip"
+	"github.com/kamalshkeir/kago/core/utils/i18n"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 )
 
@@ -114,11 +117,23 @@ func (c *Context) User() (models.User,bool) {
 // Html return template_name with data to the client
 func (c *Context) Html(template_name string, data map[string]any) {
 	var buff bytes.Buffer
+	err := views.execute(&buff, template_name, c.templateData(data))
+	if logger.CheckError(err) {
+		c.status = http.StatusInternalServerError
+		http.Error(c.ResponseWriter, "could not render "+template_name, c.status)
+		return
+	}
+	c.writeHtml(&buff)
+}
+
+// templateData add Request, Logs, Lang, IsAuthenticated and User to data
+func (c *Context) templateData(data map[string]any) map[string]any {
 	if data == nil {
 		data = make(map[string]any)
 	}
 	data["Request"] = c.Request
 	data["Logs"] = settings.Config.Logs
+	data["Lang"] = c.Lang()
 	user, ok := c.User()
 	if ok {
 		data["IsAuthenticated"] = true
@@ -127,21 +142,17 @@ func (c *Context) Html(template_name string, data map[string]any) {
 		data["IsAuthenticated"] = false
 		data["User"] = nil
 	}
+	return data
+}
 
-	err := allTemplates.ExecuteTemplate(&buff, template_name, data)
-	if logger.CheckError(err) {
-		c.status = http.StatusInternalServerError
-		http.Error(c.ResponseWriter, "could not render "+template_name, c.status)
-		return
-	}
-
+func (c *Context) writeHtml(buff *bytes.Buffer) {
 	c.SetHeader("Content-Type", "text/html; charset=utf-8")
 	if c.status == 0 {
 		c.status = 200
 	}
 	c.WriteHeader(c.status)
 
-	_, err = buff.WriteTo(c.ResponseWriter)
+	_, err := buff.WriteTo(c.ResponseWriter)
 	logger.CheckError(err)
 }
 
@@ -152,10 +163,20 @@ func (c *Context) StreamResponse(response string) error {
 	b.WriteString("data: ")
 	b.WriteString(response)
 	b.WriteString("\n\n")
+	if conn, ok := sseConnOf(c); ok {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		if conn.closed {
+			return ErrShuttingDown
+		}
+	}
 	_, err := c.ResponseWriter.Write([]byte(b.String()))
 	if err != nil {
 		return err
 	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 	return nil
 }
 
@@ -344,28 +365,51 @@ func (c *Context) Download(data_bytes []byte, asFilename string) {
 	io.Copy(c.ResponseWriter, bytesReader)
 }
 
-// EnableTranslations get user ip, then location country using nmap, so don't use it if u don't have it install, and then it parse csv file to find the language spoken in this country, to finaly set cookie 'lang' to 'en' or 'fr'...
+// EnableTranslations set the 'lang' cookie to the language resolved by Lang, so next requests keep it,
+// if the request ask no available language and a geoip database is loaded, the language of the user country is used
 func (c *Context) EnableTranslations() {
-	ip := c.GetUserIP()
-	if utils.StringContains(ip, "127.0.0.1", "localhost", "") {
-		c.SetCookie("lang", "en")
-		return
-	}
-	country := utils.GetIpCountry(ip)
-	if country != "" {
-		if v, ok := mCountryLanguage.Get(country); ok {
-			c.SetCookie("lang", v)
+	lang, ok := i18n.Requested(c.Request)
+	if !ok {
+		lang = i18n.Default()
+		if geoip.Loaded() {
+			if l, found := i18n.FromCountry(geoip.Country(c.GetUserIP())); found {
+				lang = l
+			}
 		}
 	}
+	if v, err := c.GetCookie(i18n.Cookie); err != nil || v != lang {
+		c.SetCookie(i18n.Cookie, lang)
+	}
+}
+
+// Lang return the language of the request from the 'lang' query param, the 'lang' cookie,
+// the Accept-Language header, or settings.Config.DefaultLanguage
+func (c *Context) Lang() string {
+	return i18n.FromRequest(c.Request)
+}
+
+// T translate key in the language of the request, args are name value pairs or a map replacing {name},
+// 'count' choose the plural form
+func (c *Context) T(key string, args ...any) string {
+	return i18n.T(c.Lang(), key, args...)
 }
 
+// GeoIP return the country, continent and ASN of the user ip from the databases set by GEOIP_FILE and GEOIP_ASN_FILE
+func (c *Context) GeoIP() (geoip.Record, error) {
+	return geoip.Lookup(c.GetUserIP())
+}
+
+// GetUserIP return the client ip, forwarded headers are used only when sent by TRUSTED_PROXIES
 func (c *Context) GetUserIP() string {
-	IPAddress := c.Request.Header.Get("X-Real-Ip")
-	if IPAddress == "" {
-		IPAddress = c.Request.Header.Get("X-Forwarded-For")
-	}
-	if IPAddress == "" {
-		IPAddress = c.Request.RemoteAddr
-	}
-	return IPAddress
+	return proxy.ClientIP(c.Request)
+}
+
+// Scheme return the scheme used by the client, 'https' or 'http', X-Forwarded-Proto is used only when sent by TRUSTED_PROXIES
+func (c *Context) Scheme() string {
+	return proxy.Scheme(c.Request)
+}
+
+// BaseURL return the scheme and host used by the client, like 'https://example.com'
+func (c *Context) BaseURL() string {
+	return proxy.Scheme(c.Request) + "://" + proxy.Host(c.Request)
 }
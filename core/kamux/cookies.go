@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
 	"github.com/kamalshkeir/kago/core/settings"
 )
 
@@ -25,7 +26,7 @@ func init() {
 // SetCookie set cookie given key and value
 func (c *Context) SetCookie(key, value string) {
 	if !COOKIES_Secure {
-		if c.Request.TLS != nil {
+		if proxy.IsSecure(c.Request) {
 			COOKIES_Secure=true
 		}
 	}
@@ -0,0 +1,60 @@
+package geoblock
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
+	"github.com/kamalshkeir/kago/core/utils/geoip"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// BLOCKED_COUNTRIES are iso codes of countries refused, ALLOWED_COUNTRIES if not empty are the only countries accepted
+var BLOCKED_COUNTRIES = []string{}
+var ALLOWED_COUNTRIES = []string{}
+
+// BLOCK_UNKNOWN refuse ips not found in the geoip database
+var BLOCK_UNKNOWN = false
+
+var warnOnce sync.Once
+
+// GEOBLOCK refuse requests from BLOCKED_COUNTRIES or outside ALLOWED_COUNTRIES using the geoip database, requests pass if no database is loaded
+var GEOBLOCK = func(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !geoip.Loaded() {
+			warnOnce.Do(func() {
+				logger.Warn("GEOBLOCK middleware used without geoip database, set GEOIP_FILE")
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !Allowed(geoip.Country(proxy.ClientIP(r))) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<h1>ACCESS FROM YOUR COUNTRY IS NOT ALLOWED</h1>"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed return true if country is accepted by BLOCKED_COUNTRIES, ALLOWED_COUNTRIES and BLOCK_UNKNOWN
+func Allowed(country string) bool {
+	if country == "" {
+		return !BLOCK_UNKNOWN
+	}
+	for _, c := range BLOCKED_COUNTRIES {
+		if strings.EqualFold(c, country) {
+			return false
+		}
+	}
+	if len(ALLOWED_COUNTRIES) == 0 {
+		return true
+	}
+	for _, c := range ALLOWED_COUNTRIES {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package kamux
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// IsHtmx return true if the request is sent by htmx
+func (c *Context) IsHtmx() bool {
+	return c.Request.Header.Get("HX-Request") == "true"
+}
+
+// HtmxTarget return the id of the target element of the htmx request, empty if not set
+func (c *Context) HtmxTarget() string {
+	return c.Request.Header.Get("HX-Target")
+}
+
+// HtmlBlock render only block of template_name, a block defined or overridden by the page,
+// so the same template serve the full page and the fragment updated by htmx
+func (c *Context) HtmlBlock(template_name, block string, data map[string]any) {
+	var buff bytes.Buffer
+	err := views.executeBlock(&buff, template_name, block, c.templateData(data))
+	if logger.CheckError(err) {
+		c.status = http.StatusInternalServerError
+		http.Error(c.ResponseWriter, "could not render "+block+" of "+template_name, c.status)
+		return
+	}
+	c.writeHtml(&buff)
+}
+
+// HtmlBlocks render many blocks of template_name in one response, the first block is swapped into the target,
+// the others are out-of-band swaps replacing the content of the elements having the block name as id
+//
+//	c.HtmlBlocks("cart.html", data, "cart_items", "cart_count") // <span id="cart_count">{{block "cart_count" .}}...
+func (c *Context) HtmlBlocks(template_name string, data map[string]any, blocks ...string) {
+	var buff bytes.Buffer
+	data = c.templateData(data)
+	for i, block := range blocks {
+		if i > 0 {
+			buff.WriteString(`<div id="` + template.HTMLEscapeString(block) + `" hx-swap-oob="innerHTML">`)
+		}
+		err := views.executeBlock(&buff, template_name, block, data)
+		if logger.CheckError(err) {
+			c.status = http.StatusInternalServerError
+			http.Error(c.ResponseWriter, "could not render "+block+" of "+template_name, c.status)
+			return
+		}
+		if i > 0 {
+			buff.WriteString(`</div>`)
+		}
+	}
+	c.writeHtml(&buff)
+}
+
+// HxRedirect make htmx load url with a full page reload, requests not sent by htmx are redirected
+func (c *Context) HxRedirect(url string) {
+	if !c.IsHtmx() {
+		if c.status == 0 {
+			c.status = http.StatusSeeOther
+		}
+		c.Redirect(url)
+		return
+	}
+	c.SetHeader("HX-Redirect", url)
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.WriteHeader(c.status)
+}
+
+// HxTrigger trigger a client side event when the response is received, detail is optional and sent as json,
+// it can be called many times before writing the response
+func (c *Context) HxTrigger(event string, detail ...any) *Context {
+	events := map[string]any{}
+	if prev := c.ResponseWriter.Header().Get("HX-Trigger"); prev != "" {
+		if err := json.Unmarshal([]byte(prev), &events); err != nil {
+			for _, e := range strings.Split(prev, ",") {
+				events[strings.TrimSpace(e)] = nil
+			}
+		}
+	}
+	var d any
+	if len(detail) > 0 {
+		d = detail[0]
+	}
+	events[event] = d
+	b, err := json.Marshal(events)
+	if logger.CheckError(err) {
+		return c
+	}
+	c.SetHeader("HX-Trigger", string(b))
+	return c
+}
+
+// HxRetarget swap the response into the element matching selector instead of the request target
+func (c *Context) HxRetarget(selector string) *Context {
+	c.SetHeader("HX-Retarget", selector)
+	return c
+}
+
+// HxReswap change how the response is swapped, like 'outerHTML' or 'beforeend'
+func (c *Context) HxReswap(swap string) *Context {
+	c.SetHeader("HX-Reswap", swap)
+	return c
+}
@@ -6,10 +6,13 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
 	"github.com/kamalshkeir/kago/core/orm"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/shell"
-	"github.com/kamalshkeir/kago/core/utils/envloader"
+	"github.com/kamalshkeir/kago/core/utils/acme/autocert"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kago/core/utils/geoip"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 	"golang.org/x/net/websocket"
 )
@@ -47,6 +50,10 @@ type Router struct {
 	Routes       map[int][]Route
 	DefaultRoute Handler
 	Server       *http.Server
+	shutdown     *shutdownState
+	listeners    []*listener
+	certManager  *autocert.Manager
+	certReloader *CertReloader
 }
 
 // Route
@@ -71,16 +78,9 @@ func New() *Router {
 	// load translations
 	go LoadTranslations()
 
-	// load Envs and Init Settings Config
-	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
-		app.LoadEnv(".env")
-	} else {
-		err := envloader.FillStruct(settings.Config)
-		logger.CheckError(err)
-	}
-
-	// after load env to override struct values
-	getTagsAndPrint()
+	// load Envs and Init Settings Config from defaults, config files, env and flags
+	mustLoadConfig()
+	printServerInfo()
 
 	// Init DB
 	err := orm.InitDB()
@@ -100,6 +100,30 @@ func New() *Router {
 	return app
 }
 
+// mustLoadConfig load settings.Config using '.env' if it exist, the secret, the trusted proxies and the geoip databases, every invalid or missing value is printed before exiting
+func mustLoadConfig() {
+	envFiles := []string{}
+	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
+		envFiles = append(envFiles, ".env")
+	}
+	if err := loadConfig(envFiles...); err != nil {
+		logger.Error(err)
+		os.Exit(1)
+	}
+	if err := encryptor.LoadSecret(); err != nil {
+		logger.Error("unable to load the secret:", err)
+		os.Exit(1)
+	}
+	if err := proxy.Trust(settings.Config.TrustedProxies...); err != nil {
+		logger.Error(err)
+		os.Exit(1)
+	}
+	if err := geoip.Load(settings.Config.GeoIPFile, settings.Config.GeoIPASNFile); err != nil {
+		logger.Error("unable to load the geoip database:", err)
+		os.Exit(1)
+	}
+}
+
 func BareBone() *Router {
 	app := &Router{
 		Routes: map[int][]Route{},
@@ -110,12 +134,9 @@ func BareBone() *Router {
 	settings.MODE = "barebone"
 	// load translations
 	go LoadTranslations()
-	// load Envs and Init Settings Config
-	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
-		app.LoadEnv(".env")
-	}
-	// after load env to override struct values
-	getTagsAndPrint()
+	// load Envs and Init Settings Config from defaults, config files, env and flags
+	mustLoadConfig()
+	printServerInfo()
 	return app
 }
 
@@ -0,0 +1,257 @@
+package kamux
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// LayoutsDir and PartialsDir are folders of template directories, their templates are available to every page,
+// a page use a layout with {{template "layouts/base.html" .}} and override its {{block}} using {{define}}
+var (
+	LayoutsDir  = "layouts"
+	PartialsDir = "partials"
+)
+
+// TemplatesReloadCheck is how often template files are checked for changes in dev mode
+var TemplatesReloadCheck = 500 * time.Millisecond
+
+// views hold templates of every added directory, each page is parsed in its own set,
+// so pages can define the same block names without overriding each other
+var views = &viewEngine{}
+
+type viewEngine struct {
+	mu        sync.RWMutex
+	sources   []templateSource
+	shared    *template.Template
+	pages     map[string]*template.Template
+	stamp     string
+	checkedAt time.Time
+}
+
+type templateSource struct {
+	fsys  fs.FS
+	root  string
+	local bool
+}
+
+type templateFile struct {
+	name    string
+	content string
+}
+
+// add a templates directory and parse all templates again
+func (v *viewEngine) add(src templateSource) error {
+	if _, err := fs.Stat(src.fsys, src.root); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sources = append(v.sources, src)
+	return v.build()
+}
+
+// build parse every source, previous templates are kept on error, v.mu must be held
+func (v *viewEngine) build() error {
+	pages, common := []templateFile{}, []templateFile{}
+	stamp := strings.Builder{}
+	for _, src := range v.sources {
+		if _, err := fs.Stat(src.fsys, src.root); errors.Is(err, fs.ErrNotExist) {
+			// removed directory
+			continue
+		}
+		err := fs.WalkDir(src.fsys, src.root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(p, ".html") {
+				return nil
+			}
+			b, err := fs.ReadFile(src.fsys, p)
+			if err != nil {
+				return err
+			}
+			if src.local {
+				if fi, err := d.Info(); err == nil {
+					fmt.Fprintf(&stamp, "%s:%d:%d;", p, fi.ModTime().UnixNano(), fi.Size())
+				}
+			}
+			name := p
+			if src.root != "." {
+				name = strings.TrimPrefix(p, src.root+"/")
+			}
+			f := templateFile{name: name, content: string(b)}
+			if first, _, _ := strings.Cut(name, "/"); first == LayoutsDir || first == PartialsDir {
+				common = append(common, f)
+			} else {
+				pages = append(pages, f)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// layouts and partials are parsed last, so their blocks are the defaults of every page
+	shared := template.New("").Funcs(functions)
+	for _, f := range append(append([]templateFile{}, pages...), common...) {
+		if _, err := shared.New(f.name).Parse(f.content); err != nil {
+			return err
+		}
+	}
+	sets := make(map[string]*template.Template, len(pages))
+	for _, f := range pages {
+		set, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := set.New(f.name).Parse(f.content); err != nil {
+			return err
+		}
+		sets[f.name] = set
+	}
+	v.shared, v.pages, v.stamp = shared, sets, stamp.String()
+	return nil
+}
+
+// reloadIfChanged parse templates again if a local file changed, it is checked at most every TemplatesReloadCheck
+func (v *viewEngine) reloadIfChanged() {
+	v.mu.RLock()
+	recent := time.Since(v.checkedAt) < TemplatesReloadCheck
+	v.mu.RUnlock()
+	if recent {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if time.Since(v.checkedAt) < TemplatesReloadCheck {
+		return
+	}
+	v.checkedAt = time.Now()
+	stamp := strings.Builder{}
+	for _, src := range v.sources {
+		if !src.local {
+			continue
+		}
+		_ = fs.WalkDir(src.fsys, src.root, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(p, ".html") {
+				if fi, err := d.Info(); err == nil {
+					fmt.Fprintf(&stamp, "%s:%d:%d;", p, fi.ModTime().UnixNano(), fi.Size())
+				}
+			}
+			return nil
+		})
+	}
+	if stamp.String() == v.stamp {
+		return
+	}
+	if err := v.build(); err != nil {
+		logger.Error("templates not reloaded:", err)
+		// retry only when files change again
+		v.stamp = stamp.String()
+		return
+	}
+	logger.Printfs("grTemplates reloaded")
+}
+
+// lookup return the set where name is executed, the page set if name is a page
+func (v *viewEngine) lookup(name string) (*template.Template, error) {
+	if settings.Config.Dev {
+		v.reloadIfChanged()
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if set, ok := v.pages[name]; ok {
+		return set, nil
+	}
+	if v.shared != nil && v.shared.Lookup(name) != nil {
+		return v.shared, nil
+	}
+	return nil, fmt.Errorf("template %s not found", name)
+}
+
+// execute the template name of the page set, or of the shared set if it is not a page
+func (v *viewEngine) execute(w io.Writer, name string, data any) error {
+	set, err := v.lookup(name)
+	if err != nil {
+		return err
+	}
+	return set.ExecuteTemplate(w, name, data)
+}
+
+// executeBlock execute a block defined or overridden by the page name
+func (v *viewEngine) executeBlock(w io.Writer, name, block string, data any) error {
+	set, err := v.lookup(name)
+	if err != nil {
+		return err
+	}
+	if set.Lookup(block) == nil {
+		return fmt.Errorf("block %s not found in %s", block, name)
+	}
+	return set.ExecuteTemplate(w, block, data)
+}
+
+// partial render a template of the shared set with args, a single arg is passed as is,
+// pairs of args are passed as a map, name can omit the partials folder and the .html extension
+func (v *viewEngine) partial(name string, args ...any) (template.HTML, error) {
+	var data any
+	switch {
+	case len(args) == 1:
+		data = args[0]
+	case len(args) > 1:
+		m, err := dict(args...)
+		if err != nil {
+			return "", err
+		}
+		data = m
+	}
+	v.mu.RLock()
+	shared := v.shared
+	v.mu.RUnlock()
+	if shared == nil {
+		return "", errors.New("no templates loaded")
+	}
+	for _, n := range []string{name, path.Join(PartialsDir, name), path.Join(PartialsDir, name+".html"), name + ".html"} {
+		if shared.Lookup(n) != nil {
+			var buff bytes.Buffer
+			if err := shared.ExecuteTemplate(&buff, n, data); err != nil {
+				return "", err
+			}
+			return template.HTML(buff.String()), nil
+		}
+	}
+	return "", fmt.Errorf("partial %s not found", name)
+}
+
+// dict build a map from key value pairs, usage: {{template "card" dict "title" .Title "count" 3}}
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict expect key value pairs")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[k] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// localSource use os.DirFS so local and embeded directories are walked the same way
+func localSource(dir string) templateSource {
+	return templateSource{fsys: os.DirFS(dir), root: ".", local: true}
+}
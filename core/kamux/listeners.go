@@ -0,0 +1,197 @@
+package kamux
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/acme/autocert"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	listenerUnix = iota
+	listenerRedirect
+)
+
+// listener is an extra server started by Run next to the main one, they share the same shutdown
+type listener struct {
+	kind   int
+	addr   string
+	server *http.Server
+}
+
+// ListenRedirect add a plain HTTP listener on addr (ex: ':80'), it answer ACME HTTP-01 challenges when certificates are
+// generated automatically and redirect every other request to https
+func (router *Router) ListenRedirect(addr string) {
+	router.listeners = append(router.listeners, &listener{kind: listenerRedirect, addr: addr})
+}
+
+// ListenUnix serve the app on the unix domain socket at path too, for a reverse proxy on the same host,
+// a stale socket file is replaced at start and the file is removed on shutdown
+func (router *Router) ListenUnix(path string) {
+	router.listeners = append(router.listeners, &listener{kind: listenerUnix, addr: path})
+}
+
+// handler return the router wrapped by global middlewares
+func (router *Router) handler() http.Handler {
+	var handler http.Handler = router
+	for _, midw := range midwrs {
+		handler = midw(handler)
+	}
+	return handler
+}
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  ReadTimeout,
+		WriteTimeout: WriteTimeout,
+		IdleTimeout:  IdleTimeout,
+	}
+}
+
+// withH2C accept cleartext HTTP/2 on a server without TLS if H2C is enabled, h2c connections are hijacked,
+// ConfigureServer make Shutdown send them a GOAWAY
+func withH2C(server *http.Server) {
+	if !settings.Config.H2C {
+		return
+	}
+	h2s := &http2.Server{IdleTimeout: IdleTimeout}
+	if logger.CheckError(http2.ConfigureServer(server, h2s)) {
+		return
+	}
+	server.Handler = h2c.NewHandler(server.Handler, h2s)
+}
+
+// redirectHandler redirect to https on the same host, m answer ACME HTTP-01 challenges if not nil
+func redirectHandler(m *autocert.Manager) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port := settings.Config.Port; port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if m != nil {
+		return m.HTTPHandler(handler)
+	}
+	return handler
+}
+
+// serve start the main server and every listener, it return the first error, http.ErrServerClosed after Shutdown
+func (router *Router) serve(useTls bool) error {
+	lns := make([]net.Listener, 0, len(router.listeners)+1)
+	closeAll := func() {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}
+	ln, err := net.Listen("tcp", router.Server.Addr)
+	if err != nil {
+		return err
+	}
+	lns = append(lns, ln)
+
+	st := router.state()
+	st.mu.Lock()
+	if st.stopping.Load() {
+		// Shutdown already collected the servers to stop
+		st.mu.Unlock()
+		closeAll()
+		return http.ErrServerClosed
+	}
+	for _, l := range router.listeners {
+		network := "tcp"
+		switch l.kind {
+		case listenerUnix:
+			network = "unix"
+			l.server = newServer(l.addr, router.handler())
+			withH2C(l.server)
+			removeStaleSocket(l.addr)
+		case listenerRedirect:
+			l.server = newServer(l.addr, redirectHandler(router.certManager))
+		}
+		ln, err := net.Listen(network, l.addr)
+		if err != nil {
+			st.mu.Unlock()
+			closeAll()
+			return err
+		}
+		lns = append(lns, ln)
+	}
+	st.mu.Unlock()
+
+	errs := make(chan error, len(lns))
+	go func() {
+		if useTls {
+			// certificates are given by TLSConfig.GetCertificate
+			errs <- router.Server.ServeTLS(lns[0], "", "")
+		} else {
+			errs <- router.Server.Serve(lns[0])
+		}
+	}()
+	for i, l := range router.listeners {
+		go func(server *http.Server, ln net.Listener) {
+			errs <- server.Serve(ln)
+		}(l.server, lns[i+1])
+		logger.Printfs("grListening on %s %s", lns[i+1].Addr().Network(), l.addr)
+	}
+	return <-errs
+}
+
+// shutdownServers shutdown the main server and listeners together, servers not drained before ctx expire are closed
+func (router *Router) shutdownServers(ctx context.Context) error {
+	st := router.state()
+	st.mu.Lock()
+	servers := []*http.Server{}
+	if router.Server != nil {
+		servers = append(servers, router.Server)
+	}
+	for _, l := range router.listeners {
+		if l.server != nil {
+			servers = append(servers, l.server)
+		}
+	}
+	st.mu.Unlock()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server *http.Server) {
+			defer wg.Done()
+			server.SetKeepAlivesEnabled(false)
+			if err := server.Shutdown(ctx); err != nil {
+				errs[i] = err
+				logger.CheckError(server.Close())
+			}
+		}(i, server)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeStaleSocket(path string) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		logger.CheckError(os.Remove(path))
+	}
+}
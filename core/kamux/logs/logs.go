@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
 	"github.com/kamalshkeir/kago/core/utils/eventbus"
@@ -38,7 +39,7 @@ var LOGS = func(h http.Handler) http.Handler {
 		}
 		t := time.Now()
 		h.ServeHTTP(recorder, r)
-		res := fmt.Sprintf("[%s] --> '%s' --> [%d]  from: %s ---------- Took: %v", r.Method, r.URL.Path, recorder.Status, r.RemoteAddr, time.Since(t))
+		res := fmt.Sprintf("[%s] --> '%s' --> [%d]  from: %s ---------- Took: %v", r.Method, r.URL.Path, recorder.Status, proxy.ClientIP(r), time.Since(t))
 
 		if recorder.Status >= 200 && recorder.Status < 400 {
 			fmt.Printf(logger.Green, res)
@@ -12,6 +12,7 @@ import (
 
 	"github.com/kamalshkeir/kago/core/admin/models"
 	"github.com/kamalshkeir/kago/core/kamux/csrf"
+	"github.com/kamalshkeir/kago/core/kamux/geoblock"
 	"github.com/kamalshkeir/kago/core/kamux/gzip"
 	"github.com/kamalshkeir/kago/core/kamux/logs"
 	"github.com/kamalshkeir/kago/core/kamux/ratelimiter"
@@ -266,5 +267,6 @@ var RECOVERY = func(next http.Handler) http.Handler {
 
 var CSRF = csrf.CSRF
 var GZIP = gzip.GZIP
+var GEOBLOCK = geoblock.GEOBLOCK
 var LIMITER = ratelimiter.LIMITER
 var LOGS = logs.LOGS
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	mu      sync.RWMutex
+	trusted []*net.IPNet
+)
+
+// Trust replace the trusted proxies, ips or CIDRs like '10.0.0.0/8', forwarded headers are used only when sent by them
+func Trust(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		nets = append(nets, n)
+	}
+	mu.Lock()
+	trusted = nets
+	mu.Unlock()
+	return nil
+}
+
+// IsTrusted return true if ip is a trusted proxy
+func IsTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP return the ip of the peer without port
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func fromTrusted(r *http.Request) bool {
+	return IsTrusted(net.ParseIP(remoteIP(r)))
+}
+
+// ClientIP return the ip of the client, when the request come from a trusted proxy, the hops of the Forwarded
+// or X-Forwarded-For header are walked from the right and the first one not trusted is the client
+func ClientIP(r *http.Request) string {
+	remote := remoteIP(r)
+	if !IsTrusted(net.ParseIP(remote)) {
+		return remote
+	}
+	hops := forwardedValues(r, "for")
+	if len(hops) == 0 {
+		hops = headerValues(r, "X-Forwarded-For")
+	}
+	if len(hops) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); ip != nil {
+			return ip.String()
+		}
+		return remote
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHop(hops[i])
+		if ip == nil {
+			// 'unknown' or obfuscated, the client cannot be known further
+			break
+		}
+		client = ip.String()
+		if !IsTrusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// Scheme return 'https' if the request is served over TLS, or was received over https by a trusted proxy, 'http' otherwise
+func Scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if fromTrusted(r) {
+		proto := first(forwardedValues(r, "proto"))
+		if proto == "" {
+			proto = first(headerValues(r, "X-Forwarded-Proto"))
+		}
+		if strings.EqualFold(proto, "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// IsSecure return true if the client used https
+func IsSecure(r *http.Request) bool {
+	return Scheme(r) == "https"
+}
+
+// Host return the host asked by the client, from the Forwarded or X-Forwarded-Host header if sent by a trusted proxy
+func Host(r *http.Request) string {
+	if fromTrusted(r) {
+		host := first(forwardedValues(r, "host"))
+		if host == "" {
+			host = first(headerValues(r, "X-Forwarded-Host"))
+		}
+		if host != "" {
+			return host
+		}
+	}
+	return r.Host
+}
+
+// headerValues split the comma separated values of every header name
+func headerValues(r *http.Request, name string) []string {
+	values := []string{}
+	for _, h := range r.Header.Values(name) {
+		for _, v := range strings.Split(h, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// forwardedValues return values of key in every element of the Forwarded header (RFC 7239)
+//
+//	Forwarded: for=192.0.2.60;proto=https, for="[2001:db8:cafe::17]:4711"
+func forwardedValues(r *http.Request, key string) []string {
+	values := []string{}
+	for _, element := range headerValues(r, "Forwarded") {
+		for _, pair := range strings.Split(element, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), key) {
+				values = append(values, strings.Trim(strings.TrimSpace(v), `"`))
+			}
+		}
+	}
+	return values
+}
+
+// parseHop parse '1.2.3.4', '1.2.3.4:80', '[::1]' or '[::1]:80'
+func parseHop(hop string) net.IP {
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(hop, "[]"))
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
 	"golang.org/x/time/rate"
 )
 
@@ -14,21 +15,22 @@ var LIMITER_TIMEOUT = 5 * time.Minute
 var LIMITER = func(next http.Handler) http.Handler {
 	var limiter = rate.NewLimiter(1, LIMITER_TOKENS)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		v, ok := banned.Load(r.RemoteAddr)
+		ip := proxy.ClientIP(r)
+		v, ok := banned.Load(ip)
 		if ok {
 			if time.Since(v.(time.Time)) > LIMITER_TIMEOUT {
-				banned.Delete(r.RemoteAddr)
+				banned.Delete(ip)
 			} else {
 				w.WriteHeader(http.StatusTooManyRequests)
 				w.Write([]byte("<h1>YOU DID TOO MANY REQUEST, YOU HAVE BEEN BANNED FOR 5 MINUTES </h1>"))
-				banned.Store(r.RemoteAddr, time.Now())
+				banned.Store(ip, time.Now())
 				return
 			}
 		}
 		if !limiter.Allow() {
 			w.WriteHeader(http.StatusTooManyRequests)
 			w.Write([]byte("<h1>YOU DID TOO MANY REQUEST, YOU HAVE BEEN BANNED FOR 5 MINUTES </h1>"))
-			banned.Store(r.RemoteAddr, time.Now())
+			banned.Store(ip, time.Now())
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -10,11 +10,11 @@ import (
 	"time"
 	"unicode/utf8"
 
-	"github.com/kamalshkeir/kago/core/orm"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/acme"
+	"github.com/kamalshkeir/kago/core/utils/acme/autocert"
 	"github.com/kamalshkeir/kago/core/utils/logger"
-	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/net/websocket"
 )
 
@@ -28,47 +28,17 @@ var (
 
 // InitServer init the server with midws,
 func (router *Router) initServer() {
-	port := settings.Config.Port
-	var handler http.Handler
-	if len(midwrs) != 0 {
-		handler = midwrs[0](router)
-		for i := 1; i < len(midwrs); i++ {
-			handler = midwrs[i](handler)
-		}
-	} else {
-		handler = router
-	}
-	host := settings.Config.Host
-
-	if host == "" {
-		host = "127.0.0.1"
-	}
-
-	if port == "" {
-		port = "9313"
-	}
-	// Setup Server
-	server := http.Server{
-		Addr:         host + ":" + port,
-		Handler:      handler,
-		ReadTimeout:  ReadTimeout,
-		WriteTimeout: WriteTimeout,
-		IdleTimeout:  IdleTimeout,
-	}
-	router.Server = &server
+	router.Server = newServer(serverAddr(), router.handler())
+	withH2C(router.Server)
 }
 
 func (router *Router) autoServer(tlsconf *tls.Config) {
+	router.Server = newServer(serverAddr(), router.handler())
+	router.Server.TLSConfig = tlsconf
+}
+
+func serverAddr() string {
 	port := settings.Config.Port
-	var handler http.Handler
-	if len(midwrs) != 0 {
-		handler = midwrs[0](router)
-		for i := 1; i < len(midwrs); i++ {
-			handler = midwrs[i](handler)
-		}
-	} else {
-		handler = router
-	}
 	host := settings.Config.Host
 
 	if host == "" {
@@ -78,16 +48,7 @@ func (router *Router) autoServer(tlsconf *tls.Config) {
 	if port == "" {
 		port = "9313"
 	}
-	// Setup Server
-	server := http.Server{
-		Addr:         host + ":" + port,
-		Handler:      handler,
-		ReadTimeout:  ReadTimeout,
-		WriteTimeout: WriteTimeout,
-		IdleTimeout:  IdleTimeout,
-		TLSConfig:    tlsconf,
-	}
-	router.Server = &server
+	return host + ":" + port
 }
 
 // UseMiddlewares chain global middlewares applied on the router
@@ -95,8 +56,8 @@ func (router *Router) UseMiddlewares(midws ...func(http.Handler) http.Handler) {
 	midwrs = append(midwrs, midws...)
 }
 
-// Run start the server
-func (router *Router) Run() {
+// Run start the server and block until it is shut down, by a SIGINT, a SIGTERM or a call to Shutdown
+func (router *Router) Run() error {
 	if settings.MODE != "barebone" {
 		// init templates and assets
 		initTemplatesAndAssets(router)
@@ -111,41 +72,68 @@ func (router *Router) Run() {
 		}
 	}
 
-	tls := router.createAndHandleServerCerts()
+	tls, err := router.createAndHandleServerCerts()
+	if err != nil {
+		return err
+	}
+
+	if settings.Config.RedirectAddr != "" && tls {
+		router.ListenRedirect(settings.Config.RedirectAddr)
+	}
+	if settings.Config.Socket != "" {
+		router.ListenUnix(settings.Config.Socket)
+	}
 
 	// graceful Shutdown server + db if exist
-	go router.gracefulShutdown()
+	go router.shutdownOnSignal()
 
-	if tls {
-		if err := router.Server.ListenAndServeTLS(settings.Config.Cert, settings.Config.Key); err != http.ErrServerClosed {
-			logger.Error("Unable to shutdown the server : ", err)
-		} else {
-			fmt.Printf(logger.Green, "Server Off !")
-		}
-	} else {
-		if err := router.Server.ListenAndServe(); err != http.ErrServerClosed {
-			logger.Error("Unable to shutdown the server : ", err)
-		} else {
-			fmt.Printf(logger.Green, "Server Off !")
-		}
+	if err := router.serve(tls); err != http.ErrServerClosed {
+		// stop listeners already started
+		_ = router.Shutdown(context.Background())
+		return err
 	}
+	// Serve return as soon as Shutdown start, wait for hooks and databases
+	<-router.state().done
+	fmt.Printf(logger.Green, "Server Off !")
+	return router.state().err
 }
 
-func (router *Router) createAndHandleServerCerts() bool {
+func (router *Router) createAndHandleServerCerts() (bool, error) {
 	host := settings.Config.Host
 	domains := settings.Config.Domains
 	cert := settings.Config.Cert
 	key := settings.Config.Key
 	domainsToCertify := map[string]bool{}
 
-	if (cert != "" && key != "") || domains == "" || host == "localhost" || host == "127.0.0.1" || host == "0.0.0.0" {
+	if cert != "" && key != "" {
+		// many pairs can be given separated by comma, selected by SNI
+		certs, keys := strings.Split(cert, ","), strings.Split(key, ",")
+		if len(certs) != len(keys) {
+			return false, fmt.Errorf("CERT has %d files and KEY %d", len(certs), len(keys))
+		}
+		for i := range certs {
+			if err := router.AddCertificate(strings.TrimSpace(certs[i]), strings.TrimSpace(keys[i])); err != nil {
+				return false, err
+			}
+		}
+	}
+	if router.certReloader != nil {
+		router.autoServer(&tls.Config{
+			GetCertificate: router.certReloader.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		})
+		go router.certReloader.Watch(router.state().done)
+		return true, nil
+	}
+
+	if domains == "" || host == "localhost" || host == "127.0.0.1" || host == "0.0.0.0" {
 		router.initServer()
-		return false
+		return false, nil
 	} else if domains == "" && cert == "" && key == "" {
 		err := checkDomain(host)
 		if err != nil || host == "localhost" || host == "127.0.0.1" {
 			router.initServer()
-			return false
+			return false, nil
 		} else {
 			// cree un nouveau single domain for host
 			if strings.HasPrefix(host, "www.") {
@@ -218,15 +206,17 @@ func (router *Router) createAndHandleServerCerts() bool {
 	if len(domainsToCertify) > 0 {
 		m := &autocert.Manager{
 			Prompt:     autocert.AcceptTOS,
-			Cache:      autocert.DirCache("certs"),
+			Cache:      certCache(),
 			HostPolicy: autocert.HostWhitelist(uniqueDomains...),
+			Client:     &acme.Client{DirectoryURL: ACMEDirectory},
 		}
+		router.certManager = m
 		tlsConfig := m.TLSConfig()
 		tlsConfig.NextProtos = append([]string{"h2", "http/1.1"}, tlsConfig.NextProtos...) 
 		router.autoServer(tlsConfig)
 		logger.Printfs("grAuto certified domains: %v", uniqueDomains)
 	}
-	return true
+	return true, nil
 }
 
 func checkDomain(name string) error {
@@ -282,12 +272,14 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	const key utils.ContextKey = "params"
 	c := &Context{Request: r, ResponseWriter: w, Params: map[string]string{}}
 	var allRoutes []Route
+	isSSE := false
 	switch r.Method {
 	case "GET":
 		if strings.Contains(r.URL.Path, "/ws/") {
 			allRoutes = router.Routes[WS]
 		} else if strings.Contains(r.URL.Path, "/sse/") {
 			allRoutes = router.Routes[SSE]
+			isSSE = true
 		} else {
 			allRoutes = router.Routes[GET]
 		}
@@ -323,14 +315,22 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					ctx := context.WithValue(c.Request.Context(), key, c.Params)
 					c.Request = r.WithContext(ctx)
 				}
+				st := router.state()
+				if (rt.WsHandler != nil || isSSE) && st.stopping.Load() {
+					c.Status(http.StatusServiceUnavailable).Text(ErrShuttingDown.Error())
+					return
+				}
 				if rt.WsHandler != nil {
 					// WS
 					rt.Method = r.Method
-					handleWebsockets(c, rt)
+					handleWebsockets(c, rt, st)
 					return
 				} else {
 					// HTTP
 					rt.Method = r.Method
+					if isSSE {
+						defer st.trackSSE(c)()
+					}
 					handleHttp(c, rt)
 					return
 				}
@@ -340,28 +340,6 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	router.DefaultRoute(c)
 }
 
-// Graceful Shutdown
-func (router *Router) gracefulShutdown() {
-	err := utils.GracefulShutdown(func() error {
-		// Close databases
-		if err := orm.ShutdownDatabases(); err != nil {
-			logger.Error("unable to shutdown databases:", err)
-		} else {
-			fmt.Printf(logger.Blue, "Databases Closed")
-		}
-		// Shutdown server
-		router.Server.SetKeepAlivesEnabled(false)
-		err := router.Server.Shutdown(context.Background())
-		if logger.CheckError(err) {
-			return err
-		}
-		return nil
-	})
-	if logger.CheckError(err) {
-		os.Exit(1)
-	}
-}
-
 func ParamsHandleFunc(r *http.Request) (map[string]string, bool) {
 	const key utils.ContextKey = "params"
 	params, ok := r.Context().Value(key).(map[string]string)
@@ -424,6 +402,9 @@ func checkSameSite(c Context) bool {
 	if origin == "" {
 		return false
 	}
+	if origin == c.BaseURL() {
+		return true
+	}
 
 	if len(Origines) > 0 {
 		for _, o := range Origines {
@@ -448,12 +429,12 @@ func checkSameSite(c Context) bool {
 		port = ":" + port
 	}
 	privateIp = utils.GetPrivateIp()
-	if utils.StringContains(c.Request.RemoteAddr, host, "localhost", "127.0.0.1", privateIp) {
+	if utils.StringContains(c.GetUserIP(), host, "localhost", "127.0.0.1", privateIp) {
 		return true
 	}
 
 	if CORSDebug {
-		logger.Info("ORIGIN of remote ", c.Request.RemoteAddr, "is:", origin)
+		logger.Info("ORIGIN of remote ", c.GetUserIP(), "is:", origin)
 		logger.Info("HOST:", host)
 		logger.Info("PORT:", port)
 		logger.Info("DOMAINS:", settings.Config.Domains)
@@ -493,11 +474,12 @@ func checkSameSite(c Context) bool {
 	}
 }
 
-func handleWebsockets(c *Context, rt Route) {
+func handleWebsockets(c *Context, rt Route, st *shutdownState) {
 	if checkSameSite(*c) {
 		// same site
 		websocket.Handler(func(conn *websocket.Conn) {
 			conn.MaxPayloadBytes = 10 << 20
+			defer st.trackWs(conn)()
 			if conn.IsServerConn() {
 				ctx := &WsContext{
 					Ws:     conn,
@@ -524,6 +506,7 @@ func handleWebsockets(c *Context, rt Route) {
 			if allowed {
 				websocket.Handler(func(conn *websocket.Conn) {
 					conn.MaxPayloadBytes = 10 << 20
+					defer st.trackWs(conn)()
 					if conn.IsServerConn() {
 						ctx := &WsContext{
 							Ws:     conn,
@@ -0,0 +1,208 @@
+package kamux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"golang.org/x/net/websocket"
+)
+
+// ShutdownTimeout is the time given to in flight requests to finish when Shutdown is called with a context without deadline,
+// remaining connections are closed after it
+var ShutdownTimeout = 10 * time.Second
+
+// CloseDatabasesOnShutdown close the connections of every database after the hooks, disable it if databases outlive the router
+var CloseDatabasesOnShutdown = true
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+type shutdownHook struct {
+	order int
+	hook  func(ctx context.Context) error
+}
+
+type shutdownState struct {
+	once     sync.Once
+	done     chan struct{}
+	err      error
+	mu       sync.Mutex
+	hooks    []shutdownHook
+	stopping atomic.Bool
+	connsMu  sync.Mutex
+	ws       map[*websocket.Conn]struct{}
+	sse      map[*sseConn]struct{}
+}
+
+// sseConn is an open SSE stream, writes are serialized so the final event is not mixed with the handler ones
+type sseConn struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	cancel context.CancelFunc
+	closed bool
+}
+
+var statesMu sync.Mutex
+
+func (router *Router) state() *shutdownState {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	if router.shutdown == nil {
+		router.shutdown = &shutdownState{
+			done: make(chan struct{}),
+			ws:   map[*websocket.Conn]struct{}{},
+			sse:  map[*sseConn]struct{}{},
+		}
+	}
+	return router.shutdown
+}
+
+// OnShutdown add a hook executed by Shutdown once the server stopped and requests are drained, before databases are closed.
+// Hooks run by ascending order, hooks with the same order run in the order they were added
+func (router *Router) OnShutdown(order int, hook func(ctx context.Context) error) {
+	st := router.state()
+	st.mu.Lock()
+	st.hooks = append(st.hooks, shutdownHook{order: order, hook: hook})
+	st.mu.Unlock()
+}
+
+// Shutdown stop the server gracefully: WS clients receive a close frame, SSE clients a final 'shutdown' event,
+// in flight requests are drained until ctx (or ShutdownTimeout) expire, then hooks run and databases are closed.
+// It can be called many times, only the first call do the work, others wait for it and return the same error
+func (router *Router) Shutdown(ctx context.Context) error {
+	st := router.state()
+	st.once.Do(func() {
+		defer close(st.done)
+		st.stopping.Store(true)
+		if _, ok := ctx.Deadline(); !ok && ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ShutdownTimeout)
+			defer cancel()
+		}
+
+		st.closeLongLivedConns()
+		if err := router.shutdownServers(ctx); err != nil {
+			logger.Warn("drain timeout, closing remaining connections:", err)
+			st.err = err
+		}
+
+		st.mu.Lock()
+		hooks := append([]shutdownHook{}, st.hooks...)
+		st.mu.Unlock()
+		sort.SliceStable(hooks, func(i, j int) bool {
+			return hooks[i].order < hooks[j].order
+		})
+		for _, h := range hooks {
+			if err := h.hook(ctx); err != nil {
+				logger.Error("shutdown hook:", err)
+				if st.err == nil {
+					st.err = err
+				}
+			}
+		}
+
+		if !CloseDatabasesOnShutdown {
+			return
+		}
+		if err := orm.ShutdownDatabases(); err != nil {
+			logger.Error("unable to shutdown databases:", err)
+			if st.err == nil {
+				st.err = err
+			}
+		} else {
+			fmt.Printf(logger.Blue, "Databases Closed")
+		}
+	})
+	<-st.done
+	return st.err
+}
+
+// shutdownOnSignal call Shutdown on SIGINT or SIGTERM, until the router is shut down
+func (router *Router) shutdownOnSignal() {
+	st := router.state()
+	s := make(chan os.Signal, 1)
+	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(s)
+	select {
+	case <-s:
+		_ = router.Shutdown(context.Background())
+	case <-st.done:
+	}
+}
+
+// closeLongLivedConns notify and close WS and SSE connections, http.Server.Shutdown does not wait for hijacked connections
+// and would wait for SSE handlers until the deadline
+func (st *shutdownState) closeLongLivedConns() {
+	st.connsMu.Lock()
+	ws := make([]*websocket.Conn, 0, len(st.ws))
+	for conn := range st.ws {
+		ws = append(ws, conn)
+	}
+	sse := make([]*sseConn, 0, len(st.sse))
+	for conn := range st.sse {
+		sse = append(sse, conn)
+	}
+	st.connsMu.Unlock()
+
+	for _, conn := range ws {
+		// send a close frame then close the connection, the handler receive an error and return
+		_ = conn.Close()
+	}
+	for _, conn := range sse {
+		conn.mu.Lock()
+		if !conn.closed {
+			_, _ = conn.w.Write([]byte("event: shutdown\ndata: server shutting down\n\n"))
+			if f, ok := conn.w.(http.Flusher); ok {
+				f.Flush()
+			}
+			conn.closed = true
+		}
+		conn.mu.Unlock()
+		conn.cancel()
+	}
+}
+
+func (st *shutdownState) trackWs(conn *websocket.Conn) func() {
+	st.connsMu.Lock()
+	st.ws[conn] = struct{}{}
+	st.connsMu.Unlock()
+	return func() {
+		st.connsMu.Lock()
+		delete(st.ws, conn)
+		st.connsMu.Unlock()
+	}
+}
+
+// trackSSE give the handler a request context cancelled on shutdown, so it can stop streaming
+func (st *shutdownState) trackSSE(c *Context) func() {
+	const key utils.ContextKey = "sse"
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	conn := &sseConn{w: c.ResponseWriter, cancel: cancel}
+	c.Request = c.Request.WithContext(context.WithValue(ctx, key, conn))
+	st.connsMu.Lock()
+	st.sse[conn] = struct{}{}
+	st.connsMu.Unlock()
+	return func() {
+		st.connsMu.Lock()
+		delete(st.sse, conn)
+		st.connsMu.Unlock()
+		cancel()
+	}
+}
+
+func sseConnOf(c *Context) (*sseConn, bool) {
+	const key utils.ContextKey = "sse"
+	conn, ok := c.Request.Context().Value(key).(*sseConn)
+	return conn, ok
+}
@@ -17,12 +17,11 @@ import (
 	"github.com/kamalshkeir/kago/core/orm"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/i18n"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var allTemplates = template.New("")
-
 // initTemplatesAndAssets init templates from a folder and download admin skeleton html files
 func initTemplatesAndAssets(router *Router) {
 	var wg sync.WaitGroup
@@ -85,59 +84,15 @@ func (router *Router) ServeEmbededDir(pathLocalDir string, embeded embed.FS, web
 	})
 }
 
+// AddLocalTemplates parse templates of a directory, in dev mode they are parsed again when files change
 func (router *Router) AddLocalTemplates(pathToDir string) error {
-	cleanRoot := filepath.ToSlash(pathToDir)
-	pfx := len(cleanRoot) + 1
-
-	err := filepath.Walk(cleanRoot, func(path string, info os.FileInfo, e1 error) error {
-		if !info.IsDir() && strings.HasSuffix(path, ".html") {
-			if e1 != nil {
-				return e1
-			}
-
-			b, e2 := os.ReadFile(path)
-			if e2 != nil {
-				return e2
-			}
-			name := filepath.ToSlash(path[pfx:])
-			t := allTemplates.New(name).Funcs(functions)
-			_, e2 = t.Parse(string(b))
-			if e2 != nil {
-				return e2
-			}
-		}
-
-		return nil
-	})
-
-	return err
+	return views.add(localSource(pathToDir))
 }
 
+// AddEmbededTemplates parse templates of rootDir in template_embed
 func (router *Router) AddEmbededTemplates(template_embed embed.FS, rootDir string) error {
-	cleanRoot := filepath.ToSlash(rootDir)
-	pfx := len(cleanRoot) + 1
-
-	err := fs.WalkDir(template_embed, cleanRoot, func(path string, info fs.DirEntry, e1 error) error {
-		if logger.CheckError(e1) {
-			return e1
-		}
-		if !info.IsDir() && strings.HasSuffix(path, ".html") {
-			b, e2 := template_embed.ReadFile(path)
-			if logger.CheckError(e2) {
-				return e2
-			}
-
-			name := filepath.ToSlash(path[pfx:])
-			t := allTemplates.New(name).Funcs(functions)
-			_, e3 := t.Parse(string(b))
-			if logger.CheckError(e3) {
-				return e2
-			}
-		}
-
-		return nil
-	})
-
+	err := views.add(templateSource{fsys: template_embed, root: filepath.ToSlash(rootDir)})
+	logger.CheckError(err)
 	return err
 }
 
@@ -273,6 +228,10 @@ var functions = template.FuncMap{
 	"add": func(a int, b int) int {
 		return a + b
 	},
+	"partial": func(name string, args ...any) (template.HTML, error) {
+		return views.partial(name, args...)
+	},
+	"dict": dict,
 	"safe": func(str string) template.HTML {
 		return template.HTML(str)
 	},
@@ -378,68 +337,20 @@ var functions = template.FuncMap{
 		}
 	},
 	"translateFromRequest": func(translation string, request *http.Request) any {
-		var lg string
-		if language, err := request.Cookie("lang"); err == nil {
-			lg = strings.ToLower(language.Value)
-		} else {
-			lg = "en"
-		}
-
-		if data, ok := settings.Translations.Get(lg); ok {
-			if v, ok := data[translation]; ok {
-				return v
-			} else if strings.Contains(translation, ".") {
-				sp := strings.Split(translation, ".")
-				if len(sp) >= 2 && len(sp) < 4 {
-					if d, ok := data[sp[0]]; ok {
-						if f, ok := d.(map[string]any)[sp[1]]; ok {
-							switch v := f.(type) {
-							case string:
-								return v
-							case map[string]any:
-								if vv, ok := v[sp[2]]; ok {
-									return vv
-								}
-							default:
-								return "NOT HANDLED"
-							}
-						}
-					}
-				}
-			}
-		} else {
-			return "LANGUAGE NOT FOUND FROM COOKIE"
-		}
-
-		return "NOT VALID"
+		return i18n.T(i18n.FromRequest(request), translation)
 	},
 	"translateFromLang": func(translation, language string) any {
-		if data, ok := settings.Translations.Get(language); ok {
-			if v, ok := data[translation]; ok {
-				return v
-			} else if strings.Contains(translation, ".") {
-				sp := strings.Split(translation, ".")
-				if len(sp) >= 2 && len(sp) < 4 {
-					if d, ok := data[sp[0]]; ok {
-						if f, ok := d.(map[string]any)[sp[1]]; ok {
-							switch v := f.(type) {
-							case string:
-								return v
-							case map[string]any:
-								if vv, ok := v[sp[2]]; ok {
-									return vv
-								}
-							default:
-								return "NOT HANDLED"
-							}
-						}
-					}
-				}
-			}
-		} else {
-			return "LANGUAGE NOT FOUND FROM COOKIE"
+		return i18n.T(language, translation)
+	},
+	// t translate in .Lang, or in the language of a request: {{t .Lang "cart.items" "count" 3}}
+	"t": func(langOrRequest any, key string, args ...any) string {
+		switch v := langOrRequest.(type) {
+		case *http.Request:
+			return i18n.T(i18n.FromRequest(v), key, args...)
+		case string:
+			return i18n.T(v, key, args...)
+		default:
+			return i18n.T(i18n.Default(), key, args...)
 		}
-
-		return "NOT VALID"
 	},
 }
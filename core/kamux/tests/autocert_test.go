@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/orm"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/acme"
+	"github.com/kamalshkeir/kago/core/utils/acme/autocert"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+func init() {
+	r := kamux.Router{}
+	r.LoadEnv("../../../.env")
+	orm.UseCache = false
+	err := orm.InitDB()
+	if logger.CheckError(err) {
+		return
+	}
+	err = orm.Migrate()
+	logger.CheckError(err)
+}
+
+// fakeACME is a minimal RFC 8555 directory, orders are ready without challenge and every CSR is signed by its CA
+type fakeACME struct {
+	*httptest.Server
+	caKey  *ecdsa.PrivateKey
+	ca     *x509.Certificate
+	orders int32
+	cert   []byte
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeACME{caKey: key}
+	f.ca, _ = x509.ParseCertificate(der)
+
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, code int, v any) {
+		w.Header().Set("Replay-Nonce", base64.RawURLEncoding.EncodeToString([]byte(time.Now().String())))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]any{
+			"newNonce":   f.URL + "/nonce",
+			"newAccount": f.URL + "/account",
+			"newOrder":   f.URL + "/order",
+			"revokeCert": f.URL + "/revoke",
+			"keyChange":  f.URL + "/key-change",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", f.URL+"/account/1")
+		reply(w, http.StatusCreated, map[string]any{"status": "valid"})
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&f.orders, 1)
+		w.Header().Set("Location", f.URL+"/order/1")
+		reply(w, http.StatusCreated, map[string]any{"status": "ready", "finalize": f.URL + "/finalize"})
+	})
+	mux.HandleFunc("/finalize", func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			CSR string `json:"csr"`
+		}{}
+		if err := jwsPayload(r, &payload); err != nil {
+			reply(w, http.StatusBadRequest, map[string]any{"type": "urn:ietf:params:acme:error:malformed"})
+			return
+		}
+		b, _ := base64.RawURLEncoding.DecodeString(payload.CSR)
+		csr, err := x509.ParseCertificateRequest(b)
+		if err != nil {
+			reply(w, http.StatusBadRequest, map[string]any{"type": "urn:ietf:params:acme:error:badCSR"})
+			return
+		}
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, leaf, f.ca, csr.PublicKey, f.caKey)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.ca.Raw})...)
+		w.Header().Set("Location", f.URL+"/order/1")
+		reply(w, http.StatusOK, map[string]any{"status": "valid", "certificate": f.URL + "/cert"})
+	})
+	mux.HandleFunc("/cert", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "cert")
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.cert)
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func jwsPayload(r *http.Request, dest any) error {
+	jws := struct {
+		Payload string `json:"payload"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dest)
+}
+
+func manager(f *fakeACME) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      kamux.DbCertCache{},
+		HostPolicy: autocert.HostWhitelist("kago.test"),
+		Client:     &acme.Client{DirectoryURL: f.URL + "/directory"},
+	}
+}
+
+func TestDbCertCache(t *testing.T) {
+	settings.Secret = "autocert-test-secret"
+	orm.Exec(orm.DefaultDB, "delete from autocert_cache")
+	f := newFakeACME(t)
+	defer f.Close()
+
+	cert, err := manager(f).GetCertificate(&tls.ClientHelloInfo{ServerName: "kago.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := x509.ParseCertificate(cert.Certificate[0]); leaf == nil || leaf.DNSNames[0] != "kago.test" {
+		t.Fatal("bad certificate")
+	}
+	rows, err := orm.Query(orm.DefaultDB, "select name, data from autocert_cache")
+	if err != nil || len(rows) < 2 {
+		t.Fatal("certificate and account key should be stored", rows, err)
+	}
+	for _, row := range rows {
+		if strings.Contains(row["data"].(string), "PRIVATE KEY") {
+			t.Error(row["name"], "is stored in clear")
+		}
+	}
+
+	// another instance sharing the database use the stored certificate
+	if _, err := manager(f).GetCertificate(&tls.ClientHelloInfo{ServerName: "kago.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&f.orders); n != 1 {
+		t.Error("expected 1 order, got", n)
+	}
+
+	// data is unreadable without the secret
+	settings.Secret = "another-secret"
+	if _, err := (kamux.DbCertCache{}).Get(context.Background(), "acme_account+key"); err == nil {
+		t.Error("decrypted with a wrong secret")
+	}
+	settings.Secret = "autocert-test-secret"
+
+	if _, err := (kamux.DbCertCache{}).Get(context.Background(), "missing"); err != autocert.ErrCacheMiss {
+		t.Error("expected cache miss, got", err)
+	}
+	if err := (kamux.DbCertCache{}).Delete(context.Background(), "acme_account+key"); err != nil {
+		t.Error(err)
+	}
+	if _, err := (kamux.DbCertCache{}).Get(context.Background(), "acme_account+key"); err != autocert.ErrCacheMiss {
+		t.Error("expected cache miss after delete, got", err)
+	}
+}
+
+func TestDbCertCacheLargeData(t *testing.T) {
+	settings.Secret = "autocert-test-secret"
+	if typ := orm.GetAllColumnsTypes("autocert_cache")["data"]; !strings.EqualFold(typ, "TEXT") {
+		t.Errorf("data column should be TEXT, got %q", typ)
+	}
+	// autocert store the private key followed by the certificate chain in one entry
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	for i := 1; i <= 3; i++ {
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i)),
+			Subject:      pkix.Name{CommonName: "kago.test"},
+			DNSNames:     []string{"kago.test", "www.kago.test"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	cache := kamux.DbCertCache{}
+	ctx := context.Background()
+	defer cache.Delete(ctx, "kago.test+rsa")
+	for i := 0; i < 2; i++ { // insert then update
+		if err := cache.Put(ctx, "kago.test+rsa", data); err != nil {
+			t.Fatal(err)
+		}
+		got, err := cache.Get(ctx, "kago.test+rsa")
+		if err != nil || string(got) != string(data) {
+			t.Fatalf("Get should return the %d bytes stored, got %d bytes %v", len(data), len(got), err)
+		}
+	}
+}
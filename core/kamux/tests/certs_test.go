@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+)
+
+// writeCert write a self signed pair for names in dir as name.pem and name.key, serial identify the certificate
+func writeCert(t *testing.T, dir, name string, serial int64, names ...string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a rewrite in the same clock tick keep the size, move the mtime so the change is seen
+	mtime := time.Now().Add(time.Duration(serial) * time.Second)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, cr *kamux.CertReloader, serverName string) int64 {
+	t.Helper()
+	cert, err := cr.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderSNI(t *testing.T) {
+	dir := t.TempDir()
+	cr := kamux.NewCertReloader()
+	if _, err := cr.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error("GetCertificate without certificate should fail")
+	}
+	for i, names := range [][]string{{"default.com"}, {"a.example.com", "b.example.com"}, {"*.wild.example.com"}, {"a.example.com"}} {
+		if err := cr.Add(writeCert(t, dir, names[0], int64(i+1), names...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]int64{
+		"":                        1,
+		"unknown.com":             1,
+		"default.com":             1,
+		"b.example.com":           2,
+		"A.Example.com.":          2, // first pair win, case and trailing dot ignored
+		"x.wild.example.com":      3,
+		"wild.example.com":        1,
+		"deep.x.wild.example.com": 1, // wildcards match one label only
+	} {
+		if got := servedSerial(t, cr, name); got != want {
+			t.Errorf("%q: got certificate %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	cr := kamux.NewCertReloader()
+	if err := cr.Add(writeCert(t, dir, "site", 1, "site.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, dir, "site", 2, "site.com")
+	cr.Reload(false)
+	if got := servedSerial(t, cr, "site.com"); got != 2 {
+		t.Errorf("rewritten files should be reloaded, got certificate %d", got)
+	}
+
+	// a broken file keep the last good certificate
+	if err := os.WriteFile(filepath.Join(dir, "site.pem"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cr.Reload(true)
+	if got := servedSerial(t, cr, "site.com"); got != 2 {
+		t.Errorf("a failed reload should keep the previous certificate, got %d", got)
+	}
+	if err := cr.Add(filepath.Join(dir, "site.pem"), filepath.Join(dir, "site.key")); err == nil {
+		t.Error("Add of a broken pair should fail")
+	}
+}
+
+func TestCertReloaderSIGHUP(t *testing.T) {
+	// keep SIGHUP from killing the test process before Watch listen for it
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	interval := kamux.CertsReloadInterval
+	kamux.CertsReloadInterval = time.Hour
+	defer func() { kamux.CertsReloadInterval = interval }()
+
+	dir := t.TempDir()
+	cr := kamux.NewCertReloader()
+	if err := cr.Add(writeCert(t, dir, "site", 1, "site.com")); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go cr.Watch(stop)
+
+	writeCert(t, dir, "site", 2, "site.com")
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, cr, "site.com") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP should reload certificates")
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/settings"
+	"golang.org/x/net/http2"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// runBarebone run r without TLS on a free port of 127.0.0.1 until the test end, and return the address of the main server
+func runBarebone(t *testing.T, r *kamux.Router, withH2C bool) string {
+	t.Helper()
+	mode, host, port, h2c := settings.MODE, settings.Config.Host, settings.Config.Port, settings.Config.H2C
+	addr := freeAddr(t)
+	settings.MODE = "barebone"
+	settings.Config.H2C = withH2C
+	settings.Config.Host, settings.Config.Port, _ = strings.Cut(addr, ":")
+	kamux.CloseDatabasesOnShutdown = false
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != nil {
+			t.Error("Run should return nil after Shutdown, got", err)
+		}
+		settings.MODE, settings.Config.Host, settings.Config.Port, settings.Config.H2C = mode, host, port, h2c
+		kamux.CloseDatabasesOnShutdown = true
+	})
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("server not started on", addr)
+	return ""
+}
+
+func newBareRouter() *kamux.Router {
+	r := &kamux.Router{
+		Routes: map[int][]kamux.Route{},
+		DefaultRoute: func(c *kamux.Context) {
+			c.Status(404).Text("Page Not Found")
+		},
+	}
+	r.GET("/hello", func(c *kamux.Context) {
+		c.Text("hello " + c.Request.Proto)
+	})
+	return r
+}
+
+func TestListenRedirect(t *testing.T) {
+	r := newBareRouter()
+	redirectAddr := freeAddr(t)
+	r.ListenRedirect(redirectAddr)
+	addr := runBarebone(t, r, false)
+
+	// own transport, its idle connections are closed before Shutdown, which wait for connections without request
+	client := &http.Client{
+		Transport: &http.Transport{},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get("http://" + redirectAddr + "/hello?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://127.0.0.1:"+port+"/hello?a=1" {
+		t.Errorf("redirect: got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	resp, err = client.Post("http://"+redirectAddr+"/hello", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST to the redirect listener should fail, got %d", resp.StatusCode)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "kago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "app.sock")
+	// a socket file left by a killed instance
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	r := newBareRouter()
+	r.ListenUnix(path)
+	addr := runBarebone(t, r, true)
+
+	for name, client := range map[string]*http.Client{"unix": unixClient(path), "tcp": {Transport: &http.Transport{}}} {
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("http://" + addr + "/hello")
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "hello HTTP/1.1" {
+			t.Errorf("%s: got %q", name, b)
+		}
+	}
+
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(_, _ string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	resp, err := h2c.Get("http://app/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "hello HTTP/2.0" {
+		t.Errorf("h2c: got %q", b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the socket file should be removed on shutdown", err)
+	}
+}
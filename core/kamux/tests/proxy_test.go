@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/kamux/proxy"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	if err := proxy.Trust("10.0.0.0/8", "192.168.1.1", "::1"); err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Trust()
+	if err := proxy.Trust("not-an-ip"); err == nil {
+		t.Error("invalid proxy should fail and keep trusted proxies")
+	}
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+		scheme  string
+		host    string
+	}{
+		{"direct", "8.8.8.8:1234", nil, "8.8.8.8", "http", "example.com"},
+		{"spoofed from untrusted", "8.8.8.8:1234", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-Ip": "2.2.2.2", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"}, "8.8.8.8", "http", "example.com"},
+		{"xff walked from the right", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.1.1.1, 10.0.0.5", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.com"}, "1.1.1.1", "https", "app.com"},
+		{"only trusted hops", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "10.1.1.1, 192.168.1.1"}, "10.1.1.1", "http", "example.com"},
+		{"x-real-ip", "192.168.1.1:80", map[string]string{"X-Real-Ip": "3.3.3.3"}, "3.3.3.3", "http", "example.com"},
+		{"forwarded", "[::1]:443", map[string]string{"Forwarded": `for=4.4.4.4;proto=https;host=fwd.com, for="[2001:db8::17]:4711", for=10.0.0.9`, "X-Forwarded-For": "5.5.5.5"}, "2001:db8::17", "https", "fwd.com"},
+		{"forwarded unknown hop", "10.0.0.2:1234", map[string]string{"Forwarded": "for=4.4.4.4, for=unknown"}, "10.0.0.2", "http", "example.com"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		ctx := &kamux.Context{ResponseWriter: httptest.NewRecorder(), Request: req}
+		if got := ctx.GetUserIP(); got != c.ip {
+			t.Errorf("%s: ip %q, want %q", c.name, got, c.ip)
+		}
+		if got := ctx.Scheme(); got != c.scheme {
+			t.Errorf("%s: scheme %q, want %q", c.name, got, c.scheme)
+		}
+		if got := proxy.Host(req); got != c.host {
+			t.Errorf("%s: host %q, want %q", c.name, got, c.host)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "https://secure.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	ctx := &kamux.Context{ResponseWriter: httptest.NewRecorder(), Request: req}
+	if got := ctx.BaseURL(); got != "https://secure.com" {
+		t.Error(got)
+	}
+}
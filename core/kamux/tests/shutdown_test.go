@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+	"golang.org/x/net/websocket"
+)
+
+// newTestRouter return a router served by an httptest server, Shutdown stop this server and keep databases open
+func newTestRouter(t *testing.T) (*kamux.Router, *httptest.Server) {
+	t.Helper()
+	kamux.CloseDatabasesOnShutdown = false
+	t.Cleanup(func() { kamux.CloseDatabasesOnShutdown = true })
+	r := &kamux.Router{
+		Routes: map[int][]kamux.Route{},
+		DefaultRoute: func(c *kamux.Context) {
+			c.Status(404).Text("Page Not Found")
+		},
+	}
+	ts := httptest.NewUnstartedServer(r)
+	r.Server = ts.Config
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return r, ts
+}
+
+func TestShutdownHooksOrder(t *testing.T) {
+	r, _ := newTestRouter(t)
+	order := []string{}
+	r.OnShutdown(2, func(ctx context.Context) error {
+		order = append(order, "c")
+		return nil
+	})
+	r.OnShutdown(1, func(ctx context.Context) error {
+		order = append(order, "a")
+		return errors.New("hook a failed")
+	})
+	r.OnShutdown(1, func(ctx context.Context) error {
+		order = append(order, "b")
+		return nil
+	})
+
+	err := r.Shutdown(context.Background())
+	if err == nil || err.Error() != "hook a failed" {
+		t.Errorf("Shutdown should return the first hook error, got %v", err)
+	}
+	if strings.Join(order, ",") != "a,b,c" {
+		t.Errorf("hooks should run by order then by registration, got %v", order)
+	}
+	if err2 := r.Shutdown(context.Background()); err2 != err || len(order) != 3 {
+		t.Errorf("second Shutdown should return the same error without running hooks, got %v %v", err2, order)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	r, ts := newTestRouter(t)
+	started := make(chan struct{})
+	r.GET("/slow", func(c *kamux.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		c.Text("done")
+	})
+	type result struct {
+		body string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(ts.URL + "/slow")
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		res <- result{string(b), err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-res:
+		if got.err != nil || got.body != "done" {
+			t.Errorf("in flight request should finish, got %q %v", got.body, got.err)
+		}
+	default:
+		t.Error("Shutdown returned before the in flight request finished")
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	r, ts := newTestRouter(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	r.GET("/stuck", func(c *kamux.Context) {
+		close(started)
+		<-release
+		c.Text("too late")
+	})
+	hooked := false
+	r.OnShutdown(0, func(ctx context.Context) error {
+		hooked = true
+		return nil
+	})
+	go func() {
+		resp, err := http.Get(ts.URL + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := r.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown should return the drain timeout, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Shutdown should not wait for stuck requests after the deadline")
+	}
+	if !hooked {
+		t.Error("hooks should run after a drain timeout")
+	}
+}
+
+func TestShutdownNotifyLongLivedConns(t *testing.T) {
+	r, ts := newTestRouter(t)
+	r.SSE("/sse/events", func(c *kamux.Context) {
+		if err := c.StreamResponse("hello"); err != nil {
+			return
+		}
+		<-c.Request.Context().Done()
+	})
+	wsReady := make(chan struct{})
+	r.WS("/ws/echo", func(c *kamux.WsContext) {
+		close(wsReady)
+		for {
+			if _, err := c.ReceiveText(); err != nil {
+				return
+			}
+		}
+	})
+
+	resp, err := http.Get(ts.URL + "/sse/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "data: hello\n" {
+		t.Fatalf("first event: got %q %v", line, err)
+	}
+	ws, err := websocket.Dial(strings.Replace(ts.URL, "http", "ws", 1)+"/ws/echo", "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	<-wsReady
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Shutdown should not wait for SSE and WS connections")
+	}
+
+	rest, _ := io.ReadAll(reader)
+	if !strings.Contains(string(rest), "event: shutdown\n") {
+		t.Errorf("SSE client should receive a shutdown event, got %q", rest)
+	}
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err == nil {
+		t.Errorf("WS connection should be closed, got message %q", msg)
+	}
+}
@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"embed"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/kamux"
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/i18n"
+)
+
+//go:embed testdata/templates
+var embededTemplates embed.FS
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func render(t *testing.T, name string, data map[string]any) string {
+	rec := httptest.NewRecorder()
+	c := &kamux.Context{ResponseWriter: rec, Request: httptest.NewRequest("GET", "/", nil)}
+	c.Html(name, data)
+	if rec.Code != 200 {
+		t.Fatalf("%s: status %d: %s", name, rec.Code, rec.Body.String())
+	}
+	return rec.Body.String()
+}
+
+func TestTemplateLayouts(t *testing.T) {
+	r := kamux.Router{}
+	dir := writeTemplates(t, map[string]string{
+		"layouts/site.html":  `<h1>{{block "title" .}}default title{{end}}</h1><main>{{block "content" .}}default content{{end}}</main>`,
+		"partials/card.html": `<div class="card">{{.title}}:{{.count}}</div>`,
+		"shared.html":        `{{define "footer"}}<footer>shared</footer>{{end}}`,
+		"home.html":          `{{template "layouts/site.html" .}}{{define "content"}}home {{.Name}}{{end}}`,
+		"about.html":         `{{template "layouts/site.html" .}}{{define "title"}}About{{end}}{{define "content"}}about{{template "footer"}}{{end}}`,
+		"empty.html":         `{{template "layouts/site.html" .}}`,
+		"cards.html":         `{{partial "card" "title" .Name "count" 3}}{{partial "partials/card.html" (dict "title" "b" "count" 4)}}`,
+	})
+	if err := r.AddLocalTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// pages define the same blocks without overriding each other
+	if got := render(t, "home.html", map[string]any{"Name": "kago"}); !strings.Contains(got, "<h1>default title</h1><main>home kago</main>") {
+		t.Error("home:", got)
+	}
+	if got := render(t, "about.html", nil); !strings.Contains(got, "<h1>About</h1><main>about<footer>shared</footer></main>") {
+		t.Error("about:", got)
+	}
+	if got := render(t, "empty.html", nil); !strings.Contains(got, "<main>default content</main>") {
+		t.Error("layout defaults should be used when a page define nothing:", got)
+	}
+	if got := render(t, "cards.html", map[string]any{"Name": "a"}); got != `<div class="card">a:3</div><div class="card">b:4</div>` {
+		t.Error("cards:", got)
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	r := kamux.Router{}
+	dir := writeTemplates(t, map[string]string{"reload/page.html": `version 1`})
+	if err := r.AddLocalTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+	settings.Config.Dev = true
+	check := kamux.TemplatesReloadCheck
+	kamux.TemplatesReloadCheck = 0
+	defer func() {
+		settings.Config.Dev = false
+		kamux.TemplatesReloadCheck = check
+	}()
+	if got := render(t, "reload/page.html", nil); got != "version 1" {
+		t.Fatal(got)
+	}
+	future := time.Now().Add(time.Second)
+	path := filepath.Join(dir, "reload", "page.html")
+	if err := os.WriteFile(path, []byte(`version 2`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, future, future)
+	if got := render(t, "reload/page.html", nil); got != "version 2" {
+		t.Error("template not reloaded:", got)
+	}
+
+	// a broken template keep the previous version
+	os.WriteFile(path, []byte(`{{if}}`), 0644)
+	future = future.Add(time.Second)
+	os.Chtimes(path, future, future)
+	if got := render(t, "reload/page.html", nil); got != "version 2" {
+		t.Error("previous template should be kept:", got)
+	}
+}
+
+func TestEmbededTemplates(t *testing.T) {
+	r := kamux.Router{}
+	if err := r.AddEmbededTemplates(embededTemplates, "testdata/templates"); err != nil {
+		t.Fatal(err)
+	}
+	got := render(t, "embeded/page.html", map[string]any{"Name": "kago"})
+	if !strings.Contains(got, "<title>embeded page</title><b>kago</b>") {
+		t.Error(got)
+	}
+}
+
+func TestHtmx(t *testing.T) {
+	r := kamux.Router{}
+	dir := writeTemplates(t, map[string]string{
+		"htmx/layout.html": `<body>{{block "main" .}}{{end}}<span id="count">{{block "count" .}}{{end}}</span></body>`,
+		"htmx/cart.html":   `{{template "htmx/layout.html" .}}{{define "main"}}<ul>{{range .Items}}<li>{{.}}</li>{{end}}</ul>{{end}}{{define "count"}}{{len .Items}}{{end}}`,
+		"htmx/other.html":  `{{template "htmx/layout.html" .}}{{define "main"}}other{{end}}`,
+	})
+	if err := r.AddLocalTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"Items": []string{"a", "b"}}
+
+	req := httptest.NewRequest("POST", "/cart", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	c := &kamux.Context{ResponseWriter: rec, Request: req}
+	if !c.IsHtmx() {
+		t.Error("htmx request not detected")
+	}
+	c.HtmlBlock("htmx/cart.html", "main", data)
+	if got := rec.Body.String(); got != "<ul><li>a</li><li>b</li></ul>" {
+		t.Error("block:", got)
+	}
+
+	rec = httptest.NewRecorder()
+	c = &kamux.Context{ResponseWriter: rec, Request: req}
+	c.HxTrigger("cartUpdated").HxTrigger("notify", map[string]any{"level": "info"}).HxRetarget("#cart").HtmlBlocks("htmx/cart.html", data, "main", "count")
+	if got := rec.Body.String(); got != `<ul><li>a</li><li>b</li></ul><div id="count" hx-swap-oob="innerHTML">2</div>` {
+		t.Error("oob:", got)
+	}
+	if got := rec.Header().Get("HX-Trigger"); got != `{"cartUpdated":null,"notify":{"level":"info"}}` {
+		t.Error("trigger:", got)
+	}
+	if got := rec.Header().Get("HX-Retarget"); got != "#cart" {
+		t.Error("retarget:", got)
+	}
+
+	rec = httptest.NewRecorder()
+	c = &kamux.Context{ResponseWriter: rec, Request: req}
+	c.HtmlBlock("htmx/cart.html", "missing", data)
+	if rec.Code != 500 {
+		t.Error("missing block should fail, got", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	c = &kamux.Context{ResponseWriter: rec, Request: req}
+	c.HxRedirect("/done")
+	if rec.Code != 200 || rec.Header().Get("HX-Redirect") != "/done" {
+		t.Error("htmx redirect:", rec.Code, rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	c = &kamux.Context{ResponseWriter: rec, Request: httptest.NewRequest("POST", "/cart", nil)}
+	if c.IsHtmx() {
+		t.Error("not an htmx request")
+	}
+	c.HxRedirect("/done")
+	if rec.Code != 303 || rec.Header().Get("Location") != "/done" {
+		t.Error("redirect:", rec.Code, rec.Header())
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	r := kamux.Router{}
+	dir := writeTemplates(t, map[string]string{
+		"i18n/en.json":   `{"greet":"Hi {name}","items":{"one":"{count} item","other":"{count} items"}}`,
+		"i18n/fr.json":   `{"greet":"Salut {name}","items":{"one":"{count} article","other":"{count} articles"}}`,
+		"i18n/page.html": `{{t .Lang "greet" "name" .Name}} {{t .Request "items" "count" .Count}}`,
+	})
+	if err := i18n.Load(filepath.Join(dir, "i18n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddLocalTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr-FR,fr;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+	c := &kamux.Context{ResponseWriter: rec, Request: req}
+	if c.Lang() != "fr" {
+		t.Error("lang:", c.Lang())
+	}
+	if got := c.T("items", "count", 2); got != "2 articles" {
+		t.Error(got)
+	}
+	c.Html("i18n/page.html", map[string]any{"Name": "kago", "Count": 1})
+	if got := rec.Body.String(); got != "Salut kago 1 article" {
+		t.Error("template:", got)
+	}
+
+	// the query param win over the header, EnableTranslations keep it in the cookie
+	req = httptest.NewRequest("GET", "/?lang=en", nil)
+	req.Header.Set("Accept-Language", "fr")
+	rec = httptest.NewRecorder()
+	c = &kamux.Context{ResponseWriter: rec, Request: req}
+	c.EnableTranslations()
+	if got := rec.Header().Get("Set-Cookie"); !strings.HasPrefix(got, "lang=en") {
+		t.Error("cookie:", got)
+	}
+}
@@ -0,0 +1,570 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kago/core/utils/safemap"
+	"github.com/kamalshkeir/kstrct"
+)
+
+var cachesAggregate = safemap.New[dbCache, any]()
+
+// aggregation is a query of Count, Exists, Sum, Avg, Min, Max, Pluck and Scan, shared by Builder[T] and BuilderM
+type aggregation struct {
+	tx       *Tx
+	ctx      context.Context
+	database string
+	table    string
+	// selected is the select list of the rows, with DISTINCT
+	selected string
+	// from is the from clause, with joins, where, group by and having
+	from    string
+	args    []any
+	orderBy string
+	limit   int
+	page    int
+	// grouped is set by GroupBy, rows of the query being groups
+	grouped bool
+	// distinct rows are counted from a subquery, like groups
+	distinct bool
+	debug    bool
+}
+
+func (b *Builder[T]) GroupBy(columns ...string) *Builder[T] {
+	b.groupBys = strings.Join(columns, ",")
+	return b
+}
+
+// Having filter groups of GroupBy, like Having("count(*) > ?", 1)
+func (b *Builder[T]) Having(query string, args ...any) *Builder[T] {
+	b.having = query
+	b.havingArgs = append(b.havingArgs, args...)
+	return b
+}
+
+// Distinct remove duplicated rows from All, One, Pluck, Scan and Count
+func (b *Builder[T]) Distinct() *Builder[T] {
+	b.distinct = true
+	return b
+}
+
+// Count return the number of rows, or of groups using GroupBy
+func (b *Builder[T]) Count() (int64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.count()
+}
+
+// Exists return true if a row match
+func (b *Builder[T]) Exists() (bool, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return false, err
+	}
+	return a.exists()
+}
+
+func (b *Builder[T]) Sum(column string) (float64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.number("SUM", column)
+}
+
+func (b *Builder[T]) Avg(column string) (float64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.number("AVG", column)
+}
+
+// Min return the smallest value of column, nil if there is no rows
+func (b *Builder[T]) Min(column string) (any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.value("MIN", column)
+}
+
+// Max return the biggest value of column, nil if there is no rows
+func (b *Builder[T]) Max(column string) (any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.value("MAX", column)
+}
+
+// Pluck return the values of column, using OrderBy, Limit and Page
+func (b *Builder[T]) Pluck(column string) ([]any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.pluck(column)
+}
+
+// Scan fill dest with the selected columns, dest is a pointer to a struct, a slice of structs or a []map[string]any,
+// struct fields are matched to columns in snake case
+//
+//	type authorPosts struct {
+//		AuthorId int
+//		Total    int
+//	}
+//	res := []authorPosts{}
+//	err := orm.Model[Post]().Select("author_id", "count(*) AS total").GroupBy("author_id").Having("count(*) > ?", 1).Scan(&res)
+func (b *Builder[T]) Scan(dest any) error {
+	a, err := b.aggregation()
+	if err != nil {
+		return err
+	}
+	return a.scan(dest)
+}
+
+func (b *Builder[T]) groupHaving() string {
+	return groupHaving(b.groupBys, b.having)
+}
+
+// queryArgs return the args of where and having
+func (b *Builder[T]) queryArgs() []any {
+	return append(append([]any{}, b.args...), b.havingArgs...)
+}
+
+func (b *Builder[T]) aggregation() (*aggregation, error) {
+	if b.tableName == "" {
+		return nil, errors.New("error: this model is not linked, execute orm.AutoMigrate before")
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	b.scope()
+	a := &aggregation{
+		tx:       b.tx,
+		ctx:      b.ctx,
+		database: b.database,
+		table:    b.tableName,
+		selected: b.selected,
+		orderBy:  b.orderBys,
+		limit:    b.limit,
+		page:     b.page,
+		args:     b.queryArgs(),
+		grouped:  b.groupBys != "",
+		distinct: b.distinct,
+		debug:    b.debug,
+	}
+	if a.selected == "" {
+		a.selected = "*"
+	}
+	a.from = " from " + b.tableName
+	switch {
+	case len(b.joins) > 0 && b.manyJoin && b.groupBys == "":
+		// rows of joined has_many and many_to_many relations would be counted many times
+		pk := b.tableName + "." + pkOf(reflect.TypeOf(*new(T)))
+		sub := "select " + pk + " from " + b.tableName + " " + strings.Join(b.joins, " ")
+		if b.whereQuery != "" {
+			sub += " WHERE " + b.whereQuery
+		}
+		a.from += " WHERE " + pk + " IN (" + sub + ")"
+	case len(b.joins) > 0:
+		if a.selected == "*" {
+			a.selected = b.tableName + ".*"
+		}
+		a.from += " " + strings.Join(b.joins, " ")
+		if b.whereQuery != "" {
+			a.from += " WHERE " + b.whereQuery
+		}
+	case b.whereQuery != "":
+		a.from += " WHERE " + b.whereQuery
+	}
+	a.from += b.groupHaving()
+	if b.groupBys != "" && (a.selected == "*" || a.selected == b.tableName+".*") {
+		// only grouped columns can be selected
+		a.selected = b.groupBys
+	}
+	if b.distinct {
+		a.selected = "DISTINCT " + a.selected
+	}
+	return a, nil
+}
+
+func (b *BuilderM) GroupBy(columns ...string) *BuilderM {
+	b.groupBys = strings.Join(columns, ",")
+	return b
+}
+
+// Having filter groups of GroupBy, like Having("count(*) > ?", 1)
+func (b *BuilderM) Having(query string, args ...any) *BuilderM {
+	b.having = query
+	b.havingArgs = append(b.havingArgs, args...)
+	return b
+}
+
+// Distinct remove duplicated rows from All, One, Pluck, Scan and Count
+func (b *BuilderM) Distinct() *BuilderM {
+	b.distinct = true
+	return b
+}
+
+// Count return the number of rows, or of groups using GroupBy
+func (b *BuilderM) Count() (int64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.count()
+}
+
+// Exists return true if a row match
+func (b *BuilderM) Exists() (bool, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return false, err
+	}
+	return a.exists()
+}
+
+func (b *BuilderM) Sum(column string) (float64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.number("SUM", column)
+}
+
+func (b *BuilderM) Avg(column string) (float64, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return 0, err
+	}
+	return a.number("AVG", column)
+}
+
+// Min return the smallest value of column, nil if there is no rows
+func (b *BuilderM) Min(column string) (any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.value("MIN", column)
+}
+
+// Max return the biggest value of column, nil if there is no rows
+func (b *BuilderM) Max(column string) (any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.value("MAX", column)
+}
+
+// Pluck return the values of column, using OrderBy, Limit and Page
+func (b *BuilderM) Pluck(column string) ([]any, error) {
+	a, err := b.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	return a.pluck(column)
+}
+
+// Scan fill dest with the selected columns, like Builder[T].Scan
+func (b *BuilderM) Scan(dest any) error {
+	a, err := b.aggregation()
+	if err != nil {
+		return err
+	}
+	return a.scan(dest)
+}
+
+func (b *BuilderM) selectFrom() string {
+	selected := "*"
+	if b.selected != "" && b.selected != "*" {
+		selected = b.selected
+	}
+	if b.distinct {
+		selected = "DISTINCT " + selected
+	}
+	return "select " + selected + " from " + b.tableName
+}
+
+func (b *BuilderM) groupHaving() string {
+	return groupHaving(b.groupBys, b.having)
+}
+
+// queryArgs return the args of where and having
+func (b *BuilderM) queryArgs() []any {
+	return append(append([]any{}, b.args...), b.havingArgs...)
+}
+
+func (b *BuilderM) aggregation() (*aggregation, error) {
+	if b.tableName == "" {
+		return nil, errors.New("unable to find table, try db.Table before")
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	b.scope()
+	a := &aggregation{
+		tx:       b.tx,
+		ctx:      b.ctx,
+		database: b.database,
+		table:    b.tableName,
+		selected: b.selected,
+		orderBy:  b.orderBys,
+		limit:    b.limit,
+		page:     b.page,
+		args:     b.queryArgs(),
+		grouped:  b.groupBys != "",
+		distinct: b.distinct,
+		debug:    b.debug,
+	}
+	if a.selected == "" {
+		a.selected = "*"
+	}
+	if b.groupBys != "" && a.selected == "*" {
+		// only grouped columns can be selected
+		a.selected = b.groupBys
+	}
+	if b.distinct {
+		a.selected = "DISTINCT " + a.selected
+	}
+	a.from = " from " + b.tableName
+	if b.whereQuery != "" {
+		a.from += " WHERE " + b.whereQuery
+	}
+	a.from += b.groupHaving()
+	return a, nil
+}
+
+func groupHaving(groupBys, having string) string {
+	s := ""
+	if groupBys != "" {
+		s += " GROUP BY " + groupBys
+	}
+	if having != "" {
+		s += " HAVING " + having
+	}
+	return s
+}
+
+// groupKey is the part of the cache key of All and One for group by, having and distinct
+func groupKey(groupBys, having string, havingArgs []any, distinct bool) string {
+	if groupBys == "" && having == "" && !distinct {
+		return ""
+	}
+	return fmt.Sprint(groupBys, "|", having, "|", havingArgs, "|", distinct)
+}
+
+func (a *aggregation) count() (int64, error) {
+	statement := "select COUNT(*) AS kago_count" + a.from
+	if a.grouped || a.distinct {
+		statement = "select COUNT(*) AS kago_count from (select " + a.selected + a.from + ") kago_sub"
+	}
+	rows, err := a.maps(statement)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	n, err := toFloat(rows[0]["kago_count"])
+	return int64(n), err
+}
+
+func (a *aggregation) exists() (bool, error) {
+	rows, err := a.maps("select 1 AS found" + a.from + " LIMIT 1")
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+func (a *aggregation) value(fn, column string) (any, error) {
+	if a.grouped {
+		return nil, errors.New(fn + " return one value, use Select and Scan to aggregate groups")
+	}
+	rows, err := a.maps("select " + fn + "(" + column + ") AS kago_value" + a.from)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0]["kago_value"], nil
+}
+
+// number return the result of fn as a float, 0 if there is no rows
+func (a *aggregation) number(fn, column string) (float64, error) {
+	v, err := a.value(fn, column)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return toFloat(v)
+}
+
+func (a *aggregation) pluck(column string) ([]any, error) {
+	selected := column
+	if strings.HasPrefix(a.selected, "DISTINCT ") {
+		selected = "DISTINCT " + column
+	}
+	rows, err := a.maps("select " + selected + a.from + a.pagination())
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, 0, len(rows))
+	for _, row := range rows {
+		for _, v := range row {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func (a *aggregation) scan(dest any) error {
+	rows, err := a.maps("select " + a.selected + a.from + a.pagination())
+	if err != nil {
+		return err
+	}
+	switch d := dest.(type) {
+	case *[]map[string]any:
+		res := make([]map[string]any, 0, len(rows))
+		for _, row := range rows {
+			m := make(map[string]any, len(row))
+			for k, v := range row {
+				m[k] = v
+			}
+			res = append(res, m)
+		}
+		*d = res
+		return nil
+	case *map[string]any:
+		if len(rows) == 0 {
+			return errors.New("no data found")
+		}
+		m := make(map[string]any, len(rows[0]))
+		for k, v := range rows[0] {
+			m[k] = v
+		}
+		*d = m
+		return nil
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("scan: dest should be a pointer")
+	}
+	v = v.Elem()
+	switch {
+	case v.Kind() == reflect.Struct:
+		if len(rows) == 0 {
+			return errors.New("no data found")
+		}
+		fillStruct(v, rows[0])
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		s := reflect.MakeSlice(v.Type(), len(rows), len(rows))
+		for i, row := range rows {
+			fillStruct(s.Index(i), row)
+		}
+		v.Set(s)
+	default:
+		return fmt.Errorf("scan: %s not handled, use a struct, a slice of structs or a []map[string]any", v.Type())
+	}
+	return nil
+}
+
+func (a *aggregation) pagination() string {
+	s := ""
+	if a.orderBy != "" {
+		s += " " + a.orderBy
+	}
+	if a.limit > 0 {
+		s += " LIMIT " + strconv.Itoa(a.limit)
+		if a.page > 0 {
+			s += " OFFSET " + strconv.Itoa((a.page-1)*a.limit)
+		}
+	}
+	return s
+}
+
+// maps run statement, using the cache outside of transactions
+func (a *aggregation) maps(statement string) ([]map[string]any, error) {
+	c := dbCache{
+		database:  a.database,
+		table:     a.table,
+		statement: statement,
+		args:      fmt.Sprintf("%#v", a.args),
+	}
+	cached := UseCache && !inTx(a.tx, a.ctx, a.database)
+	if cached {
+		if v, ok := cachesAggregate.Get(c); ok {
+			return v.([]map[string]any), nil
+		}
+	}
+	if a.debug {
+		logger.Debug("statement:", statement)
+		logger.Debug("args:", a.args)
+	}
+	b := &BuilderM{tableName: a.table, database: a.database, ctx: a.ctx, tx: a.tx}
+	rows, err := b.queryM(statement, a.args...)
+	if err != nil {
+		if err.Error() != "no data found" {
+			return nil, err
+		}
+		rows = []map[string]any{}
+	}
+	if cached {
+		cachesAggregate.Set(c, rows)
+	}
+	return rows, nil
+}
+
+// fillStruct fill the fields of v matching columns of row, aggregates being int64, float64 or decimal strings depending on the dialect
+func fillStruct(v reflect.Value, row map[string]any) {
+	for col, idx := range columnsOf(v.Type()) {
+		value, ok := row[col]
+		if !ok || value == nil {
+			continue
+		}
+		field := v.Field(idx)
+		if isNumeric(field.Kind()) {
+			if _, isString := value.(string); isString || isNumeric(reflect.ValueOf(value).Kind()) {
+				if f, err := toFloat(value); err == nil {
+					field.Set(reflect.ValueOf(f).Convert(field.Type()))
+					continue
+				}
+			}
+		}
+		kstrct.SetReflectFieldValue(field, value)
+	}
+}
+
+func isNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	case []byte:
+		return strconv.ParseFloat(string(n), 64)
+	default:
+		return strconv.ParseFloat(fmt.Sprint(n), 64)
+	}
+}
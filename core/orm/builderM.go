@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/kamalshkeir/kago/core/settings"
-	"github.com/kamalshkeir/kago/core/utils/eventbus"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 )
 
@@ -28,6 +27,17 @@ type BuilderM struct {
 	args       []any
 	order      []string
 	ctx        context.Context
+	tx         *Tx
+	distinct   bool
+	groupBys   string
+	having     string
+	havingArgs []any
+	err        error
+	trashed    string
+	scoped     bool
+	force      bool
+	hooking    bool
+	conds      bool
 }
 
 func Table(tableName string) *BuilderM {
@@ -64,6 +74,12 @@ func (b *BuilderM) Where(query string, args ...any) *BuilderM {
 		logger.Error("Use .Table before .Where")
 		return nil
 	}
+	if b.conds {
+		// the args of WhereCond would be kept while its conditions are replaced
+		b.err = errors.New("Where replace the where clause, call it before WhereCond")
+		return b
+	}
+	query, args = expandArgs(query, args)
 	b.whereQuery = query
 	b.args = append(b.args, args...)
 	b.order = append(b.order, "where")
@@ -144,6 +160,13 @@ func (b *BuilderM) All() ([]map[string]any, error) {
 	if b.tableName == "" {
 		return nil, errors.New("unable to find table, try db.Table before")
 	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.scope()
 	c := dbCache{
 		database:   b.database,
 		table:      b.tableName,
@@ -156,22 +179,21 @@ func (b *BuilderM) All() ([]map[string]any, error) {
 		limit:      b.limit,
 		page:       b.page,
 		args:       fmt.Sprintf("%v", b.args...),
+		group:      groupKey(b.groupBys, b.having, b.havingArgs, b.distinct),
 	}
-	if UseCache {
+	cached := UseCache && !inTx(b.tx, b.ctx, b.database)
+	if cached {
 		if v, ok := cachesAllM.Get(c); ok {
 			return v, nil
 		}
 	}
 
-	if b.selected != "" {
-		b.statement = "select " + b.selected + " from " + b.tableName
-	} else {
-		b.statement = "select * from " + b.tableName
-	}
+	b.statement = b.selectFrom()
 
 	if b.whereQuery != "" {
 		b.statement += " WHERE " + b.whereQuery
 	}
+	b.statement += b.groupHaving()
 	if b.query != "" {
 		b.limit = 0
 		b.orderBys = ""
@@ -196,12 +218,15 @@ func (b *BuilderM) All() ([]map[string]any, error) {
 		logger.Debug("args:", b.args)
 	}
 
-	models, err := b.queryM(b.statement, b.args...)
+	models, err := b.queryM(b.statement, b.queryArgs()...)
 	if err != nil {
 		return nil, err
 	}
+	if err := b.afterFind(models); err != nil {
+		return nil, err
+	}
 
-	if UseCache {
+	if cached {
 		cachesAllM.Set(c, models)
 	}
 	return models, nil
@@ -211,6 +236,13 @@ func (b *BuilderM) One() (map[string]any, error) {
 	if b.tableName == "" {
 		return nil, errors.New("unable to find table, try db.Table before")
 	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.scope()
 	c := dbCache{
 		database:   b.database,
 		table:      b.tableName,
@@ -223,22 +255,21 @@ func (b *BuilderM) One() (map[string]any, error) {
 		limit:      b.limit,
 		page:       b.page,
 		args:       fmt.Sprintf("%v", b.args...),
+		group:      groupKey(b.groupBys, b.having, b.havingArgs, b.distinct),
 	}
-	if UseCache {
+	cached := UseCache && !inTx(b.tx, b.ctx, b.database)
+	if cached {
 		if v, ok := cachesOneM.Get(c); ok {
 			return v, nil
 		}
 	}
 
-	if b.selected != "" && b.selected != "*" {
-		b.statement = "select " + b.selected + " from " + b.tableName
-	} else {
-		b.statement = "select * from " + b.tableName
-	}
+	b.statement = b.selectFrom()
 
 	if b.whereQuery != "" {
 		b.statement += " WHERE " + b.whereQuery
 	}
+	b.statement += b.groupHaving()
 
 	if b.orderBys != "" {
 		b.statement += " " + b.orderBys
@@ -254,15 +285,18 @@ func (b *BuilderM) One() (map[string]any, error) {
 		logger.Debug("args:", b.args)
 	}
 
-	models, err := b.queryM(b.statement, b.args...)
+	models, err := b.queryM(b.statement, b.queryArgs()...)
 	if err != nil {
 		return nil, err
 	}
+	if err := b.afterFind(models); err != nil {
+		return nil, err
+	}
 
 	if len(models) == 0 {
 		return nil, errors.New("no data")
 	}
-	if UseCache {
+	if cached {
 		cachesOneM.Set(c, models[0])
 	}
 
@@ -276,22 +310,28 @@ func (b *BuilderM) Insert(fields_comma_separated string, fields_values []any) (i
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "create",
-			"table":    b.tableName,
-			"database": b.database,
+	split := strings.Split(fields_comma_separated, ",")
+	if len(split) != len(fields_values) {
+		return 0, errors.New("fields and fields_values doesn't have the same length")
+	}
+	if !b.hooking && hasTableHook(b.tableName, BEFORE_INSERT, AFTER_INSERT) {
+		row := rowOf(split, fields_values)
+		var n int
+		err := b.withHooks(BEFORE_INSERT, AFTER_INSERT, func() ([]map[string]any, error) {
+			return []map[string]any{row}, nil
+		}, func() (err error) {
+			fields, values := fieldsOf(row, split)
+			n, err = b.Insert(strings.Join(fields, ","), values)
+			return err
 		})
+		return n, err
 	}
+	publishCache(b.tx, b.ctx, "create", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
 	}
 
-	split := strings.Split(fields_comma_separated, ",")
-	if len(split) != len(fields_values) {
-		return 0, errors.New("fields and fields_values doesn't have the same length")
-	}
 	placeholdersSlice := []string{}
 	for i := range split {
 		switch db.Dialect {
@@ -318,11 +358,11 @@ func (b *BuilderM) Insert(fields_comma_separated string, fields_values []any) (i
 		logger.Debug("args:", fields_values)
 	}
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, statement, fields_values...)
-	} else {
-		res, err = db.Conn.Exec(statement, fields_values...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, statement, fields_values...)
 	if err != nil {
 		if Debug {
 			logger.Info(statement,fields_values)
@@ -344,13 +384,10 @@ func (b *BuilderM) Set(query string, args ...any) (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "update",
-			"table":    b.tableName,
-			"database": b.database,
-		})
+	if b.err != nil {
+		return 0, b.err
 	}
+	publishCache(b.tx, b.ctx, "update", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
@@ -358,6 +395,7 @@ func (b *BuilderM) Set(query string, args ...any) (int, error) {
 	if b.whereQuery == "" {
 		return 0, errors.New("you should use Where before Update")
 	}
+	b.scope()
 
 	b.statement = "UPDATE " + b.tableName + " SET " + query + " WHERE " + b.whereQuery
 	adaptPlaceholdersToDialect(&b.statement, db.Dialect)
@@ -368,11 +406,11 @@ func (b *BuilderM) Set(query string, args ...any) (int, error) {
 	}
 
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement, args...)
-	} else {
-		res, err = db.Conn.Exec(b.statement, args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement, args...)
 	if err != nil {
 		if Debug {
 			logger.Info(b.statement,args)
@@ -394,24 +432,32 @@ func (b *BuilderM) Delete() (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "delete",
-			"table":    b.tableName,
-			"database": b.database,
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.whereQuery == "" {
+		return 0, errors.New("no Where was given for this query:" + b.whereQuery)
+	}
+	if !b.hooking && hasTableHook(b.tableName, BEFORE_DELETE, AFTER_DELETE) {
+		var n int
+		err := b.withHooks(BEFORE_DELETE, AFTER_DELETE, b.matching, func() (err error) {
+			n, err = b.Delete()
+			return err
 		})
+		return n, err
 	}
+	// tables with a softdelete column are only marked as deleted
+	if set, args, ok := softDelete(b.database, b.tableName, b.force); ok {
+		return b.Set(set, args...)
+	}
+	b.scope()
+	publishCache(b.tx, b.ctx, "delete", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
 	}
 
-	b.statement = "DELETE FROM " + b.tableName
-	if b.whereQuery != "" {
-		b.statement += " WHERE " + b.whereQuery
-	} else {
-		return 0, errors.New("no Where was given for this query:" + b.whereQuery)
-	}
+	b.statement = "DELETE FROM " + b.tableName + " WHERE " + b.whereQuery
 	adaptPlaceholdersToDialect(&b.statement, db.Dialect)
 	if b.debug {
 		logger.Debug("statement:", b.statement)
@@ -419,11 +465,11 @@ func (b *BuilderM) Delete() (int, error) {
 	}
 
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement, b.args...)
-	} else {
-		res, err = db.Conn.Exec(b.statement, b.args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement, b.args...)
 	if err != nil {
 		return 0, err
 	}
@@ -441,24 +487,18 @@ func (b *BuilderM) Drop() (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "drop",
-			"table":    b.tableName,
-			"database": b.database,
-		})
-	}
+	publishCache(b.tx, b.ctx, "drop", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
 	}
 	b.statement = "DROP TABLE " + b.tableName
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement)
-	} else {
-		res, err = db.Conn.Exec(b.statement)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement)
 	if err != nil {
 		return 0, err
 	}
@@ -480,11 +520,11 @@ func (b *BuilderM) queryM(statement string, args ...any) ([]map[string]interface
 	adaptPlaceholdersToDialect(&statement, db.Dialect)
 
 	var rows *sql.Rows
-	if b.ctx != nil {
-		rows, err = db.Conn.QueryContext(b.ctx, statement, args...)
-	} else {
-		rows, err = db.Conn.Query(statement, args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return nil, err
 	}
+	rows, err = exec.QueryContext(ctx, statement, args...)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("queryM: no data found")
 	} else if err != nil {
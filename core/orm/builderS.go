@@ -5,12 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
-	"github.com/kamalshkeir/kago/core/utils/eventbus"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 	"github.com/kamalshkeir/kago/core/utils/safemap"
 	"github.com/kamalshkeir/kstrct"
@@ -34,6 +34,24 @@ type Builder[T comparable] struct {
 	args       []any
 	order      []string
 	ctx        context.Context
+	tx         *Tx
+	joins      []string
+	distinct   bool
+	manyJoin   bool
+	err        error
+	joinTables map[string]string
+	preloads   []string
+	exprCols   []string
+	exprs      []Expression
+	groupBys   string
+	having     string
+	havingArgs []any
+	after      string
+	trashed    string
+	scoped     bool
+	force      bool
+	hooking    bool
+	conds      bool
 }
 
 func Model[T comparable]() *Builder[T] {
@@ -82,13 +100,17 @@ func (b *Builder[T]) Insert(model *T) (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "create",
-			"table":    b.tableName,
-			"database": b.database,
+	if !b.hooking && hasModelHook[T](BEFORE_INSERT, AFTER_INSERT) {
+		var n int
+		err := b.withHooks(BEFORE_INSERT, AFTER_INSERT, func() ([]*T, error) {
+			return []*T{model}, nil
+		}, func() (err error) {
+			n, err = b.Insert(model)
+			return err
 		})
+		return n, err
 	}
+	publishCache(b.tx, b.ctx, "create", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
@@ -103,7 +125,7 @@ func (b *Builder[T]) Insert(model *T) (int, error) {
 	index := 999
 	for i, name := range names {
 		if v, ok := mvalues[name]; ok {
-			values = append(values, v)
+			values = append(values, softDeleteValue(mtags[name], v))
 		} else {
 			logger.Error(v, "not found in fields")
 			return 0, errors.New("field not found")
@@ -132,11 +154,11 @@ func (b *Builder[T]) Insert(model *T) (int, error) {
 	b.statement = stat.String()
 	adaptPlaceholdersToDialect(&b.statement, db.Dialect)
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement, values...)
-	} else {
-		res, err = db.Conn.Exec(b.statement, values...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement, values...)
 	if err != nil {
 		if Debug {
 			logger.Info(b.statement,values)
@@ -163,13 +185,10 @@ func (b *Builder[T]) Set(query string, args ...any) (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "update",
-			"table":    b.tableName,
-			"database": b.database,
-		})
+	if b.err != nil {
+		return 0, b.err
 	}
+	publishCache(b.tx, b.ctx, "update", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
@@ -178,6 +197,7 @@ func (b *Builder[T]) Set(query string, args ...any) (int, error) {
 	if b.whereQuery == "" {
 		return 0, errors.New("you should use Where before Update")
 	}
+	b.scope()
 
 	b.statement = "UPDATE " + b.tableName + " SET " + query + " WHERE " + b.whereQuery
 	adaptPlaceholdersToDialect(&b.statement, db.Dialect)
@@ -188,11 +208,11 @@ func (b *Builder[T]) Set(query string, args ...any) (int, error) {
 	}
 
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement, args...)
-	} else {
-		res, err = db.Conn.Exec(b.statement, args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement, args...)
 	if err != nil {
 		if Debug {
 			logger.Info(b.statement,args)
@@ -219,23 +239,31 @@ func (b *Builder[T]) Delete() (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "delete",
-			"table":    b.tableName,
-			"database": b.database,
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.whereQuery == "" {
+		return 0, errors.New("no Where was given for this query:" + b.whereQuery)
+	}
+	if !b.hooking && hasModelHook[T](BEFORE_DELETE, AFTER_DELETE) {
+		var n int
+		err := b.withHooks(BEFORE_DELETE, AFTER_DELETE, b.matching, func() (err error) {
+			n, err = b.Delete()
+			return err
 		})
+		return n, err
+	}
+	// tables with a softdelete column are only marked as deleted
+	if set, args, ok := softDelete(b.database, b.tableName, b.force); ok {
+		return b.Set(set, args...)
 	}
+	b.scope()
+	publishCache(b.tx, b.ctx, "delete", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
 	}
-	b.statement = "DELETE FROM " + b.tableName
-	if b.whereQuery != "" {
-		b.statement += " WHERE " + b.whereQuery
-	} else {
-		return 0, errors.New("no Where was given for this query:" + b.whereQuery)
-	}
+	b.statement = "DELETE FROM " + b.tableName + " WHERE " + b.whereQuery
 	adaptPlaceholdersToDialect(&b.statement, db.Dialect)
 	if b.debug {
 		logger.Debug("statement:", b.statement)
@@ -244,11 +272,11 @@ func (b *Builder[T]) Delete() (int, error) {
 
 	var res sql.Result
 
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement, b.args...)
-	} else {
-		res, err = db.Conn.Exec(b.statement, b.args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement, b.args...)
 	if err != nil {
 		return 0, err
 	}
@@ -270,13 +298,7 @@ func (b *Builder[T]) Drop() (int, error) {
 	if b.database == "" {
 		b.database = settings.Config.Db.Name
 	}
-	if UseCache {
-		eventbus.Publish(CACHE_TOPIC, map[string]string{
-			"type":     "drop",
-			"table":    b.tableName,
-			"database": b.database,
-		})
-	}
+	publishCache(b.tx, b.ctx, "drop", b.tableName, b.database)
 	db, err := GetMemoryDatabase(b.database)
 	if logger.CheckError(err) {
 		return 0, err
@@ -284,11 +306,11 @@ func (b *Builder[T]) Drop() (int, error) {
 
 	b.statement = "DROP TABLE " + b.tableName
 	var res sql.Result
-	if b.ctx != nil {
-		res, err = db.Conn.ExecContext(b.ctx, b.statement)
-	} else {
-		res, err = db.Conn.Exec(b.statement)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return 0, err
 	}
+	res, err = exec.ExecContext(ctx, b.statement)
 	if err != nil {
 		return 0, err
 	}
@@ -308,6 +330,12 @@ func (b *Builder[T]) Select(columns ...string) *Builder[T] {
 }
 
 func (b *Builder[T]) Where(query string, args ...any) *Builder[T] {
+	if b.conds {
+		// the args of WhereCond would be kept while its conditions are replaced
+		b.err = errors.New("Where replace the where clause, call it before WhereCond")
+		return b
+	}
+	query, args = expandArgs(query, args)
 	b.whereQuery = query
 	b.args = append(b.args, args...)
 	b.order = append(b.order, "where")
@@ -367,6 +395,7 @@ func (b *Builder[T]) All() ([]T, error) {
 	if b.tableName == "" {
 		return nil, errors.New("error: this model is not linked, execute orm.AutoMigrate before")
 	}
+	b.scope()
 	c := dbCache{
 		database:   b.database,
 		table:      b.tableName,
@@ -379,21 +408,24 @@ func (b *Builder[T]) All() ([]T, error) {
 		limit:      b.limit,
 		page:       b.page,
 		args:       fmt.Sprintf("%v", b.args...),
+		relations:  strings.Join(b.joins, ",") + "|" + strings.Join(b.preloads, ","),
+		group:      groupKey(b.groupBys, b.having, b.havingArgs, b.distinct || b.manyJoin),
 	}
-	if UseCache {
+	cached := UseCache && !inTx(b.tx, b.ctx, b.database)
+	if cached {
 		if v, ok := cachesAllS.Get(c); ok {
 			return v.([]T), nil
 		}
 	}
-	if b.selected != "" && b.selected != "*" {
-		b.statement = "select " + b.selected + " from " + b.tableName
-	} else {
-		b.statement = "select * from " + b.tableName
+	if b.err != nil {
+		return nil, b.err
 	}
+	b.statement = b.selectFrom()
 
 	if b.whereQuery != "" {
 		b.statement += " WHERE " + b.whereQuery
 	}
+	b.statement += b.groupHaving()
 	if b.query != "" {
 		b.limit = 0
 		b.orderBys = ""
@@ -418,11 +450,17 @@ func (b *Builder[T]) All() ([]T, error) {
 		logger.Debug("args:", b.args)
 	}
 
-	models, err := b.queryS(b.statement, b.args...)
+	models, err := b.queryS(b.statement, b.queryArgs()...)
 	if err != nil {
 		return nil, err
 	}
-	if UseCache {
+	if err := b.preload(models); err != nil {
+		return nil, err
+	}
+	if err := b.afterFind(models); err != nil {
+		return nil, err
+	}
+	if cached {
 		cachesAllS.Set(c, models)
 	}
 	return models, nil
@@ -435,6 +473,7 @@ func (b *Builder[T]) One() (T, error) {
 	if b.tableName == "" {
 		return *new(T), errors.New("error: this model is not linked, execute orm.AutoMigrate first")
 	}
+	b.scope()
 	c := dbCache{
 		database:   b.database,
 		table:      b.tableName,
@@ -447,8 +486,11 @@ func (b *Builder[T]) One() (T, error) {
 		limit:      b.limit,
 		page:       b.page,
 		args:       fmt.Sprintf("%v", b.args...),
+		relations:  strings.Join(b.joins, ",") + "|" + strings.Join(b.preloads, ","),
+		group:      groupKey(b.groupBys, b.having, b.havingArgs, b.distinct || b.manyJoin),
 	}
-	if UseCache {
+	cached := UseCache && !inTx(b.tx, b.ctx, b.database)
+	if cached {
 		if v, ok := cachesOneS.Get(c); ok {
 			return v.(T), nil
 		}
@@ -458,15 +500,15 @@ func (b *Builder[T]) One() (T, error) {
 		return *new(T), errors.New("unable to find model, try orm.LinkModel before")
 	}
 
-	if b.selected != "" && b.selected != "*" {
-		b.statement = "select " + b.selected + " from " + b.tableName
-	} else {
-		b.statement = "select * from " + b.tableName
+	if b.err != nil {
+		return *new(T), b.err
 	}
+	b.statement = b.selectFrom()
 
 	if b.whereQuery != "" {
 		b.statement += " WHERE " + b.whereQuery
 	}
+	b.statement += b.groupHaving()
 
 	if b.query != "" {
 		b.limit = 0
@@ -488,11 +530,17 @@ func (b *Builder[T]) One() (T, error) {
 		logger.Debug("args:", b.args)
 	}
 
-	models, err := b.queryS(b.statement, b.args...)
+	models, err := b.queryS(b.statement, b.queryArgs()...)
 	if err != nil {
 		return *new(T), err
 	}
-	if UseCache {
+	if err := b.preload(models[:1]); err != nil {
+		return *new(T), err
+	}
+	if err := b.afterFind(models[:1]); err != nil {
+		return *new(T), err
+	}
+	if cached {
 		cachesOneS.Set(c, models[0])
 	}
 	return models[0], nil
@@ -511,11 +559,11 @@ func (b *Builder[T]) queryS(query string, args ...any) ([]T, error) {
 	res := make([]T, 0)
 
 	var rows *sql.Rows
-	if b.ctx != nil {
-		rows, err = db.Conn.QueryContext(b.ctx, query, args...)
-	} else {
-		rows, err = db.Conn.Query(query, args...)
+	exec, ctx, err := conn(b.tx, b.ctx, db)
+	if err != nil {
+		return nil, err
 	}
+	rows, err = exec.QueryContext(ctx, query, args...)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no data found")
@@ -524,6 +572,20 @@ func (b *Builder[T]) queryS(query string, args ...any) ([]T, error) {
 	}
 	defer rows.Close()
 
+	if hasRelations[T]() {
+		values, _, err := scanModels(rows, reflect.TypeOf(*new(T)), db.Dialect, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			res = append(res, v.Interface().(T))
+		}
+		if len(res) == 0 {
+			return nil, errors.New("no data found")
+		}
+		return res, nil
+	}
+
 	var cols []string
 	if b.selected != "" && b.selected != "*" {
 		cols = strings.Split(b.selected, ",")
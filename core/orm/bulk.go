@@ -0,0 +1,410 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// MaxParams is the number of placeholders allowed in a statement by each dialect, InsertMany and Upsert
+// split rows into batches to stay under it
+var MaxParams = map[string]int{
+	SQLITE:   32766,
+	POSTGRES: 65535,
+	MYSQL:    65535,
+	MARIA:    65535,
+}
+
+// upsert is the conflict clause of an insert, update empty update the inserted columns but conflict, doing nothing if none is left
+type upsert struct {
+	conflict []string
+	update   []string
+}
+
+// InsertMany insert models using multi-row VALUES, in batches sized to the parameter limit of the dialect,
+// batches run in a transaction, it return the ids of inserted rows,
+// on MySQL and MariaDB they are computed from the last insert id, auto increments of a statement being consecutive
+func (b *Builder[T]) InsertMany(models []T) ([]int64, error) {
+	return b.insertMany(models, nil)
+}
+
+// Upsert insert models, updating update_comma_separated columns of rows conflicting on conflict_comma_separated,
+// using ON CONFLICT DO UPDATE on SQLite and Postgres and ON DUPLICATE KEY UPDATE on MySQL and MariaDB, where
+// the conflict target is any unique key. An empty update_comma_separated update all inserted columns but the conflict target,
+// conflicting rows being left as is if there is none. Conflict and update columns must be columns of the table, else ErrUnknownColumn is returned.
+// It return the ids of inserted or updated rows on SQLite and Postgres, and nil on MySQL and MariaDB
+//
+//	ids, err := orm.Model[models.User]().Upsert("email", "is_admin", users...)
+func (b *Builder[T]) Upsert(conflict_comma_separated, update_comma_separated string, models ...T) ([]int64, error) {
+	up := &upsert{conflict: splitColumns(conflict_comma_separated)}
+	if len(up.conflict) == 0 {
+		return nil, errors.New("upsert need a conflict target")
+	}
+	up.update = splitColumns(update_comma_separated)
+	return b.insertMany(models, up)
+}
+
+func (b *Builder[T]) insertMany(models []T, up *upsert) ([]int64, error) {
+	if b.tableName == "" {
+		tName := getTableName[T]()
+		if tName == "" {
+			return nil, errors.New("unable to find tableName from model, restart the app if you just migrated")
+		}
+		b.tableName = tName
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if len(models) == 0 {
+		return nil, nil
+	}
+	if !b.hooking && hasModelHook[T](BEFORE_INSERT, AFTER_INSERT) {
+		var ids []int64
+		err := b.withHooks(BEFORE_INSERT, AFTER_INSERT, func() ([]*T, error) {
+			ms := make([]*T, len(models))
+			for i := range models {
+				ms[i] = &models[i]
+			}
+			return ms, nil
+		}, func() (err error) {
+			ids, err = b.insertMany(models, up)
+			return err
+		})
+		return ids, err
+	}
+	db, err := GetMemoryDatabase(b.database)
+	if logger.CheckError(err) {
+		return nil, err
+	}
+	// conflict and update columns are written in the statement
+	if up != nil {
+		if err := checkColumns(db.Name, b.tableName, append(append([]string{}, up.conflict...), up.update...)...); err != nil {
+			return nil, err
+		}
+	}
+	publishCache(b.tx, b.ctx, "create", b.tableName, b.database)
+
+	names, _, _, mtags := getStructInfos(&models[0])
+	pk := ""
+	for i, name := range names {
+		if utils.SliceContains(mtags[name], "autoinc", "pk") || (strings.Contains(name, "id") && i == 0) {
+			pk = name
+			break
+		}
+	}
+	// the primary key is generated by the database, unless it is the conflict target
+	cols := []string{}
+	for _, name := range names {
+		if name != pk || (up != nil && utils.SliceContains(up.conflict, pk)) {
+			cols = append(cols, name)
+		}
+	}
+	rows := make([][]any, 0, len(models))
+	for i := range models {
+		_, values, _, _ := getStructInfos(&models[i])
+		row := make([]any, 0, len(cols))
+		for _, col := range cols {
+			row = append(row, softDeleteValue(mtags[col], values[col]))
+		}
+		rows = append(rows, row)
+	}
+	returning := ""
+	typ := reflect.TypeOf(*new(T))
+	if idx, ok := columnsOf(typ)[pk]; ok && strings.Contains(typ.Field(idx).Type.Kind().String(), "int") {
+		returning = pk
+	}
+	return insertRows(b.tx, b.ctx, db, b.tableName, returning, cols, rows, up, b.debug)
+}
+
+// InsertMany insert rows using multi-row VALUES, in batches sized to the parameter limit of the dialect,
+// rows are grouped by columns, batches run in a transaction, it return the ids of inserted rows group after group if the table has an integer primary key,
+// on MySQL and MariaDB they are computed from the last insert id, auto increments of a statement being consecutive
+func (b *BuilderM) InsertMany(rows []map[string]any) ([]int64, error) {
+	return b.insertMany(rows, nil)
+}
+
+// Upsert insert rows, updating update_comma_separated columns of rows conflicting on conflict_comma_separated,
+// like Builder[T].Upsert
+//
+//	ids, err := orm.Table("settings").Upsert("key", "value", map[string]any{"key": "theme", "value": "dark"})
+func (b *BuilderM) Upsert(conflict_comma_separated, update_comma_separated string, rows ...map[string]any) ([]int64, error) {
+	up := &upsert{conflict: splitColumns(conflict_comma_separated)}
+	if len(up.conflict) == 0 {
+		return nil, errors.New("upsert need a conflict target")
+	}
+	up.update = splitColumns(update_comma_separated)
+	return b.insertMany(rows, up)
+}
+
+func (b *BuilderM) insertMany(rows []map[string]any, up *upsert) ([]int64, error) {
+	if b.tableName == "" {
+		return nil, errors.New("unable to find table, try db.Table before")
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if !b.hooking && hasTableHook(b.tableName, BEFORE_INSERT, AFTER_INSERT) {
+		var ids []int64
+		err := b.withHooks(BEFORE_INSERT, AFTER_INSERT, func() ([]map[string]any, error) {
+			return rows, nil
+		}, func() (err error) {
+			ids, err = b.insertMany(rows, up)
+			return err
+		})
+		return ids, err
+	}
+	db, err := GetMemoryDatabase(b.database)
+	if logger.CheckError(err) {
+		return nil, err
+	}
+	// map keys are written in the statement, only columns of the table are accepted
+	cols := []string{}
+	seen := map[string]bool{}
+	if up != nil {
+		cols = append(append(cols, up.conflict...), up.update...)
+	}
+	for _, row := range rows {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				cols = append(cols, col)
+			}
+		}
+	}
+	if err := checkColumns(db.Name, b.tableName, cols...); err != nil {
+		return nil, err
+	}
+	publishCache(b.tx, b.ctx, "create", b.tableName, b.database)
+
+	returning := ""
+	pk := "id"
+	if t, err := GetMemoryTable(b.tableName, db.Name); err == nil && t.Pk != "" {
+		pk = t.Pk
+	}
+	if ty, ok := GetAllColumnsTypes(b.tableName, db.Name)[pk]; ok && strings.Contains(strings.ToLower(ty), "int") {
+		returning = pk
+	}
+
+	// rows with the same columns are inserted together
+	groups := map[string][][]any{}
+	keys := []string{}
+	for _, row := range rows {
+		cols := make([]string, 0, len(row))
+		for col := range row {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		key := strings.Join(cols, ",")
+		values := make([]any, 0, len(cols))
+		for _, col := range cols {
+			values = append(values, row[col])
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], values)
+	}
+	if len(keys) == 1 {
+		return insertRows(b.tx, b.ctx, db, b.tableName, returning, strings.Split(keys[0], ","), groups[keys[0]], up, b.debug)
+	}
+	ids := []int64{}
+	err = runInTx(b.tx, b.ctx, db, func(tx *Tx) error {
+		for _, key := range keys {
+			res, err := insertRows(tx, tx.ctx, db, b.tableName, returning, strings.Split(key, ","), groups[key], up, b.debug)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, res...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// insertRows insert rows in batches, returning the values of the column returning
+func insertRows(tx *Tx, ctx context.Context, db *DatabaseEntity, table, returning string, cols []string, rows [][]any, up *upsert, debug bool) ([]int64, error) {
+	if len(cols) == 0 {
+		return nil, errors.New("no columns to insert")
+	}
+	max := MaxParams[db.Dialect]
+	if max == 0 {
+		max = MaxParams[SQLITE]
+	}
+	size := max / len(cols)
+	if size == 0 {
+		return nil, fmt.Errorf("%d columns exceed the parameters limit of %s", len(cols), db.Dialect)
+	}
+	if up != nil && (db.Dialect == MYSQL || db.Dialect == MARIA) {
+		// the last insert id of an upsert is not the first inserted row
+		returning = ""
+	}
+
+	run := func(tx *Tx, ctx context.Context) ([]int64, error) {
+		ids := []int64{}
+		for start := 0; start < len(rows); start += size {
+			end := start + size
+			if end > len(rows) {
+				end = len(rows)
+			}
+			batch := rows[start:end]
+			statement := insertStatement(db.Dialect, table, returning, cols, len(batch), up)
+			args := make([]any, 0, len(batch)*len(cols))
+			for _, row := range batch {
+				if len(row) != len(cols) {
+					return nil, errors.New("fields and fields_values doesn't have the same length")
+				}
+				args = append(args, row...)
+			}
+			if debug {
+				logger.Debug("statement:", statement)
+				logger.Debug("args:", args)
+			}
+			exec, ctx, err := conn(tx, ctx, db)
+			if err != nil {
+				return nil, err
+			}
+			if returning == "" || db.Dialect == MYSQL || db.Dialect == MARIA {
+				res, err := exec.ExecContext(ctx, statement, args...)
+				if err != nil {
+					if Debug {
+						logger.Info(statement, args)
+						logger.Error(err)
+					}
+					return nil, err
+				}
+				if returning != "" {
+					first, err := res.LastInsertId()
+					if err != nil {
+						return nil, err
+					}
+					for i := range batch {
+						ids = append(ids, first+int64(i))
+					}
+				}
+				continue
+			}
+			rs, err := exec.QueryContext(ctx, statement, args...)
+			if err != nil {
+				if Debug {
+					logger.Info(statement, args)
+					logger.Error(err)
+				}
+				return nil, err
+			}
+			for rs.Next() {
+				var id int64
+				if err := rs.Scan(&id); err != nil {
+					rs.Close()
+					return nil, err
+				}
+				ids = append(ids, id)
+			}
+			err = rs.Err()
+			rs.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if returning == "" {
+			return nil, nil
+		}
+		return ids, nil
+	}
+
+	if len(rows) <= size {
+		return run(tx, ctx)
+	}
+	var ids []int64
+	err := runInTx(tx, ctx, db, func(tx *Tx) error {
+		var err error
+		ids, err = run(tx, tx.ctx)
+		return err
+	})
+	return ids, err
+}
+
+// insertStatement build a multi-row insert of n rows for dialect
+func insertStatement(dialect, table, returning string, cols []string, n int, up *upsert) string {
+	row := "(" + placeholders(len(cols)) + ")"
+	stat := strings.Builder{}
+	stat.WriteString("INSERT INTO " + table + " (" + strings.Join(cols, ",") + ") VALUES ")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			stat.WriteString(",")
+		}
+		stat.WriteString(row)
+	}
+	if up != nil {
+		update := up.update
+		if len(update) == 0 {
+			for _, col := range cols {
+				if !utils.SliceContains(up.conflict, col) {
+					update = append(update, col)
+				}
+			}
+		}
+		sets := make([]string, 0, len(update))
+		switch dialect {
+		case MYSQL, MARIA:
+			for _, col := range update {
+				sets = append(sets, col+" = VALUES("+col+")")
+			}
+			if len(sets) == 0 {
+				// MySQL has no DO NOTHING, updating a column to itself ignore the row
+				sets = append(sets, up.conflict[0]+" = "+up.conflict[0])
+			}
+			stat.WriteString(" ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "))
+		default:
+			for _, col := range update {
+				sets = append(sets, col+" = excluded."+col)
+			}
+			stat.WriteString(" ON CONFLICT (" + strings.Join(up.conflict, ",") + ")")
+			if len(sets) == 0 {
+				stat.WriteString(" DO NOTHING")
+			} else {
+				stat.WriteString(" DO UPDATE SET " + strings.Join(sets, ", "))
+			}
+		}
+	}
+	if returning != "" && dialect != MYSQL && dialect != MARIA {
+		stat.WriteString(" RETURNING " + returning)
+	}
+	statement := stat.String()
+	adaptPlaceholdersToDialect(&statement, dialect)
+	return statement
+}
+
+// runInTx run fn in the transaction of the builder, or in a new one
+func runInTx(tx *Tx, ctx context.Context, db *DatabaseEntity, fn func(tx *Tx) error) error {
+	t, err := txFrom(tx, ctx, db.Name)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		return t.Transaction(fn)
+	}
+	return Transaction(ctx, db.Name, fn)
+}
+
+func splitColumns(comma_separated string) []string {
+	cols := []string{}
+	for _, c := range strings.Split(comma_separated, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
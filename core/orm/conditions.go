@@ -0,0 +1,327 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/settings"
+)
+
+var columnRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// emptyInRegex match the operand and IN or NOT IN before the placeholder of an empty slice
+var emptyInRegex = regexp.MustCompile(`(?i)[^\s(),]+\s+(NOT\s+)?IN\s*\(\s*$`)
+
+// ErrUnknownColumn is returned when a condition use a column not found in the table
+var ErrUnknownColumn = errors.New("unknown column")
+
+// Condition is a condition of WhereCond, values are always given as args, built with Eq, Ne, Gt, Gte, Lt, Lte,
+// Like, In, NotIn, IsNull, NotNull, And, Or and Not
+//
+//	orm.Table("users").WhereCond(orm.Or(orm.Like("email", "%@example.com"), orm.In("id", []int{1, 2, 3})))
+type Condition struct {
+	op     string
+	column string
+	value  any
+	conds  []Condition
+}
+
+func Eq(column string, value any) Condition {
+	return Condition{op: "=", column: column, value: value}
+}
+
+func Ne(column string, value any) Condition {
+	return Condition{op: "<>", column: column, value: value}
+}
+
+func Gt(column string, value any) Condition {
+	return Condition{op: ">", column: column, value: value}
+}
+
+func Gte(column string, value any) Condition {
+	return Condition{op: ">=", column: column, value: value}
+}
+
+func Lt(column string, value any) Condition {
+	return Condition{op: "<", column: column, value: value}
+}
+
+func Lte(column string, value any) Condition {
+	return Condition{op: "<=", column: column, value: value}
+}
+
+func Like(column string, value any) Condition {
+	return Condition{op: "LIKE", column: column, value: value}
+}
+
+// In match column in values, a slice or an array
+func In(column string, values any) Condition {
+	return Condition{op: "IN", column: column, value: values}
+}
+
+// NotIn match column not in values, a slice or an array
+func NotIn(column string, values any) Condition {
+	return Condition{op: "NOT IN", column: column, value: values}
+}
+
+func IsNull(column string) Condition {
+	return Condition{op: "IS NULL", column: column}
+}
+
+func NotNull(column string) Condition {
+	return Condition{op: "IS NOT NULL", column: column}
+}
+
+// And match if all conds match, and all rows without conds
+func And(conds ...Condition) Condition {
+	return Condition{op: "AND", conds: conds}
+}
+
+// Or match if one of conds match, and no rows without conds
+func Or(conds ...Condition) Condition {
+	return Condition{op: "OR", conds: conds}
+}
+
+func Not(cond Condition) Condition {
+	return Condition{op: "NOT", conds: []Condition{cond}}
+}
+
+// Build return the sql of the condition with ? placeholders and its args, columns are checked using valid
+func (c Condition) Build(valid func(column string) bool) (string, []any, error) {
+	switch c.op {
+	case "AND", "OR":
+		if len(c.conds) == 0 {
+			if c.op == "AND" {
+				return "1 = 1", nil, nil
+			}
+			return "1 = 0", nil, nil
+		}
+		parts := make([]string, 0, len(c.conds))
+		args := []any{}
+		for _, cond := range c.conds {
+			q, a, err := cond.Build(valid)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, "("+q+")")
+			args = append(args, a...)
+		}
+		return strings.Join(parts, " "+c.op+" "), args, nil
+	case "NOT":
+		q, a, err := c.conds[0].Build(valid)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + q + ")", a, nil
+	case "":
+		return "", nil, errors.New("empty condition")
+	}
+
+	if !columnRegex.MatchString(c.column) || (valid != nil && !valid(c.column)) {
+		return "", nil, fmt.Errorf("%w: %q", ErrUnknownColumn, c.column)
+	}
+	switch c.op {
+	case "IS NULL", "IS NOT NULL":
+		return c.column + " " + c.op, nil, nil
+	case "IN", "NOT IN":
+		values, ok := sliceValues(c.value)
+		if !ok {
+			return "", nil, fmt.Errorf("%s %s need a slice, got %T", c.column, c.op, c.value)
+		}
+		if len(values) == 0 {
+			if c.op == "IN" {
+				return "1 = 0", nil, nil
+			}
+			return "1 = 1", nil, nil
+		}
+		return c.column + " " + c.op + " (" + placeholders(len(values)) + ")", values, nil
+	}
+	if c.value == nil {
+		switch c.op {
+		case "=":
+			return c.column + " IS NULL", nil, nil
+		case "<>":
+			return c.column + " IS NOT NULL", nil, nil
+		}
+	}
+	return c.column + " " + c.op + " ?", []any{c.value}, nil
+}
+
+// WhereCond add conds to the where clause of the builder using AND, columns are checked against the columns of the table and
+// of joined relations, use Database and Where before WhereCond, Where after WhereCond is an error
+//
+//	orm.Model[Post]().Join("Author").WhereCond(orm.Eq("author.email", email), orm.Gt("rel_posts.views", 10)).All()
+func (b *Builder[T]) WhereCond(conds ...Condition) *Builder[T] {
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	tables := map[string]string{b.tableName: b.tableName}
+	for alias, table := range b.joinTables {
+		tables[alias] = table
+	}
+	query, args, err := And(conds...).Build(columnValidator(b.database, b.tableName, tables))
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.whereQuery = andWhere(b.whereQuery, query)
+	b.args = append(b.args, args...)
+	b.order = append(b.order, "where")
+	b.conds = true
+	return b
+}
+
+// WhereCond add conds to the where clause of the builder using AND, columns are checked against the columns of the table,
+// use Database and Where before WhereCond, Where after WhereCond is an error
+//
+//	orm.Table("users").WhereCond(orm.Eq("is_admin", true), orm.In("id", ids)).All()
+func (b *BuilderM) WhereCond(conds ...Condition) *BuilderM {
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	query, args, err := And(conds...).Build(columnValidator(b.database, b.tableName, map[string]string{b.tableName: b.tableName}))
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.whereQuery = andWhere(b.whereQuery, query)
+	b.args = append(b.args, args...)
+	b.order = append(b.order, "where")
+	b.conds = true
+	return b
+}
+
+// andWhere join where and query with AND, any of them being possibly empty
+func andWhere(where, query string) string {
+	if where == "" {
+		return query
+	}
+	if query == "" {
+		return where
+	}
+	return "(" + where + ") AND (" + query + ")"
+}
+
+// TableColumns return the columns of a table, from memory or from the database
+func TableColumns(table string, dbName ...string) []string {
+	dName := settings.Config.Db.Name
+	if len(dbName) > 0 && dbName[0] != "" {
+		dName = dbName[0]
+	}
+	if t, err := GetMemoryTable(table, dName); err == nil && len(t.Columns) > 0 {
+		return t.Columns
+	}
+	cols := []string{}
+	for col := range GetAllColumnsTypes(table, dName) {
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// columnValidator return a function checking columns, unqualified columns belong to table,
+// qualified ones to the table of their prefix in tables
+func columnValidator(database, table string, tables map[string]string) func(string) bool {
+	known := map[string][]string{}
+	return func(column string) bool {
+		t, col := table, column
+		if i := strings.Index(column, "."); i > 0 {
+			t, col = column[:i], column[i+1:]
+			var ok bool
+			if t, ok = tables[t]; !ok {
+				return false
+			}
+		}
+		if _, ok := known[t]; !ok {
+			known[t] = TableColumns(t, database)
+		}
+		for _, c := range known[t] {
+			if c == col {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// checkColumns return ErrUnknownColumn for the first of cols not being a column of table, for names written in statements
+func checkColumns(database, table string, cols ...string) error {
+	valid := columnValidator(database, table, nil)
+	for _, col := range cols {
+		if !columnRegex.MatchString(col) || !valid(col) {
+			return fmt.Errorf("%w: %q", ErrUnknownColumn, col)
+		}
+	}
+	return nil
+}
+
+// expandArgs replace the placeholder of slice args by one placeholder per value, for IN (?)
+func expandArgs(query string, args []any) (string, []any) {
+	expand := false
+	for _, a := range args {
+		if _, ok := sliceValues(a); ok {
+			expand = true
+			break
+		}
+	}
+	if !expand || strings.Count(query, "?") != len(args) {
+		return query, args
+	}
+	parts := strings.Split(query, "?")
+	res := make([]any, 0, len(args))
+	q := strings.Builder{}
+	for i, a := range args {
+		values, ok := sliceValues(a)
+		if !ok {
+			q.WriteString(parts[i] + "?")
+			res = append(res, a)
+			continue
+		}
+		if len(values) > 0 {
+			q.WriteString(parts[i] + placeholders(len(values)))
+			res = append(res, values...)
+			continue
+		}
+		// like Condition.Build, 'x IN (?)' become false and 'x NOT IN (?)' true, NOT IN (NULL) would match no rows
+		next := strings.TrimLeft(parts[i+1], " ")
+		if m := emptyInRegex.FindStringSubmatchIndex(parts[i]); m != nil && strings.HasPrefix(next, ")") {
+			q.WriteString(parts[i][:m[0]])
+			if m[2] >= 0 {
+				q.WriteString("1 = 1")
+			} else {
+				q.WriteString("1 = 0")
+			}
+			parts[i+1] = next[1:]
+			continue
+		}
+		// IN (NULL) match no rows
+		q.WriteString(parts[i] + "NULL")
+	}
+	q.WriteString(parts[len(parts)-1])
+	return q.String(), res
+}
+
+// sliceValues return the values of a slice or an array, []byte being a value
+func sliceValues(v any) ([]any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if _, ok := v.([]byte); ok {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
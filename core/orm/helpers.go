@@ -28,6 +28,8 @@ type dbCache struct {
 	offset     string
 	statement  string
 	args       string
+	relations  string
+	group      string
 }
 
 // LinkModel link a struct model to a  db_table_name
@@ -1091,6 +1093,9 @@ func getStructInfos[T comparable](strctt *T) (fields []string, fValues map[strin
 	s := reflect.ValueOf(strctt).Elem()
 	typeOfT := s.Type()
 	for i := 0; i < s.NumField(); i++ {
+		if isRelationField(typeOfT.Field(i)) {
+			continue
+		}
 		f := s.Field(i)
 		fname := typeOfT.Field(i).Name
 		fname = utils.ToSnakeCase(fname)
@@ -1131,6 +1136,7 @@ func handleCache(data map[string]string) {
 			cachesAllS.Flush()
 			cachesOneM.Flush()
 			cachesOneS.Flush()
+			cachesAggregate.Flush()
 		}()
 	case "drop":
 		go func() {
@@ -1142,6 +1148,7 @@ func handleCache(data map[string]string) {
 			cachesAllS.Flush()
 			cachesOneM.Flush()
 			cachesOneS.Flush()
+			cachesAggregate.Flush()
 		}()
 	case "clean":
 		go func() {
@@ -1151,6 +1158,7 @@ func handleCache(data map[string]string) {
 			cachesAllS.Flush()
 			cachesOneM.Flush()
 			cachesOneS.Flush()
+			cachesAggregate.Flush()
 		}()
 	default:
 		logger.Info("CACHE DB: default case triggered", data)
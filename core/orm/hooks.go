@@ -0,0 +1,348 @@
+package orm
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// events of hooks, see AddHook
+const (
+	BEFORE_INSERT = "before_insert"
+	AFTER_INSERT  = "after_insert"
+	BEFORE_UPDATE = "before_update"
+	AFTER_UPDATE  = "after_update"
+	BEFORE_DELETE = "before_delete"
+	AFTER_DELETE  = "after_delete"
+	AFTER_FIND    = "after_find"
+)
+
+// BeforeInserter is implemented by models run before Insert, InsertMany, Upsert and Save, an error abort the insert
+//
+//	func (u *User) BeforeInsert(ctx context.Context) error {
+//		u.Email = strings.ToLower(u.Email)
+//		return nil
+//	}
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInserter is implemented by models run after insert, an error roll back the insert
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdater is implemented by models run before Update and Save, an error abort the update
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdater is implemented by models run after update, an error roll back the update
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleter is implemented by models run before Delete and ForceDelete on each deleted row, an error abort the delete
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter is implemented by models run after delete on each deleted row, an error roll back the delete
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// AfterFinder is implemented by models run on each model returned by All, One, Paginate, Rows and Each,
+// cached models are returned as they were after AfterFind
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+// Hook is a hook of a table, before hooks can change row
+type Hook func(ctx context.Context, row map[string]any) error
+
+var (
+	tableHooks   = map[string]map[string][]Hook{}
+	muTableHooks sync.RWMutex
+)
+
+// AddHook add fn to the hooks of event for table, run by BuilderM like models hooks are run by Builder[T], so admin writes run them.
+// Hooks of insert get the inserted row, hooks of update the updated columns, hooks of delete and find the rows deleted or found
+//
+//	orm.AddHook(orm.BEFORE_INSERT, "users", func(ctx context.Context, row map[string]any) error {
+//		if email, ok := row["email"].(string); ok {
+//			row["email"] = strings.ToLower(email)
+//		}
+//		return nil
+//	})
+func AddHook(event, table string, fn Hook) {
+	muTableHooks.Lock()
+	defer muTableHooks.Unlock()
+	if tableHooks[table] == nil {
+		tableHooks[table] = map[string][]Hook{}
+	}
+	tableHooks[table][event] = append(tableHooks[table][event], fn)
+}
+
+// ClearHooks remove the hooks of table, all of them if no events given
+func ClearHooks(table string, events ...string) {
+	muTableHooks.Lock()
+	defer muTableHooks.Unlock()
+	if len(events) == 0 {
+		delete(tableHooks, table)
+		return
+	}
+	for _, e := range events {
+		delete(tableHooks[table], e)
+	}
+}
+
+func hasTableHook(table string, events ...string) bool {
+	muTableHooks.RLock()
+	defer muTableHooks.RUnlock()
+	for _, e := range events {
+		if len(tableHooks[table][e]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func runTableHooks(ctx context.Context, table, event string, rows ...map[string]any) error {
+	muTableHooks.RLock()
+	hooks := append([]Hook{}, tableHooks[table][event]...)
+	muTableHooks.RUnlock()
+	for _, row := range rows {
+		for _, h := range hooks {
+			if err := h(ctx, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasModelHook[T comparable](events ...string) bool {
+	m := any(new(T))
+	for _, e := range events {
+		var ok bool
+		switch e {
+		case BEFORE_INSERT:
+			_, ok = m.(BeforeInserter)
+		case AFTER_INSERT:
+			_, ok = m.(AfterInserter)
+		case BEFORE_UPDATE:
+			_, ok = m.(BeforeUpdater)
+		case AFTER_UPDATE:
+			_, ok = m.(AfterUpdater)
+		case BEFORE_DELETE:
+			_, ok = m.(BeforeDeleter)
+		case AFTER_DELETE:
+			_, ok = m.(AfterDeleter)
+		case AFTER_FIND:
+			_, ok = m.(AfterFinder)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func runModelHooks[T comparable](ctx context.Context, event string, models ...*T) error {
+	for _, model := range models {
+		var err error
+		m := any(model)
+		switch event {
+		case BEFORE_INSERT:
+			if h, ok := m.(BeforeInserter); ok {
+				err = h.BeforeInsert(ctx)
+			}
+		case AFTER_INSERT:
+			if h, ok := m.(AfterInserter); ok {
+				err = h.AfterInsert(ctx)
+			}
+		case BEFORE_UPDATE:
+			if h, ok := m.(BeforeUpdater); ok {
+				err = h.BeforeUpdate(ctx)
+			}
+		case AFTER_UPDATE:
+			if h, ok := m.(AfterUpdater); ok {
+				err = h.AfterUpdate(ctx)
+			}
+		case BEFORE_DELETE:
+			if h, ok := m.(BeforeDeleter); ok {
+				err = h.BeforeDelete(ctx)
+			}
+		case AFTER_DELETE:
+			if h, ok := m.(AfterDeleter); ok {
+				err = h.AfterDelete(ctx)
+			}
+		case AFTER_FIND:
+			if h, ok := m.(AfterFinder); ok {
+				err = h.AfterFind(ctx)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookContext return the context given to hooks run outside of writes
+func hookContext(tx *Tx, ctx context.Context) context.Context {
+	if tx != nil {
+		return tx.ctx
+	}
+	if ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// withHooks run before hooks on the models, op and after hooks in the transaction of the builder, or in a new one,
+// so an error of a hook roll back op
+func (b *Builder[T]) withHooks(before, after string, models func() ([]*T, error), op func() error) error {
+	db, err := GetMemoryDatabase(b.database)
+	if err != nil {
+		return err
+	}
+	parent := b.tx
+	defer func() {
+		b.tx, b.hooking = parent, false
+	}()
+	return runInTx(b.tx, b.ctx, db, func(tx *Tx) error {
+		b.tx, b.hooking = tx, true
+		ms, err := models()
+		if err != nil {
+			return err
+		}
+		if err := runModelHooks(tx.ctx, before, ms...); err != nil {
+			return err
+		}
+		if err := op(); err != nil {
+			return err
+		}
+		return runModelHooks(tx.ctx, after, ms...)
+	})
+}
+
+// afterFind run AfterFind on models
+func (b *Builder[T]) afterFind(models []T) error {
+	if b.hooking || !hasModelHook[T](AFTER_FIND) {
+		return nil
+	}
+	ctx := hookContext(b.tx, b.ctx)
+	for i := range models {
+		if err := runModelHooks(ctx, AFTER_FIND, &models[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching return the models matching the where clause of the builder
+func (b *Builder[T]) matching() ([]*T, error) {
+	c := *b
+	c.preloads, c.selected, c.orderBys, c.limit, c.page = nil, "", "", 0, 0
+	c.args = append([]any{}, b.args...)
+	models, err := c.All()
+	if err != nil {
+		if err.Error() == "no data found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := make([]*T, len(models))
+	for i := range models {
+		res[i] = &models[i]
+	}
+	return res, nil
+}
+
+// withHooks run before hooks of the table on rows, op and after hooks in the transaction of the builder, or in a new one,
+// so an error of a hook roll back op
+func (b *BuilderM) withHooks(before, after string, rows func() ([]map[string]any, error), op func() error) error {
+	db, err := GetMemoryDatabase(b.database)
+	if err != nil {
+		return err
+	}
+	parent := b.tx
+	defer func() {
+		b.tx, b.hooking = parent, false
+	}()
+	return runInTx(b.tx, b.ctx, db, func(tx *Tx) error {
+		b.tx, b.hooking = tx, true
+		rs, err := rows()
+		if err != nil {
+			return err
+		}
+		if err := runTableHooks(tx.ctx, b.tableName, before, rs...); err != nil {
+			return err
+		}
+		if err := op(); err != nil {
+			return err
+		}
+		return runTableHooks(tx.ctx, b.tableName, after, rs...)
+	})
+}
+
+// afterFind run the AFTER_FIND hooks of the table on rows
+func (b *BuilderM) afterFind(rows []map[string]any) error {
+	if b.hooking || !hasTableHook(b.tableName, AFTER_FIND) {
+		return nil
+	}
+	return runTableHooks(hookContext(b.tx, b.ctx), b.tableName, AFTER_FIND, rows...)
+}
+
+// matching return the rows matching the where clause of the builder
+func (b *BuilderM) matching() ([]map[string]any, error) {
+	c := *b
+	c.selected, c.orderBys, c.limit, c.page = "", "", 0, 0
+	c.args = append([]any{}, b.args...)
+	rows, err := c.All()
+	if err != nil {
+		if err.Error() == "no data found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rows, nil
+}
+
+// rowOf return the row of the fields and values given to Insert
+func rowOf(fields []string, values []any) map[string]any {
+	row := make(map[string]any, len(fields))
+	for i, f := range fields {
+		row[strings.TrimSpace(f)] = values[i]
+	}
+	return row
+}
+
+// fieldsOf return the fields and values of row, fields keeping their order and new fields being sorted
+func fieldsOf(row map[string]any, fields []string) ([]string, []any) {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if _, ok := row[f]; ok && !seen[f] {
+			seen[f] = true
+			res = append(res, f)
+		}
+	}
+	added := []string{}
+	for f := range row {
+		if !seen[f] {
+			added = append(added, f)
+		}
+	}
+	sort.Strings(added)
+	res = append(res, added...)
+	values := make([]any, len(res))
+	for i, f := range res {
+		values[i] = row[f]
+	}
+	return res, values
+}
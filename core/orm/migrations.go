@@ -0,0 +1,624 @@
+package orm
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/eventbus"
+)
+
+const (
+	MIGRATIONS_TABLE      = "schema_migrations"
+	MIGRATIONS_LOCK_TABLE = "schema_migrations_lock"
+	// a migration file containing this comment run outside of a transaction, for statements like CREATE INDEX CONCURRENTLY
+	MIGRATION_NO_TX = "-- kago:notx"
+)
+
+var (
+	// ErrMigrationLocked is returned when another instance is migrating the database
+	ErrMigrationLocked = errors.New("migrations locked by another instance")
+	// ErrMigrationChanged is returned by Up when the up file of an applied migration changed
+	ErrMigrationChanged = errors.New("applied migration changed")
+	// ErrNoDownMigration is returned by Down when the down file of a migration is missing
+	ErrNoDownMigration = errors.New("no down migration")
+)
+
+var (
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_\-]+)\.(up|down)\.sql$`)
+	migrationNameRegex = regexp.MustCompile(`[^a-z0-9_]+`)
+	dollarTagRegex     = regexp.MustCompile(`^\$[a-zA-Z0-9_]*\$`)
+)
+
+// lock key of postgres advisory locks, 'kago' in hex
+const migrationsAdvisoryKey = 0x6b61676f
+
+// Migration is a versioned migration, from the files VERSION_NAME.up.sql and VERSION_NAME.down.sql
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus is the state of a migration in the database
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Changed is true if the up file changed since the migration was applied
+	Changed bool
+	// Missing is true if the migration is applied but its files are gone
+	Missing bool
+}
+
+// Migrations run the versioned migrations of a folder or an fs.FS, applied ones are stored in the table schema_migrations
+type Migrations struct {
+	fsys     fs.FS
+	database string
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// MigrationsFromDir return the migrations of the folder dir, MIGRATION_FOLDER if empty, on dbName (default database if empty)
+//
+//	applied, err := orm.MigrationsFromDir("").Up(0)
+func MigrationsFromDir(dir string, dbName ...string) *Migrations {
+	if dir == "" {
+		dir = MIGRATION_FOLDER
+	}
+	return MigrationsFromFS(os.DirFS(dir), dbName...)
+}
+
+// MigrationsFromFS return the migrations at the root of fsys on dbName (default database if empty), to embed them in the binary
+//
+//	//go:embed migrations/*.sql
+//	var migrationsFS embed.FS
+//
+//	sub, _ := fs.Sub(migrationsFS, "migrations")
+//	_, err := orm.MigrationsFromFS(sub).Up(0)
+func MigrationsFromFS(fsys fs.FS, dbName ...string) *Migrations {
+	dName := settings.Config.Db.Name
+	if len(dbName) > 0 && dbName[0] != "" {
+		dName = dbName[0]
+	}
+	return &Migrations{
+		fsys:     fsys,
+		database: dName,
+	}
+}
+
+// List return the migrations found, sorted by version
+func (m *Migrations) List() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		match := migrationFileRegex.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(m.fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by %s and %s", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.Up = string(b)
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	res := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		res = append(res, *mig)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// Status return the state of all migrations, found or applied, sorted by version
+func (m *Migrations) Status() ([]MigrationStatus, error) {
+	db, err := GetMemoryDatabase(m.database)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := createMigrationsTables(ctx, db.Conn); err != nil {
+		return nil, err
+	}
+	migs, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db.Conn)
+	if err != nil {
+		return nil, err
+	}
+	return migrationsStatus(migs, applied), nil
+}
+
+// Up apply the n first pending migrations in order of version, all of them if n <= 0, and return the applied ones.
+// It fail with ErrMigrationChanged if the up file of an applied migration changed
+func (m *Migrations) Up(n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(ctx context.Context, c *sql.Conn, db *DatabaseEntity) error {
+		migs, err := m.List()
+		if err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(ctx, c)
+		if err != nil {
+			return err
+		}
+		for _, s := range migrationsStatus(migs, applied) {
+			if s.Changed {
+				return fmt.Errorf("%w: %d_%s", ErrMigrationChanged, s.Version, s.Name)
+			}
+		}
+		for _, mig := range migs {
+			if n > 0 && len(done) == n {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, c, db.Dialect, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down roll back the n last applied migrations, the last one if n <= 0, and return the rolled back ones
+func (m *Migrations) Down(n int) ([]Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+	var done []Migration
+	err := m.locked(func(ctx context.Context, c *sql.Conn, db *DatabaseEntity) error {
+		migs, err := m.List()
+		if err != nil {
+			return err
+		}
+		found := make(map[int64]Migration, len(migs))
+		for _, mig := range migs {
+			found[mig.Version] = mig
+		}
+		applied, err := appliedMigrations(ctx, c)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		for _, v := range versions {
+			if len(done) == n {
+				break
+			}
+			mig, ok := found[v]
+			if !ok || strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, v, applied[v].name)
+			}
+			if err := runMigration(ctx, c, db.Dialect, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Redo roll back the last applied migration and apply it again, with the current content of its files
+func (m *Migrations) Redo() (*Migration, error) {
+	var redone *Migration
+	err := m.locked(func(ctx context.Context, c *sql.Conn, db *DatabaseEntity) error {
+		migs, err := m.List()
+		if err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(ctx, c)
+		if err != nil {
+			return err
+		}
+		var last int64 = -1
+		for v := range applied {
+			if v > last {
+				last = v
+			}
+		}
+		if last < 0 {
+			return errors.New("no migration applied")
+		}
+		for i := range migs {
+			if migs[i].Version == last {
+				redone = &migs[i]
+			}
+		}
+		if redone == nil || strings.TrimSpace(redone.Down) == "" {
+			redone = nil
+			return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, last, applied[last].name)
+		}
+		if err := runMigration(ctx, c, db.Dialect, *redone, false); err != nil {
+			return err
+		}
+		return runMigration(ctx, c, db.Dialect, *redone, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redone, nil
+}
+
+// Unlock remove the lock left by an instance killed while migrating a sqlite database,
+// locks of postgres and mysql are released with the connection
+func (m *Migrations) Unlock() error {
+	db, err := GetMemoryDatabase(m.database)
+	if err != nil {
+		return err
+	}
+	if db.Dialect != SQLITE {
+		return nil
+	}
+	_, err = db.Conn.Exec("DELETE FROM " + MIGRATIONS_LOCK_TABLE)
+	return err
+}
+
+// CreateMigration create the files of a new migration in dir, MIGRATION_FOLDER if empty, numbered after the last one,
+// and return their paths
+//
+//	up, down, err := orm.CreateMigration("", "add posts")
+//	// migrations/0001_add_posts.up.sql, migrations/0001_add_posts.down.sql
+func CreateMigration(dir, name string) (string, string, error) {
+	if dir == "" {
+		dir = MIGRATION_FOLDER
+	}
+	name = strings.Trim(migrationNameRegex.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return "", "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var last int64
+	for _, e := range entries {
+		if match := migrationFileRegex.FindStringSubmatch(e.Name()); match != nil {
+			if v, err := strconv.ParseInt(match[1], 10, 64); err == nil && v > last {
+				last = v
+			}
+		}
+	}
+	prefix := fmt.Sprintf("%04d_%s", last+1, name)
+	up := filepath.Join(dir, prefix+".up.sql")
+	down := filepath.Join(dir, prefix+".down.sql")
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0660); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- revert "+name+"\n"), 0660); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// locked run fn with a connection holding the migrations lock of the database, and clean the cache after
+func (m *Migrations) locked(fn func(ctx context.Context, c *sql.Conn, db *DatabaseEntity) error) error {
+	db, err := GetMemoryDatabase(m.database)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := createMigrationsTables(ctx, db.Conn); err != nil {
+		return err
+	}
+	c, err := db.Conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	unlock, err := lockMigrations(ctx, c, db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer func() {
+		if UseCache {
+			eventbus.Publish(CACHE_TOPIC, map[string]string{
+				"type": "clean",
+			})
+		}
+	}()
+	return fn(ctx, c, db)
+}
+
+// lockMigrations take the migrations lock using an advisory lock on postgres and mysql, and a row of MIGRATIONS_LOCK_TABLE on sqlite
+func lockMigrations(ctx context.Context, c *sql.Conn, db *DatabaseEntity) (func(), error) {
+	var ok bool
+	switch db.Dialect {
+	case POSTGRES:
+		if err := c.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationsAdvisoryKey).Scan(&ok); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrMigrationLocked
+		}
+		return func() {
+			_, _ = c.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationsAdvisoryKey)
+		}, nil
+	case MYSQL, MARIA:
+		name := "kago_migrations_" + db.Name
+		var got sql.NullInt64
+		if err := c.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&got); err != nil {
+			return nil, err
+		}
+		if got.Int64 != 1 {
+			return nil, ErrMigrationLocked
+		}
+		return func() {
+			_, _ = c.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		}, nil
+	default:
+		query := "INSERT INTO " + MIGRATIONS_LOCK_TABLE + " (id, locked_at) VALUES (?, ?)"
+		adaptPlaceholdersToDialect(&query, db.Dialect)
+		if _, err := c.ExecContext(ctx, query, 1, time.Now()); err != nil {
+			if isUniqueViolation(err) {
+				return nil, ErrMigrationLocked
+			}
+			return nil, err
+		}
+		return func() {
+			_, _ = c.ExecContext(ctx, "DELETE FROM "+MIGRATIONS_LOCK_TABLE)
+		}, nil
+	}
+}
+
+// isUniqueViolation report if err is a unique or primary key violation, the lock row being already taken
+func isUniqueViolation(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint") || strings.Contains(msg, "duplicate")
+}
+
+// runMigration run the up or down sql of mig and record it, in a transaction unless the dialect commit DDL
+// statements itself (mysql and mariadb) or the file contain MIGRATION_NO_TX
+func runMigration(ctx context.Context, c *sql.Conn, dialect string, mig Migration, up bool) error {
+	query := mig.Down
+	record := "DELETE FROM " + MIGRATIONS_TABLE + " WHERE version = ?"
+	args := []any{mig.Version}
+	if up {
+		query = mig.Up
+		record = "INSERT INTO " + MIGRATIONS_TABLE + " (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"
+		args = append(args, mig.Name, mig.Checksum, time.Now())
+	}
+	adaptPlaceholdersToDialect(&record, dialect)
+
+	exec := func(e executor) error {
+		for _, statement := range splitStatements(query) {
+			if _, err := e.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		_, err := e.ExecContext(ctx, record, args...)
+		return err
+	}
+	if dialect == MYSQL || dialect == MARIA || strings.Contains(query, MIGRATION_NO_TX) {
+		return exec(c)
+	}
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := exec(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func createMigrationsTables(ctx context.Context, conn *sql.DB) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+MIGRATIONS_TABLE+" (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum VARCHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)")
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+MIGRATIONS_LOCK_TABLE+" (id INTEGER PRIMARY KEY, locked_at TIMESTAMP NOT NULL)")
+	return err
+}
+
+func appliedMigrations(ctx context.Context, e executor) (map[int64]appliedMigration, error) {
+	rows, err := e.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM "+MIGRATIONS_TABLE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[int64]appliedMigration{}
+	for rows.Next() {
+		var a appliedMigration
+		var at any
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &at); err != nil {
+			return nil, err
+		}
+		switch v := at.(type) {
+		case time.Time:
+			a.appliedAt = v
+		case string:
+			a.appliedAt, _ = time.Parse("2006-01-02 15:04:05.999999999-07:00", v)
+		case []byte:
+			a.appliedAt, _ = time.Parse("2006-01-02 15:04:05", string(v))
+		}
+		res[a.version] = a
+	}
+	return res, rows.Err()
+}
+
+func migrationsStatus(migs []Migration, applied map[int64]appliedMigration) []MigrationStatus {
+	res := make([]MigrationStatus, 0, len(migs))
+	found := make(map[int64]bool, len(migs))
+	for _, mig := range migs {
+		found[mig.Version] = true
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+			s.Changed = a.checksum != mig.Checksum
+		}
+		res = append(res, s)
+	}
+	for v, a := range applied {
+		if !found[v] {
+			res = append(res, MigrationStatus{Version: v, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res
+}
+
+// splitStatements split query on semicolons outside of quotes, line and block comments, postgres dollar quoted bodies
+// and BEGIN ... END bodies of CREATE TRIGGER, PROCEDURE, FUNCTION and EVENT, statements being only comments are dropped
+func splitStatements(query string) []string {
+	res := []string{}
+	var cur strings.Builder
+	// first is the first word of the statement, depth the BEGIN and CASE blocks opened in a compound statement
+	first, compound, depth, hasCode := "", false, 0, false
+	add := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" && hasCode {
+			res = append(res, s)
+		}
+		cur.Reset()
+		first, compound, depth, hasCode = "", false, 0, false
+	}
+	// skip write query[i:end] and move i to the last byte written
+	skip := func(i *int, end int) {
+		cur.WriteString(query[*i:end])
+		*i = end - 1
+	}
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			hasCode = true
+			end := strings.IndexByte(query[i+1:], ch)
+			if end < 0 {
+				skip(&i, len(query))
+				continue
+			}
+			skip(&i, i+end+2)
+			continue
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			skip(&i, i+end)
+			continue
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				skip(&i, len(query))
+				continue
+			}
+			skip(&i, i+end+4)
+			continue
+		case ch == '$':
+			if tag := dollarTagRegex.FindString(query[i:]); tag != "" {
+				hasCode = true
+				end := strings.Index(query[i+len(tag):], tag)
+				if end < 0 {
+					end = len(query) - i - len(tag)
+				} else {
+					end += len(tag)
+				}
+				skip(&i, i+len(tag)+end)
+				continue
+			}
+		case isWordByte(ch) && (i == 0 || !isWordByte(query[i-1])):
+			hasCode = true
+			end := i
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			switch word := strings.ToUpper(query[i:end]); {
+			case first == "":
+				first = word
+			case first == "CREATE" && !compound && (word == "TRIGGER" || word == "PROCEDURE" || word == "FUNCTION" || word == "EVENT"):
+				compound = true
+			case compound && (word == "BEGIN" || word == "CASE"):
+				depth++
+			case depth > 0 && word == "END":
+				// END IF, END LOOP, END WHILE and END REPEAT close blocks that were not counted
+				next := strings.TrimLeft(query[end:], " \t\r\n")
+				n := 0
+				for n < len(next) && isWordByte(next[n]) {
+					n++
+				}
+				switch strings.ToUpper(next[:n]) {
+				case "IF", "LOOP", "WHILE", "REPEAT":
+				default:
+					depth--
+				}
+			}
+			skip(&i, end)
+			continue
+		case ch == ';' && depth == 0:
+			add()
+			continue
+		}
+		if ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n' {
+			hasCode = true
+		}
+		cur.WriteByte(ch)
+	}
+	add()
+	return res
+}
+
+func isWordByte(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
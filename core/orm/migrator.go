@@ -20,6 +20,30 @@ func Migrate() error {
 	if logger.CheckError(err) {
 		return err
 	}
+	err = AutoMigrate[models.UserTotp]("users_totp", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
+	err = AutoMigrate[models.RecoveryCode]("users_recovery_codes", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
+	err = AutoMigrate[models.LoginAttempt]("login_attempts", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
+	err = AutoMigrate[models.LoginLockout]("login_lockouts", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
+	err = AutoMigrate[models.Identity]("users_identities", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
+	err = AutoMigrate[models.AutocertCache]("autocert_cache", settings.Config.Db.Name)
+	if logger.CheckError(err) {
+		return err
+	}
 	return nil
 }
 
@@ -129,6 +153,9 @@ func autoMigrate[T comparable](db *DatabaseEntity, tableName string, execute boo
 	pk := ""
 
 	for i := 0; i < s.NumField(); i++ {
+		if isRelationField(typeOfT.Field(i)) {
+			continue
+		}
 		f := s.Field(i)
 		fname := typeOfT.Field(i).Name
 		fname = utils.ToSnakeCase(fname)
@@ -372,7 +399,7 @@ func AutoMigrate[T comparable](tableName string, dbName ...string) error {
 	}
 	
 	tbFoundDB := false
-	tables := GetAllTables(dbname)
+	tables := databaseTables(dbname, db.Dialect)
 	for _, t := range tables {
 		if t == tableName {
 			tbFoundDB = true
@@ -989,6 +1016,8 @@ func handleMigrationTime(mi *migrationInput) {
 				default:
 					logger.Error("not handled Time for ", mi.fName, mi.fType)
 				}
+			case "softdelete":
+				// NULL until the row is deleted
 			case "index", "+index", "index+":
 				*mi.indexes = append(*mi.indexes, mi.fName)
 			case "-index", "index-":
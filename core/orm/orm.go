@@ -90,14 +90,14 @@ func InitDB() error {
 		}
 		settings.Config.Db.Type=MARIA
 	case SQLITE, "sqlite3":
-		dsn = settings.Config.Db.Name + ".sqlite?_pragma=foreign_keys(1)"
+		dsn = settings.Config.Db.Name + ".sqlite?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
 		if settings.Config.Db.Name == "" {
-			dsn = "db.sqlite?_pragma=foreign_keys(1)"
+			dsn = "db.sqlite?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
 		}
 	default:
-		dsn = settings.Config.Db.Name + ".sqlite?_pragma=foreign_keys(1)"
+		dsn = settings.Config.Db.Name + ".sqlite?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
 		if settings.Config.Db.Name == "" {
-			dsn = "db.sqlite?_pragma=foreign_keys(1)"
+			dsn = "db.sqlite?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
 		}
 	}
 	isMariaDb := settings.Config.Db.Type==MARIA || settings.Config.Db.Type=="mariadb"
@@ -200,10 +200,16 @@ func NewDatabaseFromDSN(dbType, dbName string, dbDSN ...string) error {
 			dsn = "db.sqlite"
 		}
 	}
-	if dbType == SQLITE {
-		dsn += "?_pragma=foreign_keys(1)"
+	if dbType == SQLITE || dbType == "" {
+		dsn += "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	}
+	dialect := dbType
+	switch dbType {
+	case "":
+		dialect, dbType = SQLITE, SQLITE
+	case "mariadb":
+		dialect = MARIA
 	}
-	
 	if dbType == MARIA || dbType == "mariadb" {
 		dbType="mysql"
 	}
@@ -216,16 +222,9 @@ func NewDatabaseFromDSN(dbType, dbName string, dbDSN ...string) error {
 		logger.Info("check if env is loaded", dsn)
 		return err
 	}
-	for _, dbb := range databases {
-		if dbb.Name == dbName {
-			if err := conn.Close(); err != nil {
-				logger.Error(err)
-			}
-			return errors.New("another database with the same name already registered")
-		}
+	if err := registerDatabase(dbName, dialect, conn); err != nil {
+		return err
 	}
-	mDbNameConnection[dbName] = conn
-	mDbNameDialect[dbName] = dbType
 	conn.SetMaxOpenConns(10)
 	conn.SetMaxIdleConns(5)
 	conn.SetConnMaxLifetime(3 * time.Hour)
@@ -241,6 +240,22 @@ func NewDatabaseFromConnection(dbType, dbName string, conn *sql.DB) error {
 	if logger.CheckError(err) {
 		return err
 	}
+	if dbType == "mariadb" {
+		settings.Config.Db.Type=MARIA
+		dbType = MARIA
+	}
+	if err := registerDatabase(dbName, dbType, conn); err != nil {
+		return err
+	}
+	conn.SetMaxOpenConns(10)
+	conn.SetMaxIdleConns(5)
+	conn.SetConnMaxLifetime(30 * time.Minute)
+	conn.SetConnMaxIdleTime(10 * time.Second)
+	return nil
+}
+
+// registerDatabase add conn to databases under dbName, so GetMemoryDatabase and builders find it, conn is closed if dbName is already registered
+func registerDatabase(dbName, dialect string, conn *sql.DB) error {
 	for _, dbb := range databases {
 		if dbb.Name == dbName {
 			if err := conn.Close(); err != nil {
@@ -249,15 +264,14 @@ func NewDatabaseFromConnection(dbType, dbName string, conn *sql.DB) error {
 			return errors.New("another database with the same name already registered")
 		}
 	}
-	if dbType == "mariadb" {
-		settings.Config.Db.Type=MARIA
-	}
+	databases = append(databases, DatabaseEntity{
+		Name:    dbName,
+		Conn:    conn,
+		Dialect: dialect,
+		Tables:  []TableEntity{},
+	})
 	mDbNameConnection[dbName] = conn
-	mDbNameDialect[dbName] = dbType
-	conn.SetMaxOpenConns(10)
-	conn.SetMaxIdleConns(5)
-	conn.SetConnMaxLifetime(30 * time.Minute)
-	conn.SetConnMaxIdleTime(10 * time.Second)
+	mDbNameDialect[dbName] = dialect
 	return nil
 }
 
@@ -324,13 +338,26 @@ func GetAllTables(dbName ...string) []string {
 		}
 	}
 
-	conn := GetConnection(name)
+	tables = databaseTables(name, settings.Config.Db.Type)
+	if tables == nil {
+		return nil
+	}
+	if UseCache {
+		cacheGetAllTables.Set(name, tables)
+	}
+	return tables
+}
+
+// databaseTables query the tables of dbName from the database, without the memory tables linked so far
+func databaseTables(dbName, dialect string) []string {
+	conn := GetConnection(dbName)
 	if conn == nil {
 		logger.Error("connection is null")
 		return nil
 	}
 	
-	switch settings.Config.Db.Type {
+	tables := []string{}
+	switch dialect {
 	case POSTGRES:
 		rows, err := conn.Query(`SELECT tablename FROM pg_catalog.pg_tables WHERE schemaname NOT IN ('pg_catalog','information_schema','crdb_internal','pg_extension') AND tableowner != 'node'`)
 		if logger.CheckError(err) {
@@ -346,7 +373,7 @@ func GetAllTables(dbName ...string) []string {
 			tables = append(tables, table)
 		}
 	case MYSQL,MARIA:
-		rows, err := conn.Query("SELECT table_name,table_schema FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND table_schema ='" + name + "'")
+		rows, err := conn.Query("SELECT table_name,table_schema FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND table_schema ='" + dbName + "'")
 		if logger.CheckError(err) {
 			return nil
 		}
@@ -378,9 +405,6 @@ func GetAllTables(dbName ...string) []string {
 		logger.Error("database type not supported, should be sqlite, postgres or mysql")
 		os.Exit(0)
 	}
-	if UseCache {
-		cacheGetAllTables.Set(name, tables)
-	}
 	return tables
 }
 
@@ -0,0 +1,428 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+	"github.com/kamalshkeir/kstrct"
+)
+
+const (
+	BELONGS_TO   = "belongs_to"
+	HAS_MANY     = "has_many"
+	MANY_TO_MANY = "many_to_many"
+)
+
+var (
+	cacheRelations   = map[reflect.Type][]relation{}
+	cacheRelationsMu sync.RWMutex
+)
+
+// relation is a field of a model declared with a belongs_to, has_many or many_to_many tag, models being comparable,
+// belongs_to fields are pointers to a model, has_many and many_to_many fields are pointers to a slice of models
+//
+//	type Post struct {
+//		Id       uint   `orm:"autoinc"`
+//		AuthorId uint   `orm:"fk:users.id:cascade"`
+//		Title    string `orm:"size:100"`
+//		Author   *User  `orm:"belongs_to:author_id"`
+//		Comments *[]Comment `orm:"has_many:post_id"`
+//		Tags     *[]Tag `orm:"many_to_many:posts_tags.post_id.tag_id"`
+//	}
+type relation struct {
+	name  string
+	alias string
+	kind  string
+	field int
+	elem  reflect.Type
+	// fk is the column of the model for belongs_to, and the column of the related model for has_many
+	fk string
+	// join table, its column referencing the model and its column referencing the related model for many_to_many
+	joinTable string
+	ownerCol  string
+	otherCol  string
+}
+
+// isRelation return true if the tags of a field declare a relation, these fields are not columns
+func isRelation(tags []string) bool {
+	for _, t := range tags {
+		k := strings.TrimSpace(strings.Split(t, ":")[0])
+		if k == BELONGS_TO || k == HAS_MANY || k == MANY_TO_MANY {
+			return true
+		}
+	}
+	return false
+}
+
+func isRelationField(f reflect.StructField) bool {
+	tag, ok := f.Tag.Lookup("orm")
+	return ok && isRelation(strings.Split(tag, ";"))
+}
+
+// relationsOf return the relations declared on the struct typ
+func relationsOf(typ reflect.Type) ([]relation, error) {
+	cacheRelationsMu.RLock()
+	rels, ok := cacheRelations[typ]
+	cacheRelationsMu.RUnlock()
+	if ok {
+		return rels, nil
+	}
+	rels = []relation{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !isRelationField(f) {
+			continue
+		}
+		rel := relation{name: f.Name, alias: utils.ToSnakeCase(f.Name), field: i}
+		for _, t := range strings.Split(f.Tag.Get("orm"), ";") {
+			sp := strings.Split(strings.TrimSpace(t), ":")
+			switch sp[0] {
+			case BELONGS_TO, HAS_MANY, MANY_TO_MANY:
+				rel.kind = sp[0]
+				if len(sp) > 1 {
+					rel.fk = strings.TrimSpace(sp[1])
+				}
+			}
+		}
+		switch rel.kind {
+		case BELONGS_TO:
+			if f.Type.Kind() != reflect.Pointer || f.Type.Elem().Kind() != reflect.Struct {
+				return nil, fmt.Errorf("relation %s: belongs_to field should be a pointer to a model", f.Name)
+			}
+			if rel.fk == "" {
+				rel.fk = rel.alias + "_id"
+			}
+		case HAS_MANY, MANY_TO_MANY:
+			if f.Type.Kind() != reflect.Pointer || f.Type.Elem().Kind() != reflect.Slice || f.Type.Elem().Elem().Kind() != reflect.Struct {
+				return nil, fmt.Errorf("relation %s: %s field should be a pointer to a slice of models", f.Name, rel.kind)
+			}
+			if rel.fk == "" {
+				return nil, fmt.Errorf("relation %s: %s need a column, like %s:post_id", f.Name, rel.kind, rel.kind)
+			}
+		}
+		if rel.kind == MANY_TO_MANY {
+			sp := strings.Split(rel.fk, ".")
+			if len(sp) != 3 {
+				return nil, fmt.Errorf("relation %s: it should be many_to_many:join_table.owner_column.related_column", f.Name)
+			}
+			rel.joinTable, rel.ownerCol, rel.otherCol = sp[0], sp[1], sp[2]
+			rel.fk = ""
+		}
+		rel.elem = f.Type.Elem()
+		if rel.elem.Kind() == reflect.Slice {
+			rel.elem = rel.elem.Elem()
+		}
+		rels = append(rels, rel)
+	}
+	cacheRelationsMu.Lock()
+	cacheRelations[typ] = rels
+	cacheRelationsMu.Unlock()
+	return rels, nil
+}
+
+func relationOf(typ reflect.Type, name string) (relation, error) {
+	rels, err := relationsOf(typ)
+	if err != nil {
+		return relation{}, err
+	}
+	for _, r := range rels {
+		if r.name == name || r.alias == name {
+			return r, nil
+		}
+	}
+	return relation{}, fmt.Errorf("relation %s not found on %s", name, typ.Name())
+}
+
+// tableOf return the table name of a migrated or linked model type
+func tableOf(typ reflect.Type) (string, error) {
+	if v, ok := mModelTablename[reflect.Zero(typ).Interface()]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("model %s is not linked, execute orm.AutoMigrate before", typ.Name())
+}
+
+// pkOf return the primary key column of a model type
+func pkOf(typ reflect.Type) string {
+	for i := 0; i < typ.NumField(); i++ {
+		if tag, ok := typ.Field(i).Tag.Lookup("orm"); ok {
+			for _, t := range strings.Split(tag, ";") {
+				if t = strings.TrimSpace(t); t == "pk" || t == "autoinc" {
+					return utils.ToSnakeCase(typ.Field(i).Name)
+				}
+			}
+		}
+	}
+	return "id"
+}
+
+// columnsOf return the field index of each column of a model type
+func columnsOf(typ reflect.Type) map[string]int {
+	cols := make(map[string]int, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		if !isRelationField(typ.Field(i)) {
+			cols[utils.ToSnakeCase(typ.Field(i).Name)] = i
+		}
+	}
+	return cols
+}
+
+// Preload load relations of the returned models, with one IN query per relation
+//
+//	posts, err := orm.Model[Post]().Where("published = ?", true).Preload("Author", "Tags").All()
+func (b *Builder[T]) Preload(relations ...string) *Builder[T] {
+	b.preloads = append(b.preloads, relations...)
+	return b
+}
+
+// Join join related tables to filter on their columns, the related table is named after the relation in snake case
+//
+//	posts, err := orm.Model[Post]().Join("Author").Where("author.email = ?", email).All()
+func (b *Builder[T]) Join(relations ...string) *Builder[T] {
+	return b.join("JOIN", relations...)
+}
+
+// LeftJoin is like Join, but keep models without related rows
+func (b *Builder[T]) LeftJoin(relations ...string) *Builder[T] {
+	return b.join("LEFT JOIN", relations...)
+}
+
+func (b *Builder[T]) join(kind string, relations ...string) *Builder[T] {
+	typ := reflect.TypeOf(*new(T))
+	for _, name := range relations {
+		rel, err := relationOf(typ, name)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		table, err := tableOf(rel.elem)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		pk := pkOf(typ)
+		if b.joinTables == nil {
+			b.joinTables = map[string]string{}
+		}
+		b.joinTables[rel.alias] = table
+		if rel.kind == MANY_TO_MANY {
+			b.joinTables[rel.joinTable] = rel.joinTable
+		}
+		switch rel.kind {
+		case BELONGS_TO:
+			b.joins = append(b.joins, kind+" "+table+" AS "+rel.alias+" ON "+rel.alias+"."+pkOf(rel.elem)+" = "+b.tableName+"."+rel.fk)
+		case HAS_MANY:
+			b.joins = append(b.joins, kind+" "+table+" AS "+rel.alias+" ON "+rel.alias+"."+rel.fk+" = "+b.tableName+"."+pk)
+			b.manyJoin = true
+		case MANY_TO_MANY:
+			b.joins = append(b.joins, kind+" "+rel.joinTable+" ON "+rel.joinTable+"."+rel.ownerCol+" = "+b.tableName+"."+pk)
+			b.joins = append(b.joins, kind+" "+table+" AS "+rel.alias+" ON "+rel.alias+"."+pkOf(rel.elem)+" = "+rel.joinTable+"."+rel.otherCol)
+			b.manyJoin = true
+		}
+	}
+	return b
+}
+
+// selectFrom return the select statement of the builder, with its joins
+func (b *Builder[T]) selectFrom() string {
+	selected := "*"
+	if b.selected != "" && b.selected != "*" {
+		selected = b.selected
+	} else if len(b.joins) > 0 {
+		selected = b.tableName + ".*"
+	}
+	if b.distinct || b.manyJoin {
+		selected = "DISTINCT " + selected
+	}
+	stat := "select " + selected + " from " + b.tableName
+	if len(b.joins) > 0 {
+		stat += " " + strings.Join(b.joins, " ")
+	}
+	return stat
+}
+
+// preload load the relations of the builder into models
+func (b *Builder[T]) preload(models []T) error {
+	if len(b.preloads) == 0 || len(models) == 0 {
+		return nil
+	}
+	db, err := GetMemoryDatabase(b.database)
+	if err != nil {
+		return err
+	}
+	typ := reflect.TypeOf(*new(T))
+	cols := columnsOf(typ)
+	pk := pkOf(typ)
+	for _, name := range b.preloads {
+		rel, err := relationOf(typ, name)
+		if err != nil {
+			return err
+		}
+		table, err := tableOf(rel.elem)
+		if err != nil {
+			return err
+		}
+		// key column of the models, matched against the rows of the relation
+		key := pk
+		if rel.kind == BELONGS_TO {
+			key = rel.fk
+		}
+		idx, ok := cols[key]
+		if !ok {
+			return fmt.Errorf("relation %s: column %s not found on %s", rel.name, key, typ.Name())
+		}
+		keys := []any{}
+		seen := map[string]bool{}
+		for i := range models {
+			v := reflect.ValueOf(&models[i]).Elem().Field(idx)
+			if v.Kind() == reflect.Pointer {
+				if v.IsNil() {
+					continue
+				}
+				v = v.Elem()
+			}
+			k := fmt.Sprint(v.Interface())
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, v.Interface())
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		in := placeholders(len(keys))
+		var query, owner string
+		switch rel.kind {
+		case BELONGS_TO:
+			owner = pkOf(rel.elem)
+			query = "select * from " + table + " WHERE " + owner + " IN (" + in + ")"
+		case HAS_MANY:
+			owner = rel.fk
+			query = "select * from " + table + " WHERE " + owner + " IN (" + in + ")"
+		case MANY_TO_MANY:
+			owner = "kago_owner"
+			query = "select " + rel.joinTable + "." + rel.ownerCol + " AS kago_owner, " + table + ".* from " + table +
+				" JOIN " + rel.joinTable + " ON " + rel.joinTable + "." + rel.otherCol + " = " + table + "." + pkOf(rel.elem) +
+				" WHERE " + rel.joinTable + "." + rel.ownerCol + " IN (" + in + ")"
+		}
+		// soft deleted rows are not preloaded
+		if cond := trashedCondition(b.database, table, ""); cond != "" {
+			query += " AND " + cond
+		}
+		if b.debug {
+			logger.Debug("statement:", query)
+			logger.Debug("args:", keys)
+		}
+		adaptPlaceholdersToDialect(&query, db.Dialect)
+		exec, ctx, err := conn(b.tx, b.ctx, db)
+		if err != nil {
+			return err
+		}
+		rows, err := exec.QueryContext(ctx, query, keys...)
+		if err != nil {
+			return err
+		}
+		related, owners, err := scanModels(rows, rel.elem, db.Dialect, owner)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		grouped := map[string][]reflect.Value{}
+		for i, r := range related {
+			k := fmt.Sprint(owners[i])
+			grouped[k] = append(grouped[k], r)
+		}
+		for i := range models {
+			m := reflect.ValueOf(&models[i]).Elem()
+			v := m.Field(idx)
+			if v.Kind() == reflect.Pointer {
+				if v.IsNil() {
+					continue
+				}
+				v = v.Elem()
+			}
+			found := grouped[fmt.Sprint(v.Interface())]
+			field := m.Field(rel.field)
+			if rel.kind == BELONGS_TO {
+				if len(found) > 0 {
+					p := reflect.New(rel.elem)
+					p.Elem().Set(found[0])
+					field.Set(p)
+				}
+				continue
+			}
+			s := reflect.MakeSlice(reflect.SliceOf(rel.elem), 0, len(found))
+			s = reflect.Append(s, found...)
+			p := reflect.New(s.Type())
+			p.Elem().Set(s)
+			field.Set(p)
+		}
+	}
+	return nil
+}
+
+// scanModels scan rows into values of the struct typ, filling fields by column name,
+// the values of the column owner are returned for each row
+func scanModels(rows *sql.Rows, typ reflect.Type, dialect, owner string) ([]reflect.Value, []any, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := columnsOf(typ)
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	res := []reflect.Value{}
+	owners := []any{}
+	for rows.Next() {
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := reflect.New(typ).Elem()
+		fillModel(row, fields, columns, values, dialect)
+		var o any
+		for i, col := range columns {
+			if col == owner {
+				o = values[i]
+				if b, ok := o.([]byte); ok {
+					o = string(b)
+				}
+			}
+		}
+		res = append(res, row)
+		owners = append(owners, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return res, owners, nil
+}
+
+// fillModel fill the fields of row from the values of columns
+func fillModel(row reflect.Value, fields map[string]int, columns []string, values []any, dialect string) {
+	for i, col := range columns {
+		v := values[i]
+		if b, ok := v.([]byte); ok && (dialect == MYSQL || dialect == MARIA) {
+			v = string(b)
+		}
+		if idx, ok := fields[col]; ok && v != nil {
+			kstrct.SetReflectFieldValue(row.Field(idx), v)
+		}
+	}
+}
+
+// hasRelations return true if the model T declare relations, its rows are then filled by column name
+func hasRelations[T comparable]() bool {
+	typ := reflect.TypeOf(*new(T))
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	rels, err := relationsOf(typ)
+	return err == nil && len(rels) > 0
+}
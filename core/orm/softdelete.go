@@ -0,0 +1,193 @@
+package orm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/settings"
+)
+
+const (
+	trashedWith = "with"
+	trashedOnly = "only"
+)
+
+// ErrNoSoftDelete is returned by Restore when the table has no column tagged softdelete
+var ErrNoSoftDelete = errors.New("no softdelete column")
+
+// SoftDeleteColumn return the column tagged softdelete of table, empty if the table has none
+//
+//	type Post struct {
+//		Id        uint `orm:"autoinc"`
+//		Title     string
+//		DeletedAt time.Time `orm:"softdelete"`
+//	}
+func SoftDeleteColumn(table string, dbName ...string) string {
+	dName := settings.Config.Db.Name
+	if len(dbName) > 0 && dbName[0] != "" {
+		dName = dbName[0]
+	}
+	t, err := GetMemoryTable(table, dName)
+	if err != nil {
+		return ""
+	}
+	for col, tags := range t.Tags {
+		if hasTag(tags, "softdelete") {
+			return col
+		}
+	}
+	return ""
+}
+
+// WithTrashed include soft deleted rows
+func (b *Builder[T]) WithTrashed() *Builder[T] {
+	b.trashed = trashedWith
+	return b
+}
+
+// OnlyTrashed return only soft deleted rows
+func (b *Builder[T]) OnlyTrashed() *Builder[T] {
+	b.trashed = trashedOnly
+	return b
+}
+
+// Restore restore the soft deleted rows matching Where, update hooks of the model get the restored rows, the soft delete field being zero
+//
+//	_, err := orm.Model[Post]().Where("id = ?", id).Restore()
+func (b *Builder[T]) Restore() (int, error) {
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	col := SoftDeleteColumn(b.tableName, b.database)
+	if col == "" {
+		return 0, ErrNoSoftDelete
+	}
+	b.trashed = trashedOnly
+	if !b.hooking && hasModelHook[T](BEFORE_UPDATE, AFTER_UPDATE) {
+		var n int
+		err := b.withHooks(BEFORE_UPDATE, AFTER_UPDATE, func() ([]*T, error) {
+			models, err := b.matching()
+			if idx, ok := columnsOf(reflect.TypeOf(*new(T)))[col]; ok {
+				for _, m := range models {
+					f := reflect.ValueOf(m).Elem().Field(idx)
+					f.Set(reflect.Zero(f.Type()))
+				}
+			}
+			return models, err
+		}, func() (err error) {
+			n, err = b.Set(col + " = NULL")
+			return err
+		})
+		return n, err
+	}
+	return b.Set(col + " = NULL")
+}
+
+// ForceDelete remove the rows matching Where from the table, soft deleted or not
+func (b *Builder[T]) ForceDelete() (int, error) {
+	if b.trashed == "" {
+		b.trashed = trashedWith
+	}
+	b.force = true
+	return b.Delete()
+}
+
+// scope add the soft delete condition to the where clause, once
+func (b *Builder[T]) scope() {
+	if b.scoped {
+		return
+	}
+	b.scoped = true
+	b.whereQuery = andWhere(b.whereQuery, trashedCondition(b.database, b.tableName, b.trashed))
+}
+
+// WithTrashed include soft deleted rows
+func (b *BuilderM) WithTrashed() *BuilderM {
+	b.trashed = trashedWith
+	return b
+}
+
+// OnlyTrashed return only soft deleted rows
+func (b *BuilderM) OnlyTrashed() *BuilderM {
+	b.trashed = trashedOnly
+	return b
+}
+
+// Restore restore the soft deleted rows matching Where, update hooks of the table get the soft delete column set to nil
+//
+//	_, err := orm.Table("posts").Where("id = ?", id).Restore()
+func (b *BuilderM) Restore() (int, error) {
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	col := SoftDeleteColumn(b.tableName, b.database)
+	if col == "" {
+		return 0, ErrNoSoftDelete
+	}
+	b.trashed = trashedOnly
+	return b.Update(map[string]any{col: nil})
+}
+
+// ForceDelete remove the rows matching Where from the table, soft deleted or not
+func (b *BuilderM) ForceDelete() (int, error) {
+	if b.trashed == "" {
+		b.trashed = trashedWith
+	}
+	b.force = true
+	return b.Delete()
+}
+
+// scope add the soft delete condition to the where clause, once
+func (b *BuilderM) scope() {
+	if b.scoped {
+		return
+	}
+	b.scoped = true
+	b.whereQuery = andWhere(b.whereQuery, trashedCondition(b.database, b.tableName, b.trashed))
+}
+
+// trashedCondition return the condition selecting rows of table depending on trashed, empty without softdelete column
+func trashedCondition(database, table, trashed string) string {
+	if trashed == trashedWith {
+		return ""
+	}
+	col := SoftDeleteColumn(table, database)
+	if col == "" {
+		return ""
+	}
+	if trashed == trashedOnly {
+		return table + "." + col + " IS NOT NULL"
+	}
+	return table + "." + col + " IS NULL"
+}
+
+// softDelete return the set clause and args marking rows as deleted, ok is false if rows should be removed
+func softDelete(database, table string, force bool) (string, []any, bool) {
+	if force {
+		return "", nil, false
+	}
+	col := SoftDeleteColumn(table, database)
+	if col == "" {
+		return "", nil, false
+	}
+	return col + " = ?", []any{time.Now()}, true
+}
+
+// softDeleteValue return nil for the zero value of a softdelete field, so not deleted rows are NULL
+func softDeleteValue(tags []string, v any) any {
+	if hasTag(tags, "softdelete") && isZero(v) {
+		return nil
+	}
+	return v
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
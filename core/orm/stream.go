@@ -0,0 +1,371 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// ErrInvalidCursor is returned by Paginate when the cursor given to After was not returned by Paginate for this query
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Rows iterate the rows of a query one by one, rows are not cached and not loaded in memory, the connection
+// is held until Close
+//
+//	rows, err := orm.Model[models.User]().Where("is_admin = ?", false).Rows()
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		user := rows.Value()
+//	}
+//	return rows.Err()
+type Rows[T any] struct {
+	rows    *sql.Rows
+	columns []string
+	values  []any
+	ptrs    []any
+	scan    func(columns []string, values []any) (T, error)
+	current T
+	err     error
+}
+
+// Next prepare the next row for Value, it return false at the end of the rows or on error
+func (r *Rows[T]) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	for i := range r.values {
+		r.ptrs[i] = &r.values[i]
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		r.err = err
+		return false
+	}
+	r.current, r.err = r.scan(r.columns, r.values)
+	return r.err == nil
+}
+
+// Value return the current row
+func (r *Rows[T]) Value() T {
+	return r.current
+}
+
+// Err return the error that stopped the iteration, if any
+func (r *Rows[T]) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close release the connection, it can be called many times
+func (r *Rows[T]) Close() error {
+	return r.rows.Close()
+}
+
+// Rows return an iterator over the rows of the query, see Each to run a func for each row
+func (b *Builder[T]) Rows() (*Rows[T], error) {
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if b.tableName == "" {
+		return nil, errors.New("error: this model is not linked, execute orm.AutoMigrate before")
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.preloads) > 0 {
+		return nil, errors.New("Preload is not supported by Rows and Each, use Paginate")
+	}
+	b.scope()
+	db, err := GetMemoryDatabase(b.database)
+	if err != nil {
+		return nil, err
+	}
+	statement := listStatement(b.selectFrom(), b.whereQuery, b.groupHaving(), b.query, b.orderBys, b.limit, b.page)
+	if b.debug {
+		logger.Debug("statement:", statement)
+		logger.Debug("args:", b.args)
+	}
+	typ := reflect.TypeOf(*new(T))
+	fields := columnsOf(typ)
+	return queryRows(b.tx, b.ctx, db, statement, b.queryArgs(), func(columns []string, values []any) (T, error) {
+		row := reflect.New(typ).Elem()
+		fillModel(row, fields, columns, values, db.Dialect)
+		model := []T{row.Interface().(T)}
+		err := b.afterFind(model)
+		return model[0], err
+	})
+}
+
+// Each run fn for each row of the query, without loading all rows in memory, it stop at the first error of fn and return it
+//
+//	err := orm.Model[models.User]().OrderBy("id").Each(func(user models.User) error {
+//		return enc.Encode(user)
+//	})
+func (b *Builder[T]) Each(fn func(T) error) error {
+	rows, err := b.Rows()
+	return each(rows, err, fn)
+}
+
+// Rows return an iterator over the rows of the query, see Each to run a func for each row
+func (b *BuilderM) Rows() (*Rows[map[string]any], error) {
+	if b.tableName == "" {
+		return nil, errors.New("unable to find table, try db.Table before")
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.scope()
+	db, err := GetMemoryDatabase(b.database)
+	if err != nil {
+		return nil, err
+	}
+	statement := listStatement(b.selectFrom(), b.whereQuery, b.groupHaving(), b.query, b.orderBys, b.limit, b.page)
+	if b.debug {
+		logger.Debug("statement:", statement)
+		logger.Debug("args:", b.args)
+	}
+	return queryRows(b.tx, b.ctx, db, statement, b.queryArgs(), func(columns []string, values []any) (map[string]any, error) {
+		m := make(map[string]any, len(columns))
+		for i, col := range columns {
+			if v, ok := values[i].([]byte); ok {
+				m[col] = string(v)
+				continue
+			}
+			m[col] = values[i]
+		}
+		return m, b.afterFind([]map[string]any{m})
+	})
+}
+
+// Each run fn for each row of the query, without loading all rows in memory, it stop at the first error of fn and return it
+//
+//	err := orm.Table("logs").Where("created_at < ?", date).Each(func(row map[string]any) error {
+//		return enc.Encode(row)
+//	})
+func (b *BuilderM) Each(fn func(map[string]any) error) error {
+	rows, err := b.Rows()
+	return each(rows, err, fn)
+}
+
+// After set the cursor returned by Paginate, the next page start after it
+func (b *Builder[T]) After(cursor string) *Builder[T] {
+	b.after = cursor
+	return b
+}
+
+// Paginate return Limit models after the cursor given to After and the cursor of the next page, empty on the last page.
+// Models are ordered by the columns of OrderBy then by pk, ordered columns should be fields of the model and not null.
+// Unlike Page, the position is kept by values, so rows inserted or deleted between pages don't shift the results
+//
+//	users, next, err := orm.Model[models.User]().OrderBy("-created_at").Limit(50).After(cursor).Paginate()
+func (b *Builder[T]) Paginate() ([]T, string, error) {
+	if b.err != nil {
+		return nil, "", b.err
+	}
+	if b.limit <= 0 {
+		return nil, "", errors.New("Paginate need a Limit")
+	}
+	if b.page > 0 || b.query != "" || b.groupBys != "" {
+		return nil, "", errors.New("Paginate can't be used with Page, Query or GroupBy")
+	}
+	typ := reflect.TypeOf(*new(T))
+	keys, err := keysetOf(b.orderBys, b.tableName, pkOf(typ), columnsOf(typ))
+	if err != nil {
+		return nil, "", err
+	}
+	if b.after != "" {
+		values, err := decodeCursor(b.after, typ, keys)
+		if err != nil {
+			return nil, "", err
+		}
+		query, args := keysetCondition(b.tableName, keys, values)
+		b.whereQuery = andWhere(b.whereQuery, query)
+		b.args = append(b.args, args...)
+	}
+	orders := make([]string, len(keys))
+	for i, k := range keys {
+		orders[i] = b.tableName + "." + k.column + " ASC"
+		if k.desc {
+			orders[i] = b.tableName + "." + k.column + " DESC"
+		}
+	}
+	b.orderBys = "ORDER BY " + strings.Join(orders, ",")
+	limit := b.limit
+	// one more row tell if there is a next page
+	b.limit = limit + 1
+	models, err := b.All()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(models) <= limit {
+		return models, "", nil
+	}
+	models = models[:limit]
+	next, err := encodeCursor(reflect.ValueOf(models[limit-1]), keys)
+	if err != nil {
+		return nil, "", err
+	}
+	return models, next, nil
+}
+
+type keysetColumn struct {
+	column string
+	field  int
+	desc   bool
+}
+
+// keysetOf return the columns ordering a keyset pagination, the pk is added last if missing
+func keysetOf(orderBys, table, pk string, fields map[string]int) ([]keysetColumn, error) {
+	keys := []keysetColumn{}
+	hasPk := false
+	for _, o := range strings.Split(strings.TrimPrefix(orderBys, "ORDER BY "), ",") {
+		parts := strings.Fields(o)
+		if len(parts) == 0 {
+			continue
+		}
+		col := strings.TrimPrefix(parts[0], table+".")
+		idx, ok := fields[col]
+		if !ok {
+			return nil, fmt.Errorf("Paginate can only order by columns of %s, got %q", table, parts[0])
+		}
+		keys = append(keys, keysetColumn{column: col, field: idx, desc: len(parts) > 1 && strings.EqualFold(parts[1], "DESC")})
+		hasPk = hasPk || col == pk
+	}
+	if !hasPk {
+		idx, ok := fields[pk]
+		if !ok {
+			return nil, fmt.Errorf("Paginate need the pk %s in the model", pk)
+		}
+		keys = append(keys, keysetColumn{column: pk, field: idx})
+	}
+	return keys, nil
+}
+
+// keysetCondition return the condition of rows after values, (a > ?) OR (a = ? AND b > ?) ...
+func keysetCondition(table string, keys []keysetColumn, values []any) (string, []any) {
+	ors := make([]string, len(keys))
+	args := []any{}
+	for i, k := range keys {
+		ands := []string{}
+		for j, prev := range keys[:i] {
+			ands = append(ands, table+"."+prev.column+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if k.desc {
+			op = " < ?"
+		}
+		ands = append(ands, table+"."+k.column+op)
+		args = append(args, values[i])
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	return strings.Join(ors, " OR "), args
+}
+
+func encodeCursor(model reflect.Value, keys []keysetColumn) (string, error) {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i] = model.Field(k.field).Interface()
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor return the values of the cursor, typed like the fields of the keys
+func decodeCursor(cursor string, typ reflect.Type, keys []keysetColumn) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(data, &raws); err != nil || len(raws) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		v := reflect.New(typ.Field(k.field).Type)
+		if err := json.Unmarshal(raws[i], v.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// listStatement return the statement run by All
+func listStatement(selectFrom, whereQuery, groupHaving, query, orderBys string, limit, page int) string {
+	if query != "" {
+		return query
+	}
+	statement := selectFrom
+	if whereQuery != "" {
+		statement += " WHERE " + whereQuery
+	}
+	statement += groupHaving
+	if orderBys != "" {
+		statement += " " + orderBys
+	}
+	if limit > 0 {
+		statement += " LIMIT " + strconv.Itoa(limit)
+		if page > 0 {
+			statement += " OFFSET " + strconv.Itoa((page-1)*limit)
+		}
+	}
+	return statement
+}
+
+func queryRows[T any](tx *Tx, ctx context.Context, db *DatabaseEntity, statement string, args []any, scan func([]string, []any) (T, error)) (*Rows[T], error) {
+	adaptPlaceholdersToDialect(&statement, db.Dialect)
+	exec, ctx, err := conn(tx, ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := exec.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &Rows[T]{
+		rows:    rows,
+		columns: columns,
+		values:  make([]any, len(columns)),
+		ptrs:    make([]any, len(columns)),
+		scan:    scan,
+	}, nil
+}
+
+func each[T any](rows *Rows[T], err error, fn func(T) error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows.Value()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type AggItem struct {
+	Id       uint   `orm:"autoinc"`
+	Category string `orm:"size:20"`
+	Price    int
+}
+
+type categoryTotal struct {
+	Category string
+	Total    int
+	Sum      float64
+}
+
+func resetAggItems(t *testing.T) {
+	t.Helper()
+	items := []AggItem{{Category: "a", Price: 10}, {Category: "a", Price: 20}, {Category: "b", Price: 5}, {Category: "c", Price: 1}, {Category: "c", Price: 2}, {Category: "c", Price: 3}}
+	resetTable(t, "agg_items", items...)
+}
+
+func TestAggregations(t *testing.T) {
+	resetAggItems(t)
+	items := func() *orm.Builder[AggItem] { return orm.Model[AggItem]().Database(otherDB) }
+
+	if n, err := items().Count(); err != nil || n != 6 {
+		t.Errorf("Count: got %d %v", n, err)
+	}
+	if n, err := items().Where("category = ?", "c").Count(); err != nil || n != 3 {
+		t.Errorf("Count with Where: got %d %v", n, err)
+	}
+	if n, err := orm.Table("agg_items").Database(otherDB).Distinct().Select("category").Count(); err != nil || n != 3 {
+		t.Errorf("Count Distinct: got %d %v", n, err)
+	}
+	if ok, err := items().Where("price > ?", 15).Exists(); err != nil || !ok {
+		t.Errorf("Exists: got %v %v", ok, err)
+	}
+	if ok, err := items().Where("price > ?", 100).Exists(); err != nil || ok {
+		t.Errorf("Exists without rows: got %v %v", ok, err)
+	}
+	if sum, err := items().Sum("price"); err != nil || sum != 41 {
+		t.Errorf("Sum: got %v %v", sum, err)
+	}
+	if avg, err := items().Where("category = ?", "a").Avg("price"); err != nil || avg != 15 {
+		t.Errorf("Avg: got %v %v", avg, err)
+	}
+	if sum, err := items().Where("price > ?", 100).Sum("price"); err != nil || sum != 0 {
+		t.Errorf("Sum without rows: got %v %v", sum, err)
+	}
+	if min, err := items().Min("price"); err != nil || min != int64(1) {
+		t.Errorf("Min: got %v %v", min, err)
+	}
+	if max, err := orm.Table("agg_items").Database(otherDB).Max("category"); err != nil || max != "c" {
+		t.Errorf("Max: got %v %v", max, err)
+	}
+	values, err := items().Distinct().OrderBy("-category").Pluck("category")
+	if err != nil || len(values) != 3 || values[0] != "c" {
+		t.Errorf("Pluck: got %v %v", values, err)
+	}
+
+	if n, err := items().GroupBy("category").Having("count(*) > ?", 1).Count(); err != nil || n != 2 {
+		t.Errorf("Count of groups: got %d %v", n, err)
+	}
+	totals := []categoryTotal{}
+	err = items().Select("category", "count(*) AS total", "sum(price) AS sum").Where("price < ?", 20).GroupBy("category").Having("count(*) > ?", 1).OrderBy("category").Scan(&totals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].Category != "c" || totals[0].Total != 3 || totals[0].Sum != 6 {
+		t.Errorf("Scan structs: got %+v", totals)
+	}
+	rows := []map[string]any{}
+	err = orm.Table("agg_items").Database(otherDB).Select("category", "count(*) AS total").GroupBy("category").OrderBy("-total").Limit(1).Scan(&rows)
+	if err != nil || len(rows) != 1 || rows[0]["category"] != "c" {
+		t.Errorf("Scan maps: got %v %v", rows, err)
+	}
+	grouped, err := orm.Table("agg_items").Database(otherDB).Select("category", "max(price) AS top").GroupBy("category").OrderBy("category").All()
+	if err != nil || len(grouped) != 3 || grouped[0]["top"] != int64(20) {
+		t.Errorf("All with GroupBy: got %v %v", grouped, err)
+	}
+	if _, err := items().GroupBy("category").Sum("price"); err == nil {
+		t.Error("Sum of groups should fail")
+	}
+	// grouping comes from GroupBy, not from the text of the where clause
+	if sum, err := items().Where("category <> ' GROUP BY '").Sum("price"); err != nil || sum != 41 {
+		t.Errorf("Sum with GROUP BY in a literal: got %v %v", sum, err)
+	}
+}
+
+func TestAggregationsCache(t *testing.T) {
+	resetAggItems(t)
+	orm.UseCache = true
+	count := func() int64 {
+		n, err := orm.Model[AggItem]().Database(otherDB).Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(); n != 6 {
+		t.Fatal("expected 6, got", n)
+	}
+	// rows inserted outside of the builders are not seen from the cache
+	if err := orm.Exec(otherDB, "INSERT INTO agg_items (category,price) VALUES ('d',1)"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 6 {
+		t.Error("Count should be cached, got", n)
+	}
+	if _, err := orm.Model[AggItem]().Database(otherDB).Insert(&AggItem{Category: "d", Price: 2}); err != nil {
+		t.Fatal(err)
+	}
+	// cache is flushed asynchronously
+	for i := 0; i < 100 && count() != 8; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := count(); n != 8 {
+		t.Error("cache should be flushed after insert, got", n)
+	}
+}
+
+func TestAggregationsWithJoins(t *testing.T) {
+	resetRelations(t)
+	// ann has 2 posts, 2 rows per author in the join
+	n, err := orm.Model[RelAuthor]().Database(otherDB).Join("Posts").Where("posts.title LIKE ?", "%").Count()
+	if err != nil || n != 2 {
+		t.Errorf("authors with posts: got %d %v", n, err)
+	}
+	n, err = orm.Model[RelPost]().Database(otherDB).Join("Author").Where("author.name = ?", "ann").Count()
+	if err != nil || n != 2 {
+		t.Errorf("posts of ann: got %d %v", n, err)
+	}
+}
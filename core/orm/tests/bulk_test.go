@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type BulkItem struct {
+	Id   uint   `orm:"autoinc"`
+	Code string `orm:"unique;size:20"`
+	Name string `orm:"size:50"`
+}
+
+func bulkNames(t *testing.T) map[string]string {
+	t.Helper()
+	rows, err := orm.Model[BulkItem]().Database(otherDB).All()
+	if err != nil && err.Error() != "no data found" {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, r := range rows {
+		names[r.Code] = r.Name
+	}
+	return names
+}
+
+func TestInsertMany(t *testing.T) {
+	resetTable[BulkItem](t, "bulk_items")
+	max := orm.MaxParams[orm.SQLITE]
+	// 2 columns, 2 rows per batch
+	orm.MaxParams[orm.SQLITE] = 5
+	t.Cleanup(func() { orm.MaxParams[orm.SQLITE] = max })
+
+	items := []BulkItem{{Code: "a", Name: "A"}, {Code: "b", Name: "B"}, {Code: "c", Name: "C"}, {Code: "d", Name: "D"}, {Code: "e", Name: "E"}}
+	ids, err := orm.Model[BulkItem]().Database(otherDB).InsertMany(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 5 {
+		t.Fatal("expected 5 ids, got", ids)
+	}
+	for i := range ids {
+		item, err := orm.Model[BulkItem]().Database(otherDB).Where("id = ?", ids[i]).One()
+		if err != nil || item.Code != items[i].Code {
+			t.Errorf("id %d should be %s, got %+v %v", ids[i], items[i].Code, item, err)
+		}
+	}
+
+	// a failing batch roll back the others
+	_, err = orm.Model[BulkItem]().Database(otherDB).InsertMany([]BulkItem{{Code: "f"}, {Code: "g"}, {Code: "a"}})
+	if err == nil {
+		t.Fatal("duplicated code should fail")
+	}
+	if names := bulkNames(t); len(names) != 5 {
+		t.Errorf("failed insert should be rolled back, got %v", names)
+	}
+
+	ids, err = orm.Table("bulk_items").Database(otherDB).InsertMany([]map[string]any{
+		{"code": "f", "name": "F"},
+		{"id": 100, "code": "g", "name": "G"},
+		{"code": "h", "name": "H"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 {
+		t.Error("expected 3 ids, got", ids)
+	}
+	if g, err := orm.Model[BulkItem]().Database(otherDB).Where("id = ?", 100).One(); err != nil || g.Code != "g" {
+		t.Errorf("rows with other columns should be inserted with them, got %+v %v", g, err)
+	}
+	if names := bulkNames(t); len(names) != 8 || names["g"] != "G" || names["h"] != "H" {
+		t.Errorf("bad rows after map insert: %v", names)
+	}
+}
+
+func TestInsertManyUnknownColumns(t *testing.T) {
+	resetTable[BulkItem](t, "bulk_items")
+	items := func() *orm.BuilderM { return orm.Table("bulk_items").Database(otherDB) }
+	for _, col := range []string{"nope", "name) VALUES ('x'); DROP TABLE bulk_items; --", "bulk_items.name"} {
+		if _, err := items().InsertMany([]map[string]any{{"code": "a", "name": "A"}, {"code": "b", col: "B"}}); !errors.Is(err, orm.ErrUnknownColumn) {
+			t.Errorf("InsertMany with column %q: got %v", col, err)
+		}
+	}
+	if _, err := items().Upsert("code", "name, nope", map[string]any{"code": "a", "name": "A"}); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("Upsert with an unknown update column: got %v", err)
+	}
+	if _, err := items().Upsert("code;", "", map[string]any{"code": "a", "name": "A"}); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("Upsert with an invalid conflict column: got %v", err)
+	}
+	models := func() *orm.Builder[BulkItem] { return orm.Model[BulkItem]().Database(otherDB) }
+	if _, err := models().Upsert("code", "name = 'x', id", BulkItem{Code: "a", Name: "A"}); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("Upsert of models with an invalid update column: got %v", err)
+	}
+	if _, err := models().Upsert("nope", "", BulkItem{Code: "a", Name: "A"}); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("Upsert of models with an unknown conflict column: got %v", err)
+	}
+	if names := bulkNames(t); len(names) != 0 {
+		t.Errorf("nothing should be inserted, got %v", names)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	resetTable(t, "bulk_items", BulkItem{Code: "a", Name: "A"}, BulkItem{Code: "b", Name: "B"})
+	ids, err := orm.Model[BulkItem]().Database(otherDB).Upsert("code", "name", BulkItem{Code: "a", Name: "A2"}, BulkItem{Code: "c", Name: "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Error("expected 2 ids, got", ids)
+	}
+	names := bulkNames(t)
+	if len(names) != 3 || names["a"] != "A2" || names["b"] != "B" || names["c"] != "C" {
+		t.Errorf("bad rows after upsert: %v", names)
+	}
+
+	_, err = orm.Table("bulk_items").Database(otherDB).Upsert("code", "", map[string]any{"code": "b", "name": "B2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := bulkNames(t); names["b"] != "B2" {
+		t.Errorf("empty update should update all columns, got %v", names)
+	}
+
+	if _, err := orm.Table("bulk_items").Database(otherDB).Upsert("", "name", map[string]any{"code": "b"}); err == nil {
+		t.Error("upsert without conflict target should fail")
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+func TestConditionBuild(t *testing.T) {
+	cond := orm.Or(orm.And(orm.Eq("name", "a"), orm.In("id", []int{1, 2})), orm.Not(orm.IsNull("note")), orm.Eq("note", nil))
+	query, args, err := cond.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "((name = ?) AND (id IN (?,?))) OR (NOT (note IS NULL)) OR (note IS NULL)"
+	if query != want || len(args) != 3 {
+		t.Errorf("got %q %v", query, args)
+	}
+	if query, _, _ := orm.In("id", []int{}).Build(nil); query != "1 = 0" {
+		t.Errorf("empty In should match nothing, got %q", query)
+	}
+	if _, _, err := orm.Eq("name = 1 OR 1", 1).Build(nil); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("injected column should fail, got %v", err)
+	}
+	if _, _, err := orm.In("id", 3).Build(nil); err == nil {
+		t.Error("In without slice should fail")
+	}
+}
+
+func TestWhereCond(t *testing.T) {
+	resetTable[UpdItem](t, "upd_items")
+	items := []UpdItem{{Name: "a", Views: 1}, {Name: "b", Views: 5}, {Name: "c", Views: 10}}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).InsertMany(items); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := orm.Model[UpdItem]().Database(otherDB).WhereCond(orm.Or(orm.Eq("name", "a"), orm.Gte("views", 10))).OrderBy("name").All()
+	if err != nil || len(got) != 2 || got[1].Name != "c" {
+		t.Errorf("Or: got %+v %v", got, err)
+	}
+	n, err := orm.Model[UpdItem]().Database(otherDB).Where("views > ?", 1).WhereCond(orm.NotIn("name", []string{"c"})).Count()
+	if err != nil || n != 1 {
+		t.Errorf("Where and WhereCond: got %d %v", n, err)
+	}
+	rows, err := orm.Table("upd_items").Database(otherDB).Where("name IN (?) AND views < ?", []string{"a", "b", "c"}, 10).All()
+	if err != nil || len(rows) != 2 {
+		t.Errorf("Where with slice: got %v %v", rows, err)
+	}
+	for query, want := range map[string]int64{
+		"name IN (?) OR views = ?":        1,
+		"name NOT IN (?) AND views > ?":   2,
+		"views > ? AND (name not in( ?))": 3,
+	} {
+		args := []any{[]string{}, 1}
+		if strings.HasPrefix(query, "views") {
+			args = []any{0, []string{}}
+		}
+		if n, err := orm.Model[UpdItem]().Database(otherDB).Where(query, args...).Count(); err != nil || n != want {
+			t.Errorf("Where(%q) with an empty slice: got %d %v, want %d", query, n, err, want)
+		}
+	}
+	if _, err := orm.Table("upd_items").Database(otherDB).WhereCond(orm.Eq("password", "x")).All(); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("unknown column should fail, got %v", err)
+	}
+	// Where replace the clause of WhereCond but not its args
+	if _, err := orm.Model[UpdItem]().Database(otherDB).WhereCond(orm.Eq("name", "c")).Where("views < ?", 10).All(); err == nil {
+		t.Error("Where after WhereCond should fail")
+	}
+	if _, err := orm.Table("upd_items").Database(otherDB).WhereCond(orm.Eq("name", "c")).Where("views < ?", 10).Delete(); err == nil {
+		t.Error("Where after WhereCond should fail")
+	}
+	if n, _ := orm.Model[UpdItem]().Database(otherDB).Count(); n != 3 {
+		t.Errorf("nothing should be deleted, got %d rows", n)
+	}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Where("1 = 1").WhereCond(orm.Eq("name", "a")).Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := orm.Model[UpdItem]().Database(otherDB).Count(); n != 2 {
+		t.Errorf("Delete with WhereCond: got %d rows left", n)
+	}
+}
+
+func TestWhereCondWithJoin(t *testing.T) {
+	resetRelations(t)
+	posts, err := orm.Model[RelPost]().Database(otherDB).Join("Author").WhereCond(orm.Eq("author.name", "ann"), orm.Like("rel_posts.title", "%2")).All()
+	if err != nil || len(posts) != 1 || posts[0].Title != "a2" {
+		t.Errorf("got %+v %v", posts, err)
+	}
+	if _, err := orm.Model[RelPost]().Database(otherDB).WhereCond(orm.Eq("author.name", "ann")).All(); !errors.Is(err, orm.ErrUnknownColumn) {
+		t.Errorf("alias without Join should fail, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+func TestNewDatabaseRegistered(t *testing.T) {
+	// an empty type is sqlite
+	if err := orm.NewDatabaseFromDSN("", "db3", ""); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "conn.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.NewDatabaseFromConnection(orm.SQLITE, "db_conn", conn); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"db3", "db_conn"} {
+		db, err := orm.GetMemoryDatabase(name)
+		if err != nil || db.Conn == nil || db.Dialect != orm.SQLITE {
+			t.Errorf("%s should be registered as sqlite, got %+v %v", name, db, err)
+			continue
+		}
+		if err := orm.Exec(name, "CREATE TABLE IF NOT EXISTS reg_items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orm.Table("reg_items").Database(name).Insert("name", []any{"a"}); err != nil {
+			t.Errorf("builders should use %s: %v", name, err)
+		}
+	}
+	other, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "other.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.NewDatabaseFromConnection(orm.SQLITE, "db_conn", other); err == nil {
+		t.Error("a name registered before should be refused")
+	}
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+// resetTable migrate T as table of otherDB, replace its rows by rows and disable the orm cache until the test end
+func resetTable[T comparable](t *testing.T, table string, rows ...T) {
+	t.Helper()
+	if err := orm.AutoMigrate[T](table, otherDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Exec(otherDB, "DELETE FROM "+table); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) > 0 {
+		if _, err := orm.Model[T]().Database(otherDB).InsertMany(rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disableCache(t)
+}
+
+// disableCache set orm.UseCache to false, the previous value is restored at the test end
+func disableCache(t *testing.T) {
+	t.Helper()
+	useCache := orm.UseCache
+	orm.UseCache = false
+	t.Cleanup(func() { orm.UseCache = useCache })
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type HookItem struct {
+	Id   uint   `orm:"autoinc"`
+	Name string `orm:"size:20"`
+}
+
+var (
+	hookCalls  = map[string]int{}
+	errRefused = errors.New("refused")
+)
+
+func (h *HookItem) BeforeInsert(ctx context.Context) error {
+	hookCalls["before_insert"]++
+	if h.Name == "bad" {
+		return errRefused
+	}
+	h.Name = strings.ToLower(h.Name)
+	return nil
+}
+
+func (h *HookItem) AfterInsert(ctx context.Context) error {
+	hookCalls["after_insert"]++
+	// hooks run in the transaction of the insert, the row is visible using ctx
+	n, err := orm.Model[HookItem]().Database(otherDB).Context(ctx).Where("name = ?", h.Name).Count()
+	if err != nil || n == 0 {
+		return errors.New("inserted row not visible from AfterInsert")
+	}
+	if h.Name == "after" {
+		return errRefused
+	}
+	return nil
+}
+
+func (h *HookItem) BeforeUpdate(ctx context.Context) error {
+	hookCalls["before_update"]++
+	if h.Name == "locked" {
+		return errRefused
+	}
+	return nil
+}
+
+func (h *HookItem) BeforeDelete(ctx context.Context) error {
+	hookCalls["before_delete"]++
+	if h.Name == "keep" {
+		return errRefused
+	}
+	return nil
+}
+
+func (h *HookItem) AfterFind(ctx context.Context) error {
+	hookCalls["after_find"]++
+	return nil
+}
+
+func resetHookItems(t *testing.T) {
+	t.Helper()
+	resetTable[HookItem](t, "hook_items")
+	hookCalls = map[string]int{}
+}
+
+func hookItemsCount(t *testing.T) int64 {
+	t.Helper()
+	n, err := orm.Table("hook_items").Database(otherDB).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestModelHooks(t *testing.T) {
+	resetHookItems(t)
+	items := func() *orm.Builder[HookItem] { return orm.Model[HookItem]().Database(otherDB) }
+
+	item := HookItem{Name: "ANN"}
+	if _, err := items().Insert(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "ann" {
+		t.Errorf("BeforeInsert should change the model, got %q", item.Name)
+	}
+	if _, err := items().InsertMany([]HookItem{{Name: "Bob"}, {Name: "bad"}}); err != errRefused {
+		t.Errorf("BeforeInsert error should abort, got %v", err)
+	}
+	if _, err := items().Insert(&HookItem{Name: "after"}); err != errRefused {
+		t.Errorf("AfterInsert error should be returned, got %v", err)
+	}
+	if n := hookItemsCount(t); n != 1 {
+		t.Errorf("failed inserts should be rolled back, got %d rows", n)
+	}
+
+	found, err := items().Where("name = ?", "ann").One()
+	if err != nil || hookCalls["after_find"] != 1 {
+		t.Errorf("AfterFind: got %d calls %v", hookCalls["after_find"], err)
+	}
+	found.Name = "locked"
+	if _, err := items().Update(&found); err != errRefused {
+		t.Errorf("BeforeUpdate error should abort, got %v", err)
+	}
+	found.Name = "keep"
+	if _, err := items().Save(&found); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := items().Where("id = ?", found.Id).Delete(); err != errRefused {
+		t.Errorf("BeforeDelete error should abort, got %v", err)
+	}
+	if n := hookItemsCount(t); n != 1 {
+		t.Errorf("refused delete should keep the row, got %d", n)
+	}
+
+	err = orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+		if _, err := orm.TxModel[HookItem](tx).Insert(&HookItem{Name: "carl"}); err != nil {
+			return err
+		}
+		_, err := orm.TxModel[HookItem](tx).Insert(&HookItem{Name: "bad"})
+		return err
+	})
+	if err != errRefused {
+		t.Errorf("transaction should return the hook error, got %v", err)
+	}
+	if n := hookItemsCount(t); n != 1 {
+		t.Errorf("transaction should be rolled back, got %d rows", n)
+	}
+}
+
+func TestTableHooks(t *testing.T) {
+	resetHookItems(t)
+	t.Cleanup(func() { orm.ClearHooks("hook_items") })
+	found := 0
+	orm.AddHook(orm.BEFORE_INSERT, "hook_items", func(ctx context.Context, row map[string]any) error {
+		if name, ok := row["name"].(string); ok {
+			row["name"] = strings.TrimSpace(name)
+		}
+		return nil
+	})
+	orm.AddHook(orm.BEFORE_UPDATE, "hook_items", func(ctx context.Context, row map[string]any) error {
+		if row["name"] == "locked" {
+			return errRefused
+		}
+		return nil
+	})
+	orm.AddHook(orm.BEFORE_DELETE, "hook_items", func(ctx context.Context, row map[string]any) error {
+		if row["name"] == "keep" {
+			return errRefused
+		}
+		return nil
+	})
+	orm.AddHook(orm.AFTER_FIND, "hook_items", func(ctx context.Context, row map[string]any) error {
+		found++
+		return nil
+	})
+
+	if _, err := orm.Table("hook_items").Database(otherDB).Insert("name", []any{"a", "b"}); err == nil {
+		t.Error("Insert with more values than fields should fail before running hooks")
+	}
+	if _, err := orm.Table("hook_items").Database(otherDB).Insert("name", []any{"  keep "}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orm.Table("hook_items").Database(otherDB).InsertMany([]map[string]any{{"name": " x "}}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := orm.Table("hook_items").Database(otherDB).OrderBy("name").All()
+	if err != nil || len(rows) != 2 || rows[0]["name"] != "keep" || rows[1]["name"] != "x" || found != 2 {
+		t.Errorf("BEFORE_INSERT and AFTER_FIND: got %v %d %v", rows, found, err)
+	}
+	if _, err := orm.Table("hook_items").Database(otherDB).Where("name = ?", "x").Update(map[string]any{"name": "locked"}); err != errRefused {
+		t.Errorf("BEFORE_UPDATE error should abort, got %v", err)
+	}
+	if _, err := orm.Table("hook_items").Database(otherDB).Where("id > ?", 0).Delete(); err != errRefused {
+		t.Errorf("BEFORE_DELETE error should abort, got %v", err)
+	}
+	if n := hookItemsCount(t); n != 2 {
+		t.Errorf("refused writes should change nothing, got %d rows", n)
+	}
+	if n, err := orm.Table("hook_items").Database(otherDB).Where("name = ?", "x").Delete(); err != nil || n != 1 {
+		t.Errorf("Delete: got %d %v", n, err)
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+func migrationsFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_mig_items.up.sql":   {Data: []byte("CREATE TABLE mig_items (id INTEGER PRIMARY KEY, name TEXT);\n-- a comment; with a semicolon\nINSERT INTO mig_items (name) VALUES ('a;b');")},
+		"0001_create_mig_items.down.sql": {Data: []byte("DROP TABLE mig_items;")},
+		"0002_add_price.up.sql":          {Data: []byte("ALTER TABLE mig_items ADD COLUMN price INTEGER;")},
+		"0002_add_price.down.sql":        {Data: []byte("ALTER TABLE mig_items DROP COLUMN price;")},
+		"0003_broken.up.sql":             {Data: []byte("CREATE TABLE mig_broken (id INTEGER);\nINSERT INTO not_a_table VALUES (1);")},
+		"add_users_old.sql":              {Data: []byte("ignored, not a versioned migration")},
+	}
+}
+
+func resetMigrations(t *testing.T) {
+	t.Helper()
+	for _, table := range []string{"mig_items", "mig_broken", "mig_log", orm.MIGRATIONS_TABLE, orm.MIGRATIONS_LOCK_TABLE} {
+		if err := orm.Exec(otherDB, "DROP TABLE IF EXISTS "+table); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tableExists(t *testing.T, table string) bool {
+	t.Helper()
+	rows, err := orm.Query(otherDB, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table)
+	if err != nil && err.Error() != "no data found" {
+		t.Fatal(err)
+	}
+	return len(rows) > 0
+}
+
+func TestMigrations(t *testing.T) {
+	resetMigrations(t)
+	fsys := migrationsFS()
+	migs := orm.MigrationsFromFS(fsys, otherDB)
+
+	list, err := migs.List()
+	if err != nil || len(list) != 3 || list[0].Version != 1 || list[2].Name != "broken" || list[0].Checksum == "" {
+		t.Fatalf("List: got %+v %v", list, err)
+	}
+	applied, err := migs.Up(2)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("Up(2): got %+v %v", applied, err)
+	}
+	rows, err := orm.Table("mig_items").Database(otherDB).All()
+	if err != nil || len(rows) != 1 || rows[0]["name"] != "a;b" {
+		t.Errorf("semicolons in strings should not split statements, got %v %v", rows, err)
+	}
+
+	// a failing migration is rolled back and not recorded
+	if _, err := migs.Up(0); err == nil {
+		t.Error("Up of a broken migration should fail")
+	}
+	if tableExists(t, "mig_broken") {
+		t.Error("the broken migration should be rolled back")
+	}
+	status, err := migs.Status()
+	if err != nil || len(status) != 3 || !status[0].Applied || !status[1].Applied || status[2].Applied || status[0].AppliedAt.IsZero() {
+		t.Errorf("Status: got %+v %v", status, err)
+	}
+	delete(fsys, "0003_broken.up.sql")
+
+	if err := orm.Exec(otherDB, "INSERT INTO "+orm.MIGRATIONS_LOCK_TABLE+" (id, locked_at) VALUES (1, CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migs.Down(1); !errors.Is(err, orm.ErrMigrationLocked) {
+		t.Errorf("Down while locked: got %v", err)
+	}
+	if err := migs.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	redone, err := migs.Redo()
+	if err != nil || redone.Version != 2 {
+		t.Errorf("Redo: got %+v %v", redone, err)
+	}
+	down, err := migs.Down(1)
+	if err != nil || len(down) != 1 || down[0].Version != 2 {
+		t.Errorf("Down(1): got %+v %v", down, err)
+	}
+	if _, err := orm.Query(otherDB, "SELECT price FROM mig_items"); err == nil {
+		t.Error("Down should drop the price column")
+	}
+
+	fsys["0001_create_mig_items.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE mig_items (id INTEGER PRIMARY KEY);")}
+	if _, err := migs.Up(0); !errors.Is(err, orm.ErrMigrationChanged) {
+		t.Errorf("Up with a changed applied migration: got %v", err)
+	}
+	status, err = migs.Status()
+	if err != nil || !status[0].Changed || status[1].Applied {
+		t.Errorf("Status after change: got %+v %v", status, err)
+	}
+	if down, err := migs.Down(5); err != nil || len(down) != 1 || tableExists(t, "mig_items") {
+		t.Errorf("Down(5): got %+v %v", down, err)
+	}
+}
+
+func TestMigrationsTriggersAndComments(t *testing.T) {
+	resetMigrations(t)
+	fsys := fstest.MapFS{
+		"0001_trigger.up.sql": {Data: []byte(`CREATE TABLE mig_items (id INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE mig_log (id INTEGER PRIMARY KEY, note TEXT);
+/* a; b */
+CREATE TRIGGER mig_items_ai AFTER INSERT ON mig_items
+BEGIN
+	UPDATE mig_items SET name = upper(name) WHERE id = NEW.id;
+	INSERT INTO mig_log (note) VALUES (CASE WHEN NEW.name = 'x' THEN 'x;' ELSE 'other' END);
+END;
+/* only a comment; */
+INSERT INTO mig_items (name) VALUES ('a');`)},
+		"0001_trigger.down.sql": {Data: []byte("DROP TRIGGER mig_items_ai;\nDROP TABLE mig_log;\nDROP TABLE mig_items;")},
+	}
+	migs := orm.MigrationsFromFS(fsys, otherDB)
+	if applied, err := migs.Up(0); err != nil || len(applied) != 1 {
+		t.Fatalf("Up: got %+v %v", applied, err)
+	}
+	rows, err := orm.Query(otherDB, "SELECT name FROM mig_items")
+	if err != nil || len(rows) != 1 || rows[0]["name"] != "A" {
+		t.Errorf("the trigger body should run both statements, got %v %v", rows, err)
+	}
+	rows, err = orm.Query(otherDB, "SELECT note FROM mig_log")
+	if err != nil || len(rows) != 1 || rows[0]["note"] != "other" {
+		t.Errorf("got %v %v", rows, err)
+	}
+	if down, err := migs.Down(1); err != nil || len(down) != 1 || tableExists(t, "mig_log") {
+		t.Errorf("Down: got %+v %v", down, err)
+	}
+}
+
+func TestMigrationsLockError(t *testing.T) {
+	resetMigrations(t)
+	migs := orm.MigrationsFromFS(migrationsFS(), otherDB)
+	// create the migrations tables, then make taking the lock fail for another reason than a taken lock
+	if _, err := migs.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Exec(otherDB, "CREATE TRIGGER mig_lock_fail BEFORE INSERT ON "+orm.MIGRATIONS_LOCK_TABLE+" BEGIN SELECT RAISE(ABORT, 'disk I/O error'); END"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { orm.Exec(otherDB, "DROP TRIGGER IF EXISTS mig_lock_fail") })
+	_, err := migs.Up(0)
+	if err == nil || errors.Is(err, orm.ErrMigrationLocked) {
+		t.Errorf("only a taken lock should return ErrMigrationLocked, got %v", err)
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	up, down, err := orm.CreateMigration(dir, "Add Posts")
+	if err != nil || filepath.Base(up) != "0001_add_posts.up.sql" || filepath.Base(down) != "0001_add_posts.down.sql" {
+		t.Fatalf("CreateMigration: got %s %s %v", up, down, err)
+	}
+	if up, _, err = orm.CreateMigration(dir, "add-tags"); err != nil || filepath.Base(up) != "0002_add_tags.up.sql" {
+		t.Errorf("second CreateMigration: got %s %v", up, err)
+	}
+	if _, _, err := orm.CreateMigration(dir, " !! "); err == nil {
+		t.Error("CreateMigration should refuse an empty name")
+	}
+	if _, err := os.Stat(down); err != nil {
+		t.Error(err)
+	}
+	list, err := orm.MigrationsFromDir(dir, otherDB).List()
+	if err != nil || len(list) != 2 || list[1].Name != "add_tags" {
+		t.Errorf("List: got %+v %v", list, err)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type RelAuthor struct {
+	Id    uint       `orm:"autoinc"`
+	Name  string     `orm:"size:50"`
+	Posts *[]RelPost `orm:"has_many:author_id"`
+}
+
+type RelPost struct {
+	Id       uint       `orm:"autoinc"`
+	AuthorId uint       `orm:"fk:rel_authors.id:cascade"`
+	Title    string     `orm:"size:50"`
+	Author   *RelAuthor `orm:"belongs_to:author_id"`
+	Tags     *[]RelTag  `orm:"many_to_many:rel_posts_tags.post_id.tag_id"`
+}
+
+type RelTag struct {
+	Id   uint   `orm:"autoinc"`
+	Name string `orm:"size:50"`
+}
+
+type RelPostTag struct {
+	Id     uint `orm:"autoinc"`
+	PostId uint `orm:"fk:rel_posts.id:cascade"`
+	TagId  uint `orm:"fk:rel_tags.id:cascade"`
+}
+
+func resetRelations(t *testing.T) {
+	t.Helper()
+	if err := orm.AutoMigrate[RelAuthor]("rel_authors", otherDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.AutoMigrate[RelPost]("rel_posts", otherDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.AutoMigrate[RelTag]("rel_tags", otherDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.AutoMigrate[RelPostTag]("rel_posts_tags", otherDB); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"rel_posts_tags", "rel_posts", "rel_tags", "rel_authors"} {
+		if err := orm.Exec(otherDB, "DELETE FROM "+table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disableCache(t)
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if err := orm.Exec(otherDB, query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("INSERT INTO rel_authors (id,name) VALUES (1,'ann'),(2,'bob'),(3,'carl')")
+	exec("INSERT INTO rel_posts (id,author_id,title) VALUES (1,1,'a1'),(2,1,'a2'),(3,2,'b1')")
+	exec("INSERT INTO rel_tags (id,name) VALUES (1,'go'),(2,'sql')")
+	exec("INSERT INTO rel_posts_tags (post_id,tag_id) VALUES (1,1),(1,2),(3,2)")
+}
+
+func TestPreload(t *testing.T) {
+	resetRelations(t)
+	posts, err := orm.Model[RelPost]().Database(otherDB).Preload("Author", "Tags").OrderBy("id").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 {
+		t.Fatal("expected 3 posts, got", len(posts))
+	}
+	want := map[string]struct {
+		author string
+		tags   int
+	}{"a1": {"ann", 2}, "a2": {"ann", 0}, "b1": {"bob", 1}}
+	for _, p := range posts {
+		w := want[p.Title]
+		if p.Author == nil || p.Author.Name != w.author {
+			t.Errorf("%s: bad author %+v", p.Title, p.Author)
+		}
+		if p.Tags == nil || len(*p.Tags) != w.tags {
+			t.Errorf("%s: expected %d tags, got %v", p.Title, w.tags, p.Tags)
+		}
+	}
+
+	authors, err := orm.Model[RelAuthor]().Database(otherDB).Preload("Posts").OrderBy("id").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := []int{2, 1, 0}
+	for i, a := range authors {
+		if a.Posts == nil || len(*a.Posts) != counts[i] {
+			t.Errorf("%s: expected %d posts, got %v", a.Name, counts[i], a.Posts)
+		}
+	}
+
+	one, err := orm.Model[RelPost]().Database(otherDB).Where("id = ?", 3).Preload("Author").One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.Author == nil || one.Author.Name != "bob" || one.Tags != nil {
+		t.Errorf("bad preload on One: %+v", one)
+	}
+
+	if _, err := orm.Model[RelPost]().Database(otherDB).Preload("Unknown").All(); err == nil {
+		t.Error("preloading an unknown relation should fail")
+	}
+}
+
+func TestJoin(t *testing.T) {
+	resetRelations(t)
+	posts, err := orm.Model[RelPost]().Database(otherDB).Join("Author").Where("author.name = ?", "ann").OrderBy("rel_posts.id").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].Title != "a1" || posts[1].Title != "a2" {
+		t.Errorf("bad belongs_to join: %+v", posts)
+	}
+
+	posts, err = orm.Model[RelPost]().Database(otherDB).Join("Tags").Where("tags.name IN (?,?)", "go", "sql").Preload("Tags").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("many_to_many join should not duplicate posts, got %+v", posts)
+	}
+
+	authors, err := orm.Model[RelAuthor]().Database(otherDB).Join("Posts").Where("posts.title LIKE ?", "a%").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 1 || authors[0].Name != "ann" {
+		t.Errorf("bad has_many join: %+v", authors)
+	}
+
+	authors, err = orm.Model[RelAuthor]().Database(otherDB).LeftJoin("Posts").Where("posts.id IS NULL").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 1 || authors[0].Name != "carl" {
+		t.Errorf("bad left join: %+v", authors)
+	}
+}
+
+func TestInsertSkipRelations(t *testing.T) {
+	resetRelations(t)
+	_, err := orm.Model[RelPost]().Database(otherDB).Insert(&RelPost{AuthorId: 2, Title: "b2", Author: &RelAuthor{Name: "ignored"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := orm.Model[RelPost]().Database(otherDB).Where("title = ?", "b2").One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AuthorId != 2 || p.Author != nil {
+		t.Errorf("bad inserted post: %+v", p)
+	}
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type SoftItem struct {
+	Id        uint      `orm:"autoinc"`
+	Name      string    `orm:"size:20"`
+	DeletedAt time.Time `orm:"softdelete"`
+}
+
+type SoftHookItem struct {
+	Id        uint      `orm:"autoinc"`
+	Name      string    `orm:"size:20"`
+	DeletedAt time.Time `orm:"softdelete"`
+}
+
+var softHookCalls = map[string]int{}
+
+func (s *SoftHookItem) BeforeUpdate(ctx context.Context) error {
+	softHookCalls["before_update"]++
+	if !s.DeletedAt.IsZero() {
+		return errors.New("BeforeUpdate should get the restored model")
+	}
+	if s.Name == "locked" {
+		return errRefused
+	}
+	return nil
+}
+
+func (s *SoftHookItem) AfterUpdate(ctx context.Context) error {
+	softHookCalls["after_update"]++
+	return nil
+}
+
+func resetSoftItems(t *testing.T) {
+	t.Helper()
+	resetTable[SoftItem](t, "soft_items")
+	if _, err := orm.Model[SoftItem]().Database(otherDB).Insert(&SoftItem{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orm.Model[SoftItem]().Database(otherDB).InsertMany([]SoftItem{{Name: "b"}, {Name: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	resetSoftItems(t)
+	items := func() *orm.Builder[SoftItem] { return orm.Model[SoftItem]().Database(otherDB) }
+	count := func(b *orm.Builder[SoftItem]) int64 {
+		t.Helper()
+		n, err := b.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if col := orm.SoftDeleteColumn("soft_items", otherDB); col != "deleted_at" {
+		t.Fatalf("expected deleted_at, got %q", col)
+	}
+	if _, err := items().Delete(); err == nil {
+		t.Error("Delete without Where should fail")
+	}
+	if n, err := items().Where("name = ?", "a").Delete(); err != nil || n != 1 {
+		t.Fatalf("Delete: got %d %v", n, err)
+	}
+	if n := count(items()); n != 2 {
+		t.Errorf("deleted rows should be excluded, got %d", n)
+	}
+	if n := count(items().WithTrashed()); n != 3 {
+		t.Errorf("WithTrashed: got %d", n)
+	}
+	trashed, err := items().OnlyTrashed().All()
+	if err != nil || len(trashed) != 1 || trashed[0].Name != "a" || trashed[0].DeletedAt.IsZero() {
+		t.Errorf("OnlyTrashed: got %+v %v", trashed, err)
+	}
+	all, err := items().OrderBy("name").All()
+	if err != nil || len(all) != 2 || all[0].Name != "b" || !all[0].DeletedAt.IsZero() {
+		t.Errorf("All: got %+v %v", all, err)
+	}
+	if _, err := items().Where("name = ?", "a").One(); err == nil {
+		t.Error("One should not find deleted rows")
+	}
+
+	// updates don't touch the softdelete column
+	b := all[0]
+	b.Name = "bb"
+	if _, err := items().Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(items().Where("name = ?", "bb")); n != 1 {
+		t.Errorf("Update: got %d", n)
+	}
+
+	if n, err := items().Where("name = ?", "a").Restore(); err != nil || n != 1 {
+		t.Errorf("Restore: got %d %v", n, err)
+	}
+	if n := count(items()); n != 3 {
+		t.Errorf("restored rows should be included, got %d", n)
+	}
+
+	if n, err := orm.Table("soft_items").Database(otherDB).Where("name = ?", "c").Delete(); err != nil || n != 1 {
+		t.Errorf("BuilderM Delete: got %d %v", n, err)
+	}
+	rows, err := orm.Table("soft_items").Database(otherDB).All()
+	if err != nil || len(rows) != 2 {
+		t.Errorf("BuilderM All: got %v %v", rows, err)
+	}
+	if n, err := items().Where("name = ?", "c").ForceDelete(); err != nil || n != 1 {
+		t.Errorf("ForceDelete of a deleted row: got %d %v", n, err)
+	}
+	if n := count(items().WithTrashed()); n != 2 {
+		t.Errorf("ForceDelete should remove rows, got %d", n)
+	}
+	if _, err := orm.Table("users").Database(otherDB).Where("id = ?", 1).Restore(); err != orm.ErrNoSoftDelete {
+		t.Errorf("Restore without softdelete column: got %v", err)
+	}
+}
+
+func TestRestoreRunsUpdateHooks(t *testing.T) {
+	resetSoftItems(t)
+	t.Cleanup(func() { orm.ClearHooks("soft_items") })
+	updated := []map[string]any{}
+	orm.AddHook(orm.BEFORE_UPDATE, "soft_items", func(ctx context.Context, row map[string]any) error {
+		if _, ok := row["deleted_at"]; ok && len(updated) > 0 {
+			return errRefused
+		}
+		return nil
+	})
+	orm.AddHook(orm.AFTER_UPDATE, "soft_items", func(ctx context.Context, row map[string]any) error {
+		updated = append(updated, row)
+		return nil
+	})
+	items := func() *orm.BuilderM { return orm.Table("soft_items").Database(otherDB) }
+	if _, err := items().Where("name IN (?)", []string{"a", "b"}).Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := items().Where("name = ?", "a").Restore(); err != nil || n != 1 {
+		t.Fatalf("Restore: got %d %v", n, err)
+	}
+	if len(updated) != 1 || updated[0]["deleted_at"] != nil || len(updated[0]) != 1 {
+		t.Errorf("AFTER_UPDATE should get the restored column, got %v", updated)
+	}
+	if _, err := items().Where("name = ?", "b").Restore(); err != errRefused {
+		t.Errorf("BEFORE_UPDATE error should abort Restore, got %v", err)
+	}
+	if n, _ := items().Count(); n != 2 {
+		t.Errorf("b should stay deleted, got %d rows", n)
+	}
+}
+
+func TestRestoreRunsModelHooks(t *testing.T) {
+	resetTable(t, "soft_hook_items", SoftHookItem{Name: "a"}, SoftHookItem{Name: "locked"}, SoftHookItem{Name: "c"})
+	softHookCalls = map[string]int{}
+	items := func() *orm.Builder[SoftHookItem] { return orm.Model[SoftHookItem]().Database(otherDB) }
+	if _, err := items().Where("name IN (?)", []string{"a", "locked"}).Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := items().Where("name = ?", "a").Restore(); err != nil || n != 1 {
+		t.Fatalf("Restore: got %d %v", n, err)
+	}
+	if softHookCalls["before_update"] != 1 || softHookCalls["after_update"] != 1 {
+		t.Errorf("Restore should run update hooks on the restored row, got %v", softHookCalls)
+	}
+	if _, err := items().Where("name = ?", "locked").Restore(); err != errRefused {
+		t.Errorf("BeforeUpdate error should abort Restore, got %v", err)
+	}
+	if n, _ := items().Count(); n != 2 {
+		t.Errorf("locked should stay deleted, got %d rows", n)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type StreamItem struct {
+	Id   uint   `orm:"autoinc"`
+	Name string `orm:"size:20"`
+	Rank int
+}
+
+func resetStreamItems(t *testing.T, n int) {
+	t.Helper()
+	items := make([]StreamItem, n)
+	for i := range items {
+		// ranks repeat, so pages are split between equal values
+		items[i] = StreamItem{Name: string(rune('a' + i%26)), Rank: i % 3}
+	}
+	resetTable(t, "stream_items", items...)
+}
+
+func TestEachAndRows(t *testing.T) {
+	resetStreamItems(t, 20)
+	sum := 0
+	err := orm.Model[StreamItem]().Database(otherDB).Where("rank = ?", 1).Each(func(item StreamItem) error {
+		if item.Rank != 1 || item.Name == "" {
+			t.Errorf("bad item %+v", item)
+		}
+		sum++
+		return nil
+	})
+	if err != nil || sum != 7 {
+		t.Errorf("Each: got %d rows %v", sum, err)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = orm.Table("stream_items").Database(otherDB).OrderBy("id").Each(func(row map[string]any) error {
+		n++
+		if n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("Each should stop on error, got %d %v", n, err)
+	}
+
+	rows, err := orm.Model[StreamItem]().Database(otherDB).OrderBy("-id").Limit(5).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	ids := []uint{}
+	for rows.Next() {
+		ids = append(ids, rows.Value().Id)
+	}
+	if rows.Err() != nil || len(ids) != 5 || ids[0] < ids[4] {
+		t.Errorf("Rows: got %v %v", ids, rows.Err())
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	resetStreamItems(t, 23)
+	seen := map[uint]bool{}
+	cursor := ""
+	pages := 0
+	lastRank := -1
+	for {
+		items, next, err := orm.Model[StreamItem]().Database(otherDB).OrderBy("rank").Limit(5).After(cursor).Paginate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, item := range items {
+			if seen[item.Id] {
+				t.Fatalf("item %d seen twice", item.Id)
+			}
+			if item.Rank < lastRank {
+				t.Fatalf("items not ordered by rank, %d after %d", item.Rank, lastRank)
+			}
+			seen[item.Id], lastRank = true, item.Rank
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+		// rows inserted before the cursor don't shift the next pages
+		if pages == 1 {
+			if _, err := orm.Model[StreamItem]().Database(otherDB).Insert(&StreamItem{Name: "new", Rank: -1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(seen) != 23 || pages != 5 {
+		t.Errorf("got %d items in %d pages", len(seen), pages)
+	}
+
+	if _, _, err := orm.Model[StreamItem]().Database(otherDB).Limit(5).After("bad").Paginate(); !errors.Is(err, orm.ErrInvalidCursor) {
+		t.Errorf("bad cursor should fail, got %v", err)
+	}
+	if _, _, err := orm.Model[StreamItem]().Database(otherDB).Paginate(); err == nil {
+		t.Error("Paginate without Limit should fail")
+	}
+	items, next, err := orm.Model[StreamItem]().Database(otherDB).Where("rank = ?", 2).OrderBy("-id").Limit(3).Paginate()
+	if err != nil || len(items) != 3 || next == "" || items[0].Id < items[2].Id {
+		t.Errorf("Paginate desc with Where: got %+v %q %v", items, next, err)
+	}
+}
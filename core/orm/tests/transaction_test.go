@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type TxItem struct {
+	Id   uint   `orm:"autoinc"`
+	Name string `orm:"size:50"`
+}
+
+func txItems(t *testing.T) []string {
+	t.Helper()
+	rows, err := orm.Model[TxItem]().Database(otherDB).OrderBy("id").All()
+	if err != nil && err.Error() != "no data found" {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, r := range rows {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestTransactionCommitAndRollback(t *testing.T) {
+	resetTable[TxItem](t, "tx_items")
+	err := orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+		if _, err := orm.TxModel[TxItem](tx).Insert(&TxItem{Name: "a"}); err != nil {
+			return err
+		}
+		_, err := tx.Table("tx_items").Insert("name", []any{"b"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errStop := errors.New("stop")
+	err = orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+		if _, err := tx.Table("tx_items").Where("name = ?", "a").Set("name = ?", "changed"); err != nil {
+			return err
+		}
+		if _, err := orm.TxModel[TxItem](tx).Where("name = ?", "b").Delete(); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err != errStop {
+		t.Fatal("the error of fn should be returned, got", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic should be propagated")
+			}
+		}()
+		orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+			tx.Table("tx_items").Insert("name", []any{"panic"})
+			panic("boom")
+		})
+	}()
+
+	if got := txItems(t); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Error("only the first transaction should be committed:", got)
+	}
+}
+
+func TestTransactionSavepoints(t *testing.T) {
+	resetTable[TxItem](t, "tx_items")
+	err := orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+		tx.Table("tx_items").Insert("name", []any{"outer"})
+		err := tx.Transaction(func(tx *orm.Tx) error {
+			tx.Table("tx_items").Insert("name", []any{"nested"})
+			return errors.New("rollback nested")
+		})
+		if err == nil {
+			t.Error("nested error should be returned")
+		}
+		// orm.Transaction with the context of a transaction create a savepoint too
+		return orm.Transaction(tx.Context(), otherDB, func(tx *orm.Tx) error {
+			_, err := orm.TxModel[TxItem](tx).Insert(&TxItem{Name: "from context"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := txItems(t); len(got) != 2 || got[0] != "outer" || got[1] != "from context" {
+		t.Error(got)
+	}
+}
+
+func TestTransactionReadsAndCache(t *testing.T) {
+	resetTable[TxItem](t, "tx_items")
+	orm.UseCache = true
+	orm.Model[TxItem]().Database(otherDB).Insert(&TxItem{Name: "a"})
+	time.Sleep(50 * time.Millisecond)
+	if got := txItems(t); len(got) != 1 {
+		t.Fatal(got)
+	}
+
+	var tx *orm.Tx
+	errStop := errors.New("stop")
+	orm.Transaction(context.Background(), otherDB, func(t2 *orm.Tx) error {
+		tx = t2
+		orm.TxModel[TxItem](tx).Insert(&TxItem{Name: "b"})
+		// builders using the context of the transaction run in it and skip the cache
+		all, err := orm.Model[TxItem]().Database(otherDB).Context(tx.Context()).All()
+		if err != nil || len(all) != 2 {
+			t.Error("uncommitted rows should be visible in the transaction:", all, err)
+		}
+		return errStop
+	})
+	time.Sleep(50 * time.Millisecond)
+	if got := txItems(t); len(got) != 1 {
+		t.Error("cache should not keep rows read in a rolled back transaction:", got)
+	}
+	if _, err := tx.Table("tx_items").Insert("name", []any{"late"}); err != orm.ErrTxDone {
+		t.Error("a finished transaction should not be used:", err)
+	}
+
+	err := orm.Transaction(context.Background(), otherDB, func(tx *orm.Tx) error {
+		_, err := tx.Table("tx_items").Insert("name", []any{"c"})
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cache is emptied after commit
+	deadline := time.Now().Add(time.Second)
+	for len(txItems(t)) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := txItems(t); len(got) != 2 {
+		t.Error("cache should be emptied after commit:", got)
+	}
+}
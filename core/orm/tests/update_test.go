@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/orm"
+)
+
+type UpdItem struct {
+	Id    uint   `orm:"autoinc"`
+	Name  string `orm:"size:50"`
+	Note  string `orm:"size:50"`
+	Views int
+}
+
+func updItem(t *testing.T, id uint) UpdItem {
+	t.Helper()
+	item, err := orm.Model[UpdItem]().Database(otherDB).Where("id = ?", id).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestUpdateFromModel(t *testing.T) {
+	resetTable[UpdItem](t, "upd_items")
+	item := UpdItem{Name: "a", Note: "n"}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Save(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Id == 0 {
+		t.Fatal("Save should set the pk of inserted models")
+	}
+
+	item.Name, item.Note = "b", "changed"
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Update(&item, "Name"); err != nil {
+		t.Fatal(err)
+	}
+	if got := updItem(t, item.Id); got.Name != "b" || got.Note != "n" {
+		t.Errorf("only the given fields should be updated, got %+v", got)
+	}
+
+	n, err := orm.Model[UpdItem]().Database(otherDB).Update(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := updItem(t, item.Id); n != 1 || got.Note != "changed" {
+		t.Errorf("changed fields should be updated, got %d %+v", n, got)
+	}
+	if n, err := orm.Model[UpdItem]().Database(otherDB).Update(&item); err != nil || n != 0 {
+		t.Errorf("nothing changed, got %d %v", n, err)
+	}
+
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Update(&item, "unknown"); err == nil {
+		t.Error("unknown fields should fail")
+	}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Update(&UpdItem{Name: "x"}); err == nil {
+		t.Error("model without pk and no Where should fail")
+	}
+}
+
+func TestUpdateExprAndSave(t *testing.T) {
+	resetTable[UpdItem](t, "upd_items")
+	item := UpdItem{Name: "a", Views: 1}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Save(&item); err != nil {
+		t.Fatal(err)
+	}
+	_, err := orm.Model[UpdItem]().Database(otherDB).Where("id = ?", item.Id).SetExpr("views", orm.Expr("views + ?", 2)).Update(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = orm.Table("upd_items").Database(otherDB).Where("id = ?", item.Id).Update(map[string]any{
+		"id":    999,
+		"note":  "map",
+		"views": orm.Expr("views * ?", 10),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := updItem(t, item.Id); got.Views != 30 || got.Note != "map" {
+		t.Errorf("bad expressions update, got %+v", got)
+	}
+
+	item = updItem(t, item.Id)
+	item.Name = "saved"
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Save(&item); err != nil {
+		t.Fatal(err)
+	}
+	if got := updItem(t, item.Id); got.Name != "saved" || got.Views != 30 {
+		t.Errorf("Save should update, got %+v", got)
+	}
+
+	missing := UpdItem{Id: 500, Name: "missing"}
+	if _, err := orm.Model[UpdItem]().Database(otherDB).Save(&missing); err != nil {
+		t.Fatal(err)
+	}
+	if got := updItem(t, 500); got.Name != "missing" {
+		t.Errorf("Save should insert a model with a pk not found, got %+v", got)
+	}
+}
+
+func TestUpdateUnknownColumns(t *testing.T) {
+	resetTable(t, "upd_items", UpdItem{Name: "a", Views: 1})
+	for _, col := range []string{"nope", "views = 100, name", "upd_items.name"} {
+		_, err := orm.Table("upd_items").Database(otherDB).Where("name = ?", "a").Update(map[string]any{"note": "n", col: "x"})
+		if !errors.Is(err, orm.ErrUnknownColumn) {
+			t.Errorf("Update with key %q: got %v", col, err)
+		}
+	}
+	if rows, err := orm.Table("upd_items").Database(otherDB).All(); err != nil || rows[0]["views"] != int64(1) || rows[0]["note"] != "" {
+		t.Errorf("refused updates should change nothing, got %v %v", rows, err)
+	}
+}
@@ -0,0 +1,270 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/eventbus"
+)
+
+// ErrTxDone is returned when a builder use a transaction already committed or rolled back
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// executor is implemented by *sql.DB and *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type txKey struct{}
+
+// Tx is a database transaction, builders created from it run on it, cache events are published after commit
+type Tx struct {
+	tx    *sql.Tx
+	ctx   context.Context
+	db    *DatabaseEntity
+	mu    *sync.Mutex
+	state *txState
+}
+
+type txState struct {
+	done       bool
+	savepoints int
+	events     []map[string]string
+}
+
+// Transaction run fn in a transaction on dbName (default database if empty), it is committed if fn return nil,
+// and rolled back if fn return an error or panic, opts set the isolation level and read only mode.
+// Called with a context of a transaction on the same database, fn run in a savepoint of this transaction
+//
+//	err := orm.Transaction(ctx, "", func(tx *orm.Tx) error {
+//		if _, err := orm.TxModel[models.User](tx).Where("id = ?", 1).Set("email = ?", email); err != nil {
+//			return err
+//		}
+//		_, err := tx.Table("logs").Insert("message", []any{"email changed"})
+//		return err
+//	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+func Transaction(ctx context.Context, dbName string, fn func(tx *Tx) error, opts ...*sql.TxOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if dbName == "" {
+		dbName = settings.Config.Db.Name
+	}
+	if parent, ok := ctx.Value(txKey{}).(*Tx); ok && parent.db.Name == dbName {
+		return parent.Transaction(fn)
+	}
+	db, err := GetMemoryDatabase(dbName)
+	if err != nil {
+		return err
+	}
+	var opt *sql.TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	sqlTx, err := db.Conn.BeginTx(ctx, opt)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{
+		tx:    sqlTx,
+		db:    db,
+		mu:    &sync.Mutex{},
+		state: &txState{},
+	}
+	tx.ctx = context.WithValue(ctx, txKey{}, tx)
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		tx.finish()
+		_ = sqlTx.Rollback()
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	events := tx.finish()
+	if err := sqlTx.Commit(); err != nil {
+		committed = true
+		return err
+	}
+	committed = true
+	if UseCache {
+		for _, e := range events {
+			eventbus.Publish(CACHE_TOPIC, e)
+		}
+	}
+	return nil
+}
+
+// Transaction run fn in a savepoint, changes made by fn are rolled back if it return an error or panic,
+// without rolling back the whole transaction
+func (tx *Tx) Transaction(fn func(tx *Tx) error) error {
+	tx.mu.Lock()
+	if tx.state.done {
+		tx.mu.Unlock()
+		return ErrTxDone
+	}
+	tx.state.savepoints++
+	name := "kago_sp_" + strconv.Itoa(tx.state.savepoints)
+	events := len(tx.state.events)
+	tx.mu.Unlock()
+
+	if _, err := tx.tx.ExecContext(tx.ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	nested := &Tx{tx: tx.tx, db: tx.db, mu: tx.mu, state: tx.state}
+	nested.ctx = context.WithValue(tx.ctx, txKey{}, nested)
+
+	released := false
+	defer func() {
+		if released {
+			return
+		}
+		_, _ = tx.tx.ExecContext(tx.ctx, "ROLLBACK TO SAVEPOINT "+name)
+		tx.mu.Lock()
+		if len(tx.state.events) > events {
+			tx.state.events = tx.state.events[:events]
+		}
+		tx.mu.Unlock()
+	}()
+	if err := fn(nested); err != nil {
+		return err
+	}
+	if _, err := tx.tx.ExecContext(tx.ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return err
+	}
+	released = true
+	return nil
+}
+
+// Context return the context of the transaction, orm.Transaction called with it create a savepoint
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Database return the name of the database of the transaction
+func (tx *Tx) Database() string {
+	return tx.db.Name
+}
+
+// Table return a BuilderM running on the transaction
+func (tx *Tx) Table(tableName string) *BuilderM {
+	return &BuilderM{
+		tableName: tableName,
+		database:  tx.db.Name,
+		tx:        tx,
+	}
+}
+
+// TxModel return a Builder[T] running on the transaction
+func TxModel[T comparable](tx *Tx) *Builder[T] {
+	b := Model[T]()
+	if b == nil {
+		return nil
+	}
+	b.database = tx.db.Name
+	b.tx = tx
+	return b
+}
+
+// Exec execute a statement in the transaction
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	adaptPlaceholdersToDialect(&query, tx.db.Dialect)
+	return tx.tx.ExecContext(tx.ctx, query, args...)
+}
+
+func (tx *Tx) check() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.state.done {
+		return ErrTxDone
+	}
+	return nil
+}
+
+// publish keep a cache event until the transaction is committed
+func (tx *Tx) publish(event map[string]string) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.state.events = append(tx.state.events, event)
+}
+
+// finish mark the transaction done and return its cache events
+func (tx *Tx) finish() []map[string]string {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.state.done = true
+	events := tx.state.events
+	tx.state.events = nil
+	return events
+}
+
+// txFrom return the transaction of a builder, set by tx.Table, TxModel or a context of a transaction
+func txFrom(tx *Tx, ctx context.Context, database string) (*Tx, error) {
+	if tx == nil && ctx != nil {
+		tx, _ = ctx.Value(txKey{}).(*Tx)
+		if tx != nil && tx.db.Name != database {
+			// the context belong to a transaction on another database
+			return nil, nil
+		}
+	}
+	if tx == nil {
+		return nil, nil
+	}
+	if tx.db.Name != database {
+		return nil, fmt.Errorf("the transaction is on database %s, not %s", tx.db.Name, database)
+	}
+	return tx, tx.check()
+}
+
+// conn return the executor and the context used to run a statement on db
+func conn(tx *Tx, ctx context.Context, db *DatabaseEntity) (executor, context.Context, error) {
+	t, err := txFrom(tx, ctx, db.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != nil {
+		if ctx == nil {
+			ctx = t.ctx
+		}
+		return t.tx, ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.Conn, ctx, nil
+}
+
+// publishCache publish a cache event now, or after commit when running in a transaction
+func publishCache(tx *Tx, ctx context.Context, typ, table, database string) {
+	if !UseCache {
+		return
+	}
+	event := map[string]string{
+		"type":     typ,
+		"table":    table,
+		"database": database,
+	}
+	if t, err := txFrom(tx, ctx, database); err == nil && t != nil {
+		t.publish(event)
+		return
+	}
+	eventbus.Publish(CACHE_TOPIC, event)
+}
+
+// inTx return true if the builder run in a transaction, its reads must not use the cache
+func inTx(tx *Tx, ctx context.Context, database string) bool {
+	t, _ := txFrom(tx, ctx, database)
+	return tx != nil || t != nil
+}
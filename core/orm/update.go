@@ -0,0 +1,246 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils"
+)
+
+// Expression is a sql expression used as the value of a column
+type Expression struct {
+	query string
+	args  []any
+}
+
+// Expr return an expression to set a column from sql, like orm.Expr("views + ?", 1)
+func Expr(query string, args ...any) Expression {
+	return Expression{query: query, args: args}
+}
+
+// SetExpr set column to expr in the next Update
+//
+//	orm.Model[Post]().Where("id = ?", id).SetExpr("views", orm.Expr("views + ?", 1)).Update(nil)
+func (b *Builder[T]) SetExpr(column string, expr Expression) *Builder[T] {
+	b.exprCols = append(b.exprCols, column)
+	b.exprs = append(b.exprs, expr)
+	return b
+}
+
+// Update update fields of model, its columns in snake case or struct field names, the pk and autoinc columns are skipped.
+// Without fields, only the fields changed from the row of the pk of model are updated, columns tagged update being set by the database.
+// Rows are selected using Where, or the pk of model
+//
+//	_, err := orm.Model[models.User]().Update(&user, "email", "is_admin")
+func (b *Builder[T]) Update(model *T, fields ...string) (int, error) {
+	if b.tableName == "" {
+		tName := getTableName[T]()
+		if tName == "" {
+			return 0, errors.New("unable to find tableName from model")
+		}
+		b.tableName = tName
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	if model == nil && len(fields) > 0 {
+		return 0, errors.New("fields given without model")
+	}
+	if !b.hooking && model != nil && hasModelHook[T](BEFORE_UPDATE, AFTER_UPDATE) {
+		var n int
+		err := b.withHooks(BEFORE_UPDATE, AFTER_UPDATE, func() ([]*T, error) {
+			return []*T{model}, nil
+		}, func() (err error) {
+			n, err = b.Update(model, fields...)
+			return err
+		})
+		return n, err
+	}
+
+	typ := reflect.TypeOf(*new(T))
+	pk := pkOf(typ)
+	var pkValue any
+	cols := []string{}
+	args := []any{}
+	if model != nil {
+		names, values, _, tags := getStructInfos(model)
+		pkValue = values[pk]
+		skipped := func(name string) bool {
+			return name == pk || utils.SliceContains(tags[name], "autoinc", "pk", "softdelete")
+		}
+		if len(fields) > 0 {
+			for _, f := range fields {
+				name := utils.ToSnakeCase(strings.TrimSpace(f))
+				if _, ok := values[name]; !ok {
+					return 0, fmt.Errorf("field %s not found in %s", f, typ.Name())
+				}
+				if !skipped(name) {
+					cols = append(cols, name)
+				}
+			}
+		} else {
+			if isZero(pkValue) {
+				return 0, errors.New("no fields given and the model has no primary key value")
+			}
+			current, err := b.current(pk, pkValue)
+			if err != nil {
+				return 0, err
+			}
+			_, old, _, _ := getStructInfos(&current)
+			for _, name := range names {
+				if !skipped(name) && !utils.SliceContains(tags[name], "update") && !sameValue(old[name], values[name]) {
+					cols = append(cols, name)
+				}
+			}
+		}
+		for _, col := range cols {
+			args = append(args, values[col])
+		}
+	}
+	set := make([]string, 0, len(cols)+len(b.exprs))
+	for _, col := range cols {
+		set = append(set, col+" = ?")
+	}
+	for i, e := range b.exprs {
+		set = append(set, b.exprCols[i]+" = "+e.query)
+		args = append(args, e.args...)
+	}
+	if len(set) == 0 {
+		return 0, nil
+	}
+
+	if b.whereQuery == "" {
+		if isZero(pkValue) {
+			return 0, errors.New("you should use Where, or give a model with a primary key value")
+		}
+		b.Where(pk+" = ?", pkValue)
+	}
+	return b.Set(strings.Join(set, ", "), args...)
+}
+
+// Save insert model if its pk is zero, setting its pk, or update the fields changed from the row of its pk, inserting it if not found
+func (b *Builder[T]) Save(model *T) (int, error) {
+	if model == nil {
+		return 0, errors.New("nil model")
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	typ := reflect.TypeOf(*new(T))
+	pk := pkOf(typ)
+	idx, ok := columnsOf(typ)[pk]
+	if !ok {
+		return 0, fmt.Errorf("primary key %s not found in %s", pk, typ.Name())
+	}
+	field := reflect.ValueOf(model).Elem().Field(idx)
+	if field.IsZero() {
+		// hooks run on the inserted copy
+		models := []T{*model}
+		ids, err := b.InsertMany(models)
+		if err != nil {
+			return 0, err
+		}
+		*model = models[0]
+		if len(ids) == 1 && strings.Contains(field.Kind().String(), "int") {
+			if strings.HasPrefix(field.Kind().String(), "uint") {
+				field.SetUint(uint64(ids[0]))
+			} else {
+				field.SetInt(ids[0])
+			}
+		}
+		return 1, nil
+	}
+	n, err := b.Update(model)
+	if err != nil && err.Error() == "no data found" {
+		models := []T{*model}
+		if _, err := b.Upsert(pk, "", models...); err != nil {
+			return 0, err
+		}
+		*model = models[0]
+		return 1, nil
+	}
+	return n, err
+}
+
+// current return the row of the primary key, without cache
+func (b *Builder[T]) current(pk string, value any) (T, error) {
+	rows, err := b.queryS("select * from "+b.tableName+" WHERE "+pk+" = ?", value)
+	if err != nil {
+		return *new(T), err
+	}
+	return rows[0], nil
+}
+
+// Update update columns of row, values can be expressions like orm.Expr("views + ?", 1), the pk of the table is skipped,
+// keys not being columns of the table return ErrUnknownColumn
+//
+//	_, err := orm.Table("posts").Where("id = ?", id).Update(map[string]any{"title": title, "views": orm.Expr("views + ?", 1)})
+func (b *BuilderM) Update(row map[string]any) (int, error) {
+	if b.tableName == "" {
+		return 0, errors.New("unable to find model, try db.Table before")
+	}
+	if b.database == "" {
+		b.database = settings.Config.Db.Name
+	}
+	// keys are written in the SET clause, only columns of the table are accepted, checked again after before hooks
+	keys := make([]string, 0, len(row))
+	for col := range row {
+		keys = append(keys, col)
+	}
+	if err := checkColumns(b.database, b.tableName, keys...); err != nil {
+		return 0, err
+	}
+	if !b.hooking && hasTableHook(b.tableName, BEFORE_UPDATE, AFTER_UPDATE) {
+		var n int
+		err := b.withHooks(BEFORE_UPDATE, AFTER_UPDATE, func() ([]map[string]any, error) {
+			return []map[string]any{row}, nil
+		}, func() (err error) {
+			n, err = b.Update(row)
+			return err
+		})
+		return n, err
+	}
+	pk := "id"
+	if t, err := GetMemoryTable(b.tableName, b.database); err == nil && t.Pk != "" {
+		pk = t.Pk
+	}
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		if col != pk {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	sort.Strings(cols)
+	set := make([]string, 0, len(cols))
+	args := []any{}
+	for _, col := range cols {
+		if e, ok := row[col].(Expression); ok {
+			set = append(set, col+" = "+e.query)
+			args = append(args, e.args...)
+			continue
+		}
+		set = append(set, col+" = ?")
+		args = append(args, row[col])
+	}
+	return b.Set(strings.Join(set, ", "), args...)
+}
+
+func isZero(v any) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+func sameValue(a, b any) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return reflect.DeepEqual(a, b)
+}
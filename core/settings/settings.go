@@ -15,8 +15,8 @@ var MEDIA_DIR = "media"
 var Languages = []string{}
 
 type GlobalConfig struct {
-	Host  string `env:"HOST|localhost"`
-	Port  string `env:"PORT|9313"`
+	Host  string `env:"HOST|localhost" flag:"h"`
+	Port  string `env:"PORT|9313" flag:"p"`
 	Embed struct {
 		Static    bool `env:"EMBED_STATIC|false"`
 		Templates bool `env:"EMBED_TEMPLATES|false"`
@@ -32,11 +32,37 @@ type GlobalConfig struct {
 		Host  string `env:"SMTP_HOST|"`
 		Port  string `env:"SMTP_PORT|"`
 	}
-	Profiler   bool   `env:"PROFILER|false"`
-	Docs       bool   `env:"DOCS|false"`
-	Logs       bool   `env:"LOGS|false"`
-	Monitoring bool   `env:"MONITORING|false"`
-	Cert       string `env:"CERT|"`
-	Key        string `env:"KEY|"`
-	Domains    string `env:"DOMAINS|"`
+	Profiler   bool   `env:"PROFILER|false" flag:"profiler"`
+	Docs       bool   `env:"DOCS|false" flag:"docs"`
+	Logs       bool   `env:"LOGS|false" flag:"logs"`
+	Monitoring bool   `env:"MONITORING|false" flag:"monitoring"`
+	Cert       string `env:"CERT|" flag:"cert"`
+	Key        string `env:"KEY|" flag:"key"`
+	Domains    string `env:"DOMAINS|" flag:"domains"`
+	// CertsCache is where autocert store certificates, a directory, or 'db' to share them between instances using the database
+	CertsCache string `env:"CERTS_CACHE|certs"`
+	// RedirectAddr is a plain HTTP address (ex: ':80') answering ACME challenges and redirecting to https
+	RedirectAddr string `env:"REDIRECT_ADDR|" flag:"redirect"`
+	// Socket is a unix domain socket path where the app is served too
+	Socket string `env:"SOCKET|" flag:"socket"`
+	// H2C accept cleartext HTTP/2 on listeners without TLS
+	H2C bool `env:"H2C|false" flag:"h2c"`
+	// Secret encrypt sessions and tokens, if empty it is generated once in SecretFile
+	Secret string `env:"SECRET|"`
+	// OldSecrets are previous secrets, comma separated, data encrypted with them can still be decrypted
+	OldSecrets []string `env:"OLD_SECRETS|"`
+	// SecretFile is where the generated secret and the old ones kept after a rotation are stored, readable only by the owner
+	SecretFile string `env:"SECRET_FILE|.secret"`
+	// DefaultLanguage is used when the language is not given by the lang param, the lang cookie or Accept-Language
+	DefaultLanguage string `env:"DEFAULT_LANGUAGE|en"`
+	// GeoIPFile is a MaxMind DB file (.mmdb) of countries or cities used to locate ips offline
+	GeoIPFile string `env:"GEOIP_FILE|"`
+	// GeoIPASNFile is a MaxMind DB file (.mmdb) of autonomous systems, optional
+	GeoIPASNFile string `env:"GEOIP_ASN_FILE|"`
+	// TrustedProxies are ips or CIDRs of reverse proxies, comma separated, their Forwarded and X-Forwarded-* headers give the client ip, scheme and host
+	TrustedProxies []string `env:"TRUSTED_PROXIES|"`
+	// Dev parse templates again when files change
+	Dev bool `env:"DEV|false" flag:"dev"`
+	// Force2FA require every admin to enroll TOTP before accessing the admin panel
+	Force2FA bool `env:"FORCE_2FA|false"`
 }
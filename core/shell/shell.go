@@ -14,12 +14,14 @@ import (
 	"github.com/kamalshkeir/kago/core/orm"
 	"github.com/kamalshkeir/kago/core/settings"
 	"github.com/kamalshkeir/kago/core/utils"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"github.com/kamalshkeir/kago/core/utils/i18n"
 	"github.com/kamalshkeir/kago/core/utils/input"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 )
 
 const helpS string = `Commands :  
-[databases, use, tables, columns, migrate, createsuperuser, createuser, getall, get, drop, delete, clear/cls, q/quit/exit, help/commands]
+[databases, use, tables, columns, migrate, createsuperuser, createuser, getall, get, drop, delete, rotatesecret, missingkeys, clear/cls, q/quit/exit, help/commands]
   'databases':
 	  list all connected databases
 
@@ -33,7 +35,25 @@ const helpS string = `Commands :
 	  list all columns of a table
 
   'migrate':
-	  migrate initial users to env database
+	  migrate initial users to env database, or a .sql file
+
+  'migrate up [N]':
+	  apply the N first pending migrations of the migrations folder, all if N not given
+
+  'migrate down [N]':
+	  roll back the N last applied migrations, the last one if N not given
+
+  'migrate status':
+	  list migrations, applied or pending
+
+  'migrate create name':
+	  create the up and down files of a new migration in the migrations folder
+
+  'migrate redo':
+	  roll back and apply again the last migration
+
+  'migrate unlock':
+	  remove the migrations lock left by a killed instance (sqlite)
 
   'createsuperuser':
 	  create a admin user
@@ -53,11 +73,17 @@ const helpS string = `Commands :
   'drop':
 	  drop a table given table name
 
+  'rotatesecret':
+	  generate a new secret in the secret file, old ones still decrypt existing data, restart servers to use it
+
+  'missingkeys':
+	  list translation keys missing in each language file
+
   'clear/cls':
 	  clear console
 `
 
-const commandsS string = "Commands :  [databases, use, tables, columns, migrate, createsuperuser, createuser, getall, get, drop, delete, clear/cls, q!/quit/exit, help/commands]"
+const commandsS string = "Commands :  [databases, use, tables, columns, migrate, createsuperuser, createuser, getall, get, drop, delete, rotatesecret, missingkeys, clear/cls, q!/quit/exit, help/commands]"
 
 // InitShell init the shell and return true if used to stop main
 func InitShell() bool {
@@ -78,19 +104,22 @@ func InitShell() bool {
 	case "shell":
 		databases := orm.GetMemoryDatabases()
 		var conn *sql.DB
+		// database of migrate commands, the one chosen below
+		dbName := settings.Config.Db.Name
 		if len(databases) > 1 {
 			fmt.Printf(logger.Yellow, "-----------------------------------")
 			fmt.Printf(logger.Blue, "Found many databases:")
 			for _, db := range databases {
 				fmt.Printf(logger.Blue, `  - `+db.Name)
 			}
-			dbName, err := input.String(input.Blue, "Enter Database Name to use: ")
+			name, err := input.String(input.Blue, "Enter Database Name to use: ")
 			if logger.CheckError(err) {
 				return true
 			}
-			if dbName == "" {
+			if name == "" {
 				return true
 			}
+			dbName = name
 			orm.UseForAdmin(dbName)
 			conn = orm.GetConnection(dbName)
 		} else {
@@ -108,6 +137,10 @@ func InitShell() bool {
 				return true
 			}
 
+			if strings.HasPrefix(command, "migrate ") {
+				migrateCommand(dbName, strings.Fields(command)[1:])
+				continue
+			}
 			switch command {
 			case "quit", "exit", "q", "q!":
 				return true
@@ -141,6 +174,7 @@ func InitShell() bool {
 			case "use":
 				db := input.Input(input.Blue, "database name: ")
 				orm.UseForAdmin(db)
+				dbName = db
 				fmt.Printf(logger.Green, "you are using database "+db)
 			case "tables":
 				fmt.Printf(logger.Green, orm.GetAllTables(settings.Config.Db.Name))
@@ -164,10 +198,23 @@ func InitShell() bool {
 				dropTable()
 			case "delete":
 				deleteRow()
+			case "rotatesecret":
+				rotateSecret()
+			case "missingkeys":
+				missingKeys()
 			default:
 				fmt.Printf(logger.Red, "command not handled, use 'help' or 'commands' to list available commands ")
 			}
 		}
+	case "migrate":
+		migrateCommand(settings.Config.Db.Name, args[2:])
+		return true
+	case "rotatesecret":
+		rotateSecret()
+		return true
+	case "missingkeys":
+		missingKeys()
+		return true
 	case "pushTag":
 		if len(args) > 2 {
 			pushGit(args[2])
@@ -267,6 +314,91 @@ func migratefromfile(path string) error {
 	return nil
 }
 
+// migrateCommand run the versioned migrations subcommand args of the migrations folder on dbName: up [N], down [N], status, create name, redo and unlock
+func migrateCommand(dbName string, args []string) {
+	if len(args) == 0 {
+		fmt.Printf(logger.Red, "usage: migrate up [N] | down [N] | status | create name | redo | unlock")
+		return
+	}
+	n := 0
+	if len(args) > 1 && args[0] != "create" {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Printf(logger.Red, "N should be a positive number, got "+args[1])
+			return
+		}
+	}
+	migrations := orm.MigrationsFromDir(orm.MIGRATION_FOLDER, dbName)
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(n)
+		for _, m := range applied {
+			fmt.Printf(logger.Green, fmt.Sprintf("applied %04d_%s", m.Version, m.Name))
+		}
+		if logger.CheckError(err) {
+			return
+		}
+		if len(applied) == 0 {
+			fmt.Printf(logger.Green, "no pending migrations")
+		}
+	case "down":
+		rolledBack, err := migrations.Down(n)
+		for _, m := range rolledBack {
+			fmt.Printf(logger.Green, fmt.Sprintf("rolled back %04d_%s", m.Version, m.Name))
+		}
+		if logger.CheckError(err) {
+			return
+		}
+		if len(rolledBack) == 0 {
+			fmt.Printf(logger.Green, "no applied migrations")
+		}
+	case "status":
+		status, err := migrations.Status()
+		if logger.CheckError(err) {
+			return
+		}
+		if len(status) == 0 {
+			fmt.Printf(logger.Yellow, "no migrations found in "+orm.MIGRATION_FOLDER)
+		}
+		for _, s := range status {
+			line := fmt.Sprintf("%04d_%s", s.Version, s.Name)
+			switch {
+			case s.Missing:
+				fmt.Printf(logger.Red, line+"  applied "+s.AppliedAt.Format("2006-01-02 15:04:05")+", files missing")
+			case s.Changed:
+				fmt.Printf(logger.Red, line+"  applied "+s.AppliedAt.Format("2006-01-02 15:04:05")+", changed since")
+			case s.Applied:
+				fmt.Printf(logger.Green, line+"  applied "+s.AppliedAt.Format("2006-01-02 15:04:05"))
+			default:
+				fmt.Printf(logger.Yellow, line+"  pending")
+			}
+		}
+	case "create":
+		if len(args) < 2 {
+			fmt.Printf(logger.Red, "usage: migrate create name")
+			return
+		}
+		up, down, err := orm.CreateMigration(orm.MIGRATION_FOLDER, strings.Join(args[1:], "_"))
+		if logger.CheckError(err) {
+			return
+		}
+		fmt.Printf(logger.Green, up+" and "+down+" created")
+	case "redo":
+		m, err := migrations.Redo()
+		if logger.CheckError(err) {
+			return
+		}
+		fmt.Printf(logger.Green, fmt.Sprintf("redone %04d_%s", m.Version, m.Name))
+	case "unlock":
+		if !logger.CheckError(migrations.Unlock()) {
+			fmt.Printf(logger.Green, "migrations unlocked")
+		}
+	default:
+		fmt.Printf(logger.Red, "migrate "+args[0]+" not handled, use up, down, status, create, redo or unlock")
+	}
+}
+
 func dropTable() {
 	tableName := input.Input(input.Blue, "Table to drop : ")
 	if tableName != "" {
@@ -307,6 +439,37 @@ func deleteRow() {
 	}
 }
 
+func rotateSecret() {
+	id, err := encryptor.RotateSecret()
+	if err != nil {
+		fmt.Printf(logger.Red, "unable to rotate secret: "+err.Error())
+		return
+	}
+	fmt.Printf(logger.Green, "new secret "+id+" generated, restart servers to use it")
+}
+
+func missingKeys() {
+	if err := i18n.Load(settings.TranslationFolder); err != nil {
+		fmt.Printf(logger.Red, "unable to load translations: "+err.Error())
+		return
+	}
+	missing := i18n.Missing()
+	found := false
+	for _, lang := range i18n.Languages() {
+		if len(missing[lang]) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf(logger.Yellow, lang+" is missing "+strconv.Itoa(len(missing[lang]))+" keys:")
+		for _, k := range missing[lang] {
+			fmt.Printf(logger.Blue, "  - "+k)
+		}
+	}
+	if !found {
+		fmt.Printf(logger.Green, "no missing keys")
+	}
+}
+
 func pushGit(version string) {
 	if strings.TrimSpace(version) == "" {
 		logger.Error("version tag cannot be empty")
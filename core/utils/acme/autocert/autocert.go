@@ -31,7 +31,7 @@ import (
 	"sync"
 	"time"
 
-	"golang.org/x/crypto/acme"
+	"github.com/kamalshkeir/kago/core/utils/acme"
 	"golang.org/x/net/idna"
 )
 
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kamalshkeir/kago/core/utils/envloader"
+)
+
+// DefaultFiles are the config files read by the router, missing ones are skipped
+var DefaultFiles = []string{"config.yaml", "config.yml", "config.json", "config.toml"}
+
+// Options of Load
+type Options struct {
+	// Files are YAML, JSON or TOML files depending on their extension, missing files are skipped, later files override earlier ones
+	Files []string
+	// EnvFiles are .env files, missing files are skipped
+	EnvFiles []string
+	// Args are the command line arguments, os.Args[1:] if nil
+	Args []string
+}
+
+// Error list every missing or invalid value found by Load
+type Error []string
+
+func (e Error) Error() string {
+	return "config: " + strings.Join(e, ", ")
+}
+
+// Load fill dest, a pointer to struct, from these layers, each one overriding the previous:
+//   - defaults: `env:"NAME|default"` or `default:"value"` tags
+//   - Files: keys are `config:"key"` tags or snake_case field names, nested structs are nested tables, NAME from the env tag is accepted at top level
+//   - EnvFiles then environment variables using NAME from the env tag, empty values are ignored
+//   - Args for fields having a `flag:"name"` tag: -name=value, -name value, --name value, or -name for bools
+//
+// fields with an env tag without '|' or with `required:"true"` are required,
+// all missing and invalid values are returned together in an Error
+func Load(dest any, opts Options) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config: dest is not a pointer to struct")
+	}
+	errs := Error{}
+
+	files := map[string]any{}
+	for _, file := range opts.Files {
+		m, err := readFile(file)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+		merge(files, m)
+	}
+
+	dotenv := map[string]string{}
+	for _, file := range opts.EnvFiles {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		m, err := envloader.LoadToMap(file)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for k, val := range m {
+			dotenv[k] = val
+		}
+	}
+
+	fields := []field{}
+	collect(v.Elem(), nil, &fields)
+
+	args := opts.Args
+	if args == nil && len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+	flags := parseArgs(args, fields)
+
+	for _, f := range fields {
+		set := false
+		apply := func(source string, val any) {
+			if err := setAny(f.v, val); err != nil {
+				errs = append(errs, fmt.Sprintf("%s from %s: %v", f.name(), source, err))
+				return
+			}
+			set = true
+		}
+		if f.hasDefault && f.def == "" {
+			f.v.Set(reflect.Zero(f.v.Type()))
+		} else if f.hasDefault {
+			apply("default", f.def)
+		}
+		if val, ok := lookup(files, f.path); ok {
+			apply("file", val)
+		} else if f.env != "" {
+			if val, ok := lookup(files, []string{f.env}); ok {
+				apply("file", val)
+			}
+		}
+		if f.env != "" {
+			if val := os.Getenv(f.env); val != "" {
+				apply("env", val)
+			} else if val := dotenv[f.env]; val != "" {
+				apply(".env", val)
+			}
+		}
+		if val, ok := flags[f.flag]; ok && f.flag != "" {
+			apply("flag -"+f.flag, val)
+		}
+		if f.required && !set {
+			errs = append(errs, f.name()+" is required")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// field is a struct field that receive a value
+type field struct {
+	v          reflect.Value
+	path       []string
+	env        string
+	def        string
+	hasDefault bool
+	required   bool
+	flag       string
+}
+
+func (f field) name() string {
+	if f.env != "" {
+		return f.env
+	}
+	return strings.Join(f.path, ".")
+}
+
+var (
+	durationType  = reflect.TypeOf(time.Duration(0))
+	unmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// collect walk the struct, nested structs without env tag are walked too
+func collect(s reflect.Value, path []string, fields *[]field) {
+	t := s.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := sf.Tag.Get("config")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = snakeCase(sf.Name)
+		}
+		fv := s.Field(i)
+		envTag, hasEnv := sf.Tag.Lookup("env")
+		if !hasEnv && !reflect.PtrTo(sf.Type).Implements(unmarshalType) {
+			if sf.Type.Kind() == reflect.Struct {
+				collect(fv, append(append([]string{}, path...), key), fields)
+				continue
+			}
+			if sf.Type.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				collect(fv.Elem(), append(append([]string{}, path...), key), fields)
+				continue
+			}
+		}
+		f := field{
+			v:        fv,
+			path:     append(append([]string{}, path...), key),
+			flag:     sf.Tag.Get("flag"),
+			required: sf.Tag.Get("required") == "true",
+		}
+		if hasEnv {
+			name, def, ok := strings.Cut(envTag, "|")
+			f.env = strings.TrimSpace(name)
+			f.def, f.hasDefault = def, ok
+			if !ok {
+				f.required = true
+			}
+		}
+		if def, ok := sf.Tag.Lookup("default"); ok {
+			f.def, f.hasDefault = def, true
+		}
+		*fields = append(*fields, f)
+	}
+}
+
+// snakeCase convert field names, RedirectAddr -> redirect_addr, DSN -> dsn, HTTPServer -> http_server
+func snakeCase(s string) string {
+	r := []rune(s)
+	b := strings.Builder{}
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+func readFile(file string) (map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		m, err = parseYAML(data)
+	case ".json":
+		d := json.NewDecoder(strings.NewReader(string(data)))
+		d.UseNumber()
+		err = d.Decode(&m)
+	case ".toml":
+		m, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file extension", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return m, nil
+}
+
+// merge deep merge src into dst
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				merge(dm, sm)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// lookup find the value at path, keys are case insensitive
+func lookup(m map[string]any, path []string) (any, bool) {
+	var cur any = m
+	for _, k := range path {
+		cm, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok := cm[k]
+		if !ok {
+			for ck, cv := range cm {
+				if strings.EqualFold(ck, k) {
+					v, ok = cv, true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		cur = v
+	}
+	return cur, cur != nil
+}
+
+// parseArgs return flags values by name, unknown flags are ignored
+func parseArgs(args []string, fields []field) map[string]string {
+	known := map[string]bool{}
+	for _, f := range fields {
+		if f.flag != "" {
+			known[f.flag] = f.v.Kind() == reflect.Bool
+		}
+	}
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			continue
+		}
+		name := strings.TrimLeft(a, "-")
+		if n, val, ok := strings.Cut(name, "="); ok {
+			if _, ok := known[n]; ok {
+				flags[n] = val
+			}
+			continue
+		}
+		isBool, ok := known[name]
+		if !ok {
+			continue
+		}
+		if isBool {
+			flags[name] = "true"
+		} else if i+1 < len(args) {
+			flags[name] = args[i+1]
+			i++
+		}
+	}
+	return flags
+}
+
+// setAny set a value from files, env or flags
+func setAny(v reflect.Value, val any) error {
+	if list, ok := val.([]any); ok && v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := setAny(s.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	switch val := val.(type) {
+	case string:
+		return setValue(v, val)
+	case float64:
+		return setValue(v, strconv.FormatFloat(val, 'f', -1, 64))
+	case map[string]any, []any:
+		return fmt.Errorf("cannot set %T into %s", val, v.Type())
+	default:
+		return setValue(v, fmt.Sprint(val))
+	}
+}
+
+// setValue parse s into v, slices are comma separated
+func setValue(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := []string{}
+		if strings.TrimSpace(s) != "" {
+			parts = strings.Split(s, ",")
+		}
+		sl := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setValue(sl.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), s)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
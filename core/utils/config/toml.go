@@ -0,0 +1,415 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parse TOML documents: tables, arrays of tables, dotted keys, strings (basic, literal and multi-line),
+// integers, floats, booleans, arrays and inline tables. Dates are returned as strings
+func parseTOML(data []byte) (map[string]any, error) {
+	p := &tomlParser{s: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1}
+	root := map[string]any{}
+	current := root
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.table(root)
+		} else {
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("toml line %d: %v", p.line, err)
+		}
+		p.skipSpaces()
+		if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+			return nil, fmt.Errorf("toml line %d: unexpected %q", p.line, p.rest())
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	i    int
+	line int
+}
+
+func (p *tomlParser) eof() bool  { return p.i >= len(p.s) }
+func (p *tomlParser) peek() byte { return p.s[p.i] }
+
+func (p *tomlParser) rest() string {
+	end := strings.IndexByte(p.s[p.i:], '\n')
+	if end < 0 {
+		return p.s[p.i:]
+	}
+	return p.s[p.i : p.i+end]
+}
+
+func (p *tomlParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.i++
+	}
+}
+
+// skipBlank skip spaces, newlines and comments
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.i++
+		case '\n':
+			p.line++
+			p.i++
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// table parse [a.b] or [[a.b]] and return the table where next keys go
+func (p *tomlParser) table(root map[string]any) (map[string]any, error) {
+	array := strings.HasPrefix(p.s[p.i:], "[[")
+	if array {
+		p.i += 2
+	} else {
+		p.i++
+	}
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.i:], closing) {
+		return nil, fmt.Errorf("expected %s", closing)
+	}
+	p.i += len(closing)
+
+	parent, err := descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		list, _ := parent[last].([]any)
+		t := map[string]any{}
+		parent[last] = append(list, t)
+		return t, nil
+	}
+	return descend(parent, []string{last})
+}
+
+// descend return the table at keys, creating missing ones, the last element of arrays of tables is used
+func descend(t map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]any{}
+			t[k] = next
+			t = next
+		case map[string]any:
+			t = v
+		case []any:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("key %s is not a table", k)
+			}
+			last, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("key %s is not a table", k)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("key %s is already defined", k)
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) keyValue(t map[string]any) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpaces()
+	if p.eof() || p.peek() != '=' {
+		return fmt.Errorf("expected '=' after key")
+	}
+	p.i++
+	p.skipSpaces()
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := descend(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exist := parent[last]; exist {
+		return fmt.Errorf("key %s is already defined", last)
+	}
+	parent[last] = v
+	return nil
+}
+
+// key parse a dotted key of bare or quoted parts
+func (p *tomlParser) key() ([]string, error) {
+	keys := []string{}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return nil, fmt.Errorf("expected a key")
+		}
+		switch p.peek() {
+		case '"', '\'':
+			k, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		default:
+			start := p.i
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.i++
+			}
+			if start == p.i {
+				return nil, fmt.Errorf("invalid key %q", p.rest())
+			}
+			keys = append(keys, p.s[start:p.i])
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	}
+	start := p.i
+	for !p.eof() && !strings.ContainsRune(" \t\n\r,]}#", rune(p.peek())) {
+		p.i++
+	}
+	// dates can contain a space between date and time
+	if p.i-start == 10 && !p.eof() && p.peek() == ' ' && p.i+1 < len(p.s) && p.s[p.i+1] >= '0' && p.s[p.i+1] <= '9' {
+		p.i++
+		for !p.eof() && !strings.ContainsRune(" \t\n\r,]}#", rune(p.peek())) {
+			p.i++
+		}
+	}
+	raw := p.s[start:p.i]
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return strconv.ParseFloat(strings.TrimPrefix(raw, "+"), 64)
+	}
+	clean := strings.ReplaceAll(raw, "_", "")
+	if n, err := strconv.ParseInt(clean, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, nil
+	}
+	if raw != "" && raw[0] >= '0' && raw[0] <= '9' && strings.ContainsAny(raw, "-:") {
+		// date, time or datetime
+		return raw, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", raw)
+}
+
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	multi := strings.Repeat(string(quote), 3)
+	if strings.HasPrefix(p.s[p.i:], multi) {
+		p.i += 3
+		// a newline following the opening delimiter is trimmed
+		if strings.HasPrefix(p.s[p.i:], "\n") {
+			p.i++
+			p.line++
+		}
+		end := strings.Index(p.s[p.i:], multi)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		// up to 2 quotes are allowed just before the closing delimiter
+		for end+3 < len(p.s[p.i:]) && p.s[p.i+end+3] == quote {
+			end++
+		}
+		raw := p.s[p.i : p.i+end]
+		p.line += strings.Count(raw, "\n")
+		p.i += end + 3
+		if quote == '\'' {
+			return raw, nil
+		}
+		// a backslash at the end of a line trim the newline and the following whitespaces
+		for {
+			j := strings.Index(raw, "\\\n")
+			if j < 0 {
+				break
+			}
+			k := j + 2
+			for k < len(raw) && strings.ContainsRune(" \t\n\r", rune(raw[k])) {
+				k++
+			}
+			raw = raw[:j] + raw[k:]
+		}
+		return unescapeTOML(raw)
+	}
+	p.i++
+	start := p.i
+	for !p.eof() && p.peek() != quote {
+		if p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if p.peek() == '\\' && quote == '"' {
+			p.i++
+		}
+		p.i++
+	}
+	if p.eof() {
+		return "", fmt.Errorf("unterminated string")
+	}
+	raw := p.s[start:p.i]
+	p.i++
+	if quote == '\'' {
+		return raw, nil
+	}
+	return unescapeTOML(raw)
+}
+
+func unescapeTOML(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("invalid escape")
+		}
+		switch s[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(s[i])
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", fmt.Errorf("invalid escape \\%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.i++
+	list := []any{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.i++
+			return list, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.i++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]any, error) {
+	p.i++
+	t := map[string]any{}
+	p.skipSpaces()
+	if !p.eof() && p.peek() == '}' {
+		p.i++
+		return t, nil
+	}
+	for {
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.i++
+		case '}':
+			p.i++
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
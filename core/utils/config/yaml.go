@@ -0,0 +1,444 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non empty line without comment
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseYAML parse the subset of YAML used by config files: nested mappings, block and flow sequences,
+// quoted and plain scalars, | and > block scalars. Anchors, tags and multi documents are not supported
+func parseYAML(data []byte) (map[string]any, error) {
+	raw := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	p := &yamlParser{raw: raw}
+	for i, l := range raw {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "---" && len(p.lines) == 0 {
+			continue
+		}
+		if trimmed == "..." || trimmed == "---" {
+			break
+		}
+		text := stripYamlComment(l)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.HasPrefix(text[indent:], "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: indent, text: strings.TrimSpace(text)})
+	}
+	if len(p.lines) == 0 {
+		return map[string]any{}, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml line %d: bad indentation", p.lines[p.pos].num)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("yaml: the document should be a mapping")
+	}
+	return m, nil
+}
+
+type yamlParser struct {
+	raw   []string
+	lines []yamlLine
+	pos   int
+}
+
+// block parse a mapping or a sequence whose items are at indent
+func (p *yamlParser) block(indent int) (any, error) {
+	if strings.HasPrefix(p.lines[p.pos].text, "- ") || p.lines[p.pos].text == "-" {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: bad indentation", l.num)
+		}
+		key, rest, err := splitYamlKey(l)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		v, err := p.value(l, rest, indent)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || !(strings.HasPrefix(l.text, "- ") || l.text == "-") {
+			return nil, fmt.Errorf("yaml line %d: expected a sequence item", l.num)
+		}
+		item := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		if item == "" {
+			p.pos++
+			v, err := p.nested(l, indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		if _, _, err := splitYamlKey(yamlLine{num: l.num, text: item}); err == nil && !isFlowOrQuoted(item) {
+			// '- key: value' start a mapping, next keys are aligned with key
+			itemIndent := l.indent + len(l.text) - len(item)
+			p.lines[p.pos] = yamlLine{num: l.num, indent: itemIndent, text: item}
+			m, err := p.mapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+			continue
+		}
+		p.pos++
+		v, err := p.value(l, item, indent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// value parse what follow a key or a dash, rest is the text on the same line
+func (p *yamlParser) value(l yamlLine, rest string, indent int) (any, error) {
+	switch {
+	case rest == "":
+		return p.nested(l, indent)
+	case rest[0] == '|' || rest[0] == '>':
+		return p.blockScalar(l, rest, indent)
+	case rest[0] == '[' || rest[0] == '{':
+		// flow collections may span many lines
+		text := rest
+		for !flowClosed(text) && p.pos < len(p.lines) {
+			text += " " + p.lines[p.pos].text
+			p.pos++
+		}
+		v, n, err := parseFlow(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: %v", l.num, err)
+		}
+		if strings.TrimSpace(text[n:]) != "" {
+			return nil, fmt.Errorf("yaml line %d: unexpected %q", l.num, text[n:])
+		}
+		return v, nil
+	}
+	v, err := yamlScalar(rest)
+	if err != nil {
+		return nil, fmt.Errorf("yaml line %d: %v", l.num, err)
+	}
+	return v, nil
+}
+
+// nested parse the block indented under l, nil if there is none
+func (p *yamlParser) nested(l yamlLine, indent int) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent {
+		return p.block(next.indent)
+	}
+	// sequences are allowed at the same indentation than their key
+	if next.indent == indent && strings.HasPrefix(next.text, "- ") && !strings.HasPrefix(l.text, "-") {
+		return p.sequence(indent)
+	}
+	return nil, nil
+}
+
+// blockScalar read raw lines more indented than indent, | keep newlines, > fold them, - strip the final newline
+func (p *yamlParser) blockScalar(l yamlLine, header string, indent int) (string, error) {
+	folded := header[0] == '>'
+	strip := strings.Contains(header, "-")
+	lines := []string{}
+	blockIndent := -1
+	i := l.num // index of the next raw line
+	for ; i < len(p.raw); i++ {
+		r := strings.TrimRight(p.raw[i], " \r")
+		if strings.TrimSpace(r) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		ind := len(r) - len(strings.TrimLeft(r, " "))
+		if ind <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = ind
+		}
+		if ind < blockIndent {
+			break
+		}
+		lines = append(lines, r[blockIndent:])
+	}
+	// skip parsed lines consumed by the block
+	for p.pos < len(p.lines) && p.lines[p.pos].num <= i {
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var s string
+	if folded {
+		// lines are joined by a space, empty lines become newlines
+		b := strings.Builder{}
+		for i, ln := range lines {
+			if ln == "" {
+				b.WriteByte('\n')
+				continue
+			}
+			if i > 0 && lines[i-1] != "" {
+				b.WriteByte(' ')
+			}
+			b.WriteString(ln)
+		}
+		s = b.String()
+	} else {
+		s = strings.Join(lines, "\n")
+	}
+	if !strip && s != "" {
+		s += "\n"
+	}
+	return s, nil
+}
+
+func splitYamlKey(l yamlLine) (string, string, error) {
+	text := l.text
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := strings.IndexByte(text[1:], text[0])
+		if end >= 0 && strings.HasPrefix(text[end+2:], ":") {
+			return text[1 : end+1], strings.TrimSpace(text[end+3:]), nil
+		}
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if strings.HasSuffix(text, ":") {
+			i = len(text) - 1
+		} else {
+			return "", "", fmt.Errorf("yaml line %d: expected 'key: value'", l.num)
+		}
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), nil
+}
+
+func isFlowOrQuoted(s string) bool {
+	return s[0] == '[' || s[0] == '{' || s[0] == '"' || s[0] == '\''
+}
+
+// stripYamlComment remove a # comment starting the line or preceded by a space, outside quotes
+func stripYamlComment(l string) string {
+	var quote byte
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" :-[{,", rune(l[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return strings.TrimRight(l[:i], " \t")
+		}
+	}
+	return strings.TrimRight(l, " \t")
+}
+
+func flowClosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// parseFlow parse [a, b] or {a: 1} at the start of s, it return the value and the number of bytes read
+func parseFlow(s string) (any, int, error) {
+	i := 0
+	skip := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+	}
+	var item func() (any, error)
+	item = func() (any, error) {
+		skip()
+		if i >= len(s) {
+			return nil, fmt.Errorf("unterminated flow collection")
+		}
+		switch s[i] {
+		case '[', '{':
+			v, n, err := parseFlow(s[i:])
+			i += n
+			return v, err
+		case '"', '\'':
+			q := s[i]
+			j := i + 1
+			for j < len(s) && s[j] != q {
+				if s[j] == '\\' && q == '"' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			v, err := yamlScalar(s[i : j+1])
+			i = j + 1
+			return v, err
+		}
+		j := i
+		for j < len(s) && !strings.ContainsRune(",]}", rune(s[j])) && !(s[j] == ':' && j+1 < len(s) && s[j+1] == ' ') {
+			j++
+		}
+		v, err := yamlScalar(strings.TrimSpace(s[i:j]))
+		i = j
+		return v, err
+	}
+
+	open := s[0]
+	i = 1
+	if open == '[' {
+		list := []any{}
+		for {
+			skip()
+			if i < len(s) && s[i] == ']' {
+				return list, i + 1, nil
+			}
+			v, err := item()
+			if err != nil {
+				return nil, i, err
+			}
+			list = append(list, v)
+			skip()
+			if i < len(s) && s[i] == ',' {
+				i++
+			} else if i >= len(s) || s[i] != ']' {
+				return nil, i, fmt.Errorf("expected ',' or ']'")
+			}
+		}
+	}
+	m := map[string]any{}
+	for {
+		skip()
+		if i < len(s) && s[i] == '}' {
+			return m, i + 1, nil
+		}
+		k, err := item()
+		if err != nil {
+			return nil, i, err
+		}
+		skip()
+		if i >= len(s) || s[i] != ':' {
+			return nil, i, fmt.Errorf("expected ':' in flow mapping")
+		}
+		i++
+		v, err := item()
+		if err != nil {
+			return nil, i, err
+		}
+		m[fmt.Sprint(k)] = v
+		skip()
+		if i < len(s) && s[i] == ',' {
+			i++
+		} else if i >= len(s) || s[i] != '}' {
+			return nil, i, fmt.Errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// yamlScalar convert a scalar to string, bool, int64, float64 or nil
+func yamlScalar(s string) (any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch s[0] {
+	case '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if strings.HasPrefix(s, "0x") {
+		if n, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+			return n, nil
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
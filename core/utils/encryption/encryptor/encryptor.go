@@ -4,97 +4,191 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"strings"
+	"sync"
 
 	"github.com/kamalshkeir/kago/core/settings"
-	"github.com/kamalshkeir/kago/core/utils"
 	"golang.org/x/crypto/scrypt"
 )
 
-var keyEnv string
+// keySalt is used to derive the key of a secret once, legacy ciphertexts have their own salt
+var keySalt = []byte("kago-encryptor-v1")
 
-func Encrypt(data string) (string, error) {
-	keyEnv = settings.Secret
-	if keyEnv == "" {
-		keyEnv = utils.GenerateRandomString(19)
-		settings.Secret = keyEnv
-	}
-	keyByte, salt, err := deriveKey([]byte(keyEnv), nil)
-	if err != nil {
-		return "", err
-	}
+var (
+	mu         sync.Mutex
+	keys       = map[string]*key{}
+	legacyKeys = map[string][]byte{}
+	oldSecrets []string
+)
 
-	blockCipher, err := aes.NewCipher([]byte(keyByte))
-	if err != nil {
-		return "", err
-	}
+// key is the derived key of a secret, its id prefix every ciphertext encrypted with it
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
 
-	gcm, err := cipher.NewGCM(blockCipher)
+// Encrypt data with the current secret, the result is 'keyID.hex(nonce+ciphertext)'
+func Encrypt(data string) (string, error) {
+	k, err := keyOf(Secret())
 	if err != nil {
 		return "", err
 	}
-
-	nonce := make([]byte, gcm.NonceSize())
+	nonce := make([]byte, k.aead.NonceSize())
 	if _, err = rand.Read(nonce); err != nil {
 		return "", err
 	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(data), nil)
-
-	ciphertext = append(ciphertext, salt...)
-	return hex.EncodeToString(ciphertext), nil
+	ciphertext := k.aead.Seal(nonce, nonce, []byte(data), nil)
+	return k.id + "." + hex.EncodeToString(ciphertext), nil
 }
 
+// Decrypt data encrypted with the current secret or one of the old secrets kept after a rotation
 func Decrypt(data string) (string, error) {
-	if keyEnv == "" {
+	secrets := ring()
+	if len(secrets) == 0 {
 		return "", errors.New("no secret given, set SECRET in env file")
 	}
-	var salt []byte
-	dataByte, _ := hex.DecodeString(data)
-	if len(dataByte) > 32 {
-		salt, dataByte = dataByte[len(dataByte)-32:], dataByte[:len(dataByte)-32]
-	} else {
+	id, body, ok := strings.Cut(data, ".")
+	if !ok {
+		return decryptLegacy(data, secrets)
+	}
+	dataByte, err := hex.DecodeString(body)
+	if err != nil {
 		return "", errors.New("bad token")
 	}
+	for _, secret := range secrets {
+		if keyID(secret) != id {
+			continue
+		}
+		k, err := keyOf(secret)
+		if err != nil {
+			return "", err
+		}
+		if len(dataByte) < k.aead.NonceSize() {
+			return "", errors.New("bad token")
+		}
+		nonce, ciphertext := dataByte[:k.aead.NonceSize()], dataByte[k.aead.NonceSize():]
+		plaintext, err := k.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+	return "", errors.New("unknown key " + id)
+}
 
-	key, _, err := deriveKey([]byte(keyEnv), salt)
-	if err != nil {
-		return "", err
+// ring return the current secret followed by the old ones
+func ring() []string {
+	current := Secret()
+	if current == "" {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets := []string{current}
+	for _, s := range oldSecrets {
+		if s != current {
+			secrets = append(secrets, s)
+		}
 	}
+	return secrets
+}
 
-	blockCipher, err := aes.NewCipher(key)
+func keyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
+
+// keyOf derive and cache the key of a secret
+func keyOf(secret string) (*key, error) {
+	if secret == "" {
+		return nil, errors.New("no secret given, set SECRET in env file")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if k, ok := keys[secret]; ok {
+		return k, nil
+	}
+	derived, err := scrypt.Key([]byte(secret), keySalt, 1<<15, 8, 1, 32)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	gcm, err := cipher.NewGCM(blockCipher)
+	aead, err := newGCM(derived)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	k := &key{id: keyID(secret), aead: aead}
+	keys[secret] = k
+	return k, nil
+}
 
-	nonce, ciphertext := dataByte[:gcm.NonceSize()], dataByte[gcm.NonceSize():]
-
-	plaintext, err := gcm.Open(nil, []byte(nonce), []byte(ciphertext), nil)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	blockCipher, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return string(plaintext), nil
+	return cipher.NewGCM(blockCipher)
 }
 
-func deriveKey(password, salt []byte) ([]byte, []byte, error) {
-	if salt == nil {
-		salt = make([]byte, 32)
-		if _, err := rand.Read(salt); err != nil {
-			return nil, nil, err
+// decryptLegacy decrypt 'hex(nonce+ciphertext+salt)' produced before key ids, derived keys are cached by secret and salt
+func decryptLegacy(data string, secrets []string) (string, error) {
+	dataByte, _ := hex.DecodeString(data)
+	if len(dataByte) <= 32 {
+		return "", errors.New("bad token")
+	}
+	salt, dataByte := dataByte[len(dataByte)-32:], dataByte[:len(dataByte)-32]
+	var lastErr error
+	for _, secret := range secrets {
+		k, err := legacyKey(secret, salt)
+		if err != nil {
+			return "", err
+		}
+		aead, err := newGCM(k)
+		if err != nil {
+			return "", err
+		}
+		if len(dataByte) < aead.NonceSize() {
+			return "", errors.New("bad token")
+		}
+		nonce, ciphertext := dataByte[:aead.NonceSize()], dataByte[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err == nil {
+			return string(plaintext), nil
 		}
+		lastErr = err
 	}
+	return "", lastErr
+}
 
-	key, err := scrypt.Key(password, salt, 1<<10, 8, 1, 32)
+func legacyKey(secret string, salt []byte) ([]byte, error) {
+	cacheKey := secret + "|" + string(salt)
+	mu.Lock()
+	k, ok := legacyKeys[cacheKey]
+	mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	k, err := scrypt.Key([]byte(secret), salt, 1<<10, 8, 1, 32)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	mu.Lock()
+	if len(legacyKeys) >= 4096 {
+		legacyKeys = map[string][]byte{}
 	}
+	legacyKeys[cacheKey] = k
+	mu.Unlock()
+	return k, nil
+}
 
-	return key, salt, nil
+// Secret return settings.Secret, loading or generating it if empty
+func Secret() string {
+	if settings.Secret == "" {
+		if err := LoadSecret(); err != nil {
+			return ""
+		}
+	}
+	return settings.Secret
 }
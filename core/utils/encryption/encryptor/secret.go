@@ -0,0 +1,143 @@
+package encryptor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/logger"
+)
+
+// KeepOldSecrets is how many old secrets are kept in the secret file after a rotation, data encrypted with them can still be decrypted
+var KeepOldSecrets = 3
+
+// ErrSecretFromConfig is returned by RotateSecret when SECRET is set in config, rotate it there instead
+var ErrSecretFromConfig = errors.New("SECRET is set in config, set a new SECRET and add the old one to OLD_SECRETS instead")
+
+// LoadSecret set settings.Secret from config SECRET, or from the secret file, generating it the first time,
+// old secrets from OLD_SECRETS and the secret file can still decrypt
+func LoadSecret() error {
+	if settings.Config.Secret != "" {
+		settings.Secret = settings.Config.Secret
+	}
+	fileSecrets, err := readSecretFile()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	olds := append([]string{}, settings.Config.OldSecrets...)
+	if settings.Secret == "" {
+		if len(fileSecrets) == 0 {
+			secret, err := newSecret()
+			if err != nil {
+				return err
+			}
+			if err := writeSecretFile([]string{secret}); err != nil {
+				return err
+			}
+			logger.Printfs("grSecret generated in %s, keep it private and stable across deployments", secretFile())
+			fileSecrets = []string{secret}
+		}
+		settings.Secret = fileSecrets[0]
+		olds = append(olds, fileSecrets[1:]...)
+	} else {
+		olds = append(olds, fileSecrets...)
+	}
+	mu.Lock()
+	oldSecrets = olds
+	mu.Unlock()
+	return nil
+}
+
+// RotateSecret generate a new secret in the secret file, the previous one is kept to decrypt existing data,
+// running servers use it after a restart, the id of the new key is returned
+func RotateSecret() (string, error) {
+	if settings.Config.Secret != "" {
+		return "", ErrSecretFromConfig
+	}
+	fileSecrets, err := readSecretFile()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	secrets := append([]string{secret}, fileSecrets...)
+	if len(secrets) > KeepOldSecrets+1 {
+		secrets = secrets[:KeepOldSecrets+1]
+	}
+	if err := writeSecretFile(secrets); err != nil {
+		return "", err
+	}
+	settings.Secret = secret
+	mu.Lock()
+	oldSecrets = append(append([]string{}, settings.Config.OldSecrets...), secrets[1:]...)
+	mu.Unlock()
+	return keyID(secret), nil
+}
+
+func secretFile() string {
+	if settings.Config.SecretFile != "" {
+		return settings.Config.SecretFile
+	}
+	return ".secret"
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readSecretFile return secrets, one per line, the current one first
+func readSecretFile() ([]string, error) {
+	path := secretFile()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		logger.Warn("secret file", path, "is accessible by other users, run: chmod 600", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secrets := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			secrets = append(secrets, line)
+		}
+	}
+	return secrets, nil
+}
+
+// writeSecretFile replace the secret file atomically, readable only by the owner
+func writeSecretFile(secrets []string) error {
+	path := secretFile()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".secret-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	content := "# current secret first, old secrets still decrypt existing data\n" + strings.Join(secrets, "\n") + "\n"
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
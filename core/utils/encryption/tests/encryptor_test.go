@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/encryption/encryptor"
+	"golang.org/x/crypto/scrypt"
+)
+
+func useSecretFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), ".secret")
+	settings.Config.SecretFile = path
+	settings.Config.Secret = ""
+	settings.Config.OldSecrets = nil
+	settings.Secret = ""
+	t.Cleanup(func() {
+		settings.Config.SecretFile = ""
+		settings.Config.OldSecrets = nil
+		settings.Secret = ""
+	})
+	return path
+}
+
+func TestSecretPersisted(t *testing.T) {
+	path := useSecretFile(t)
+	if err := encryptor.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	secret := settings.Secret
+	if len(secret) < 32 {
+		t.Fatal("weak generated secret", secret)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Error("secret file should be readable only by the owner, got", fi.Mode().Perm())
+	}
+
+	// a restart load the same secret
+	settings.Secret = ""
+	if err := encryptor.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Secret != secret {
+		t.Error("secret changed after reload")
+	}
+
+	// config wins over the file
+	settings.Config.Secret = "from-config"
+	defer func() { settings.Config.Secret = "" }()
+	if err := encryptor.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Secret != "from-config" {
+		t.Error("SECRET from config not used")
+	}
+	if _, err := encryptor.RotateSecret(); err != encryptor.ErrSecretFromConfig {
+		t.Error("rotation should be refused when SECRET is in config, got", err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	useSecretFile(t)
+	settings.Secret = "encryptor-test-secret"
+	encrypted, err := encryptor.Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, ok := strings.Cut(encrypted, ".")
+	if !ok || len(id) != 8 {
+		t.Fatal("expected a key id envelope, got", encrypted)
+	}
+	decrypted, err := encryptor.Decrypt(encrypted)
+	if err != nil || decrypted != "hello" {
+		t.Fatal(decrypted, err)
+	}
+
+	settings.Secret = "another-secret"
+	if _, err := encryptor.Decrypt(encrypted); err == nil {
+		t.Error("decrypted with a wrong secret")
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	useSecretFile(t)
+	before, err := encryptor.Encrypt("before rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID, _, _ := strings.Cut(before, ".")
+
+	newID, err := encryptor.RotateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newID == oldID {
+		t.Fatal("key id did not change")
+	}
+	if decrypted, err := encryptor.Decrypt(before); err != nil || decrypted != "before rotation" {
+		t.Error("old data should still decrypt after a rotation", decrypted, err)
+	}
+	after, err := encryptor.Encrypt("after rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(after, newID+".") {
+		t.Error("new data should use the new key")
+	}
+
+	// old secrets are still known after a restart
+	settings.Secret = ""
+	if err := encryptor.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	for _, encrypted := range []string{before, after} {
+		if _, err := encryptor.Decrypt(encrypted); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// only KeepOldSecrets are kept
+	for i := 0; i < encryptor.KeepOldSecrets+1; i++ {
+		if _, err := encryptor.RotateSecret(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := encryptor.Decrypt(before); err == nil {
+		t.Error("secrets older than KeepOldSecrets should be dropped")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	useSecretFile(t)
+	settings.Secret = "legacy-secret"
+	settings.Config.OldSecrets = []string{"older-secret"}
+	if err := encryptor.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"legacy-secret", "older-secret"} {
+		legacy := legacyEncrypt(t, secret, "legacy data")
+		decrypted, err := encryptor.Decrypt(legacy)
+		if err != nil || decrypted != "legacy data" {
+			t.Error(secret, decrypted, err)
+		}
+	}
+}
+
+// legacyEncrypt is how data was encrypted before key ids: hex(nonce+ciphertext+salt) with a key derived per call
+func legacyEncrypt(t *testing.T, secret, data string) string {
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	key, err := scrypt.Key([]byte(secret), salt, 1<<10, 8, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	ciphertext := gcm.Seal(nonce, nonce, []byte(data), nil)
+	return hex.EncodeToString(append(ciphertext, salt...))
+}
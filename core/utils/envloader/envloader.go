@@ -4,45 +4,200 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"strings"
-	"sync"
 
 	"github.com/kamalshkeir/kago/core/utils/logger"
 	"github.com/kamalshkeir/kstrct"
 )
 
+// Load set env vars from .env files, variables already set in the environment are not overridden,
+// files are read in order and later files override earlier ones
 func Load(envFiles ...string) {
-	var wg sync.WaitGroup
 	if len(envFiles) == 0 {
-		Load(".env")
+		envFiles = []string{".env"}
 	}
-	wg.Add(len(envFiles))
+	m, err := LoadToMap(envFiles...)
+	if err != nil {
+		fmt.Println(err)
+	}
+	for k, v := range m {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		logger.CheckError(os.Setenv(k, v))
+	}
+}
+
+// LoadToMap read .env files without setting env vars, missing files are reported in the error, others are still read
+func LoadToMap(envFiles ...string) (map[string]string, error) {
+	m := map[string]string{}
+	errs := []string{}
 	for _, env := range envFiles {
-		go func(env string) {
-			defer wg.Done()
-			f, err := os.OpenFile(env, os.O_RDONLY, os.ModePerm)
-			if err != nil {
-				fmt.Println(err)
-				return
+		f, err := os.Open(env)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		vars, err := Parse(f, func(key string) (string, bool) {
+			if v, ok := m[key]; ok {
+				return v, true
 			}
-			defer f.Close()
-			r := bufio.NewScanner(f)
+			return os.LookupEnv(key)
+		})
+		f.Close()
+		if err != nil {
+			errs = append(errs, env+": "+err.Error())
+		}
+		for k, v := range vars {
+			m[k] = v
+		}
+	}
+	if len(errs) > 0 {
+		return m, errors.New(strings.Join(errs, ", "))
+	}
+	return m, nil
+}
+
+// Parse read KEY=value lines:
+//   - 'export ' prefix is ignored, lines starting with # are comments
+//   - unquoted values are trimmed, end at ' #' and are taken as is, 'pa$$word' is not expanded
+//   - "double quoted" values can span many lines and support \n \t \" \\ \$ escapes
+//   - 'single quoted' values can span many lines and are taken as is
+//   - ${VAR} and $VAR are expanded in double quoted values only, using previous lines, then lookup
+func Parse(r io.Reader, lookup func(string) (string, bool)) (map[string]string, error) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	vars := map[string]string{}
+	expandLookup := func(key string) (string, bool) {
+		if v, ok := vars[key]; ok {
+			return v, true
+		}
+		return lookup(key)
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return vars, fmt.Errorf("line %d: missing '='", lineNum)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return vars, fmt.Errorf("line %d: invalid key %q", lineNum, key)
+		}
+		value = strings.TrimSpace(value)
 
-			for r.Scan() {
-				sp := strings.Split(r.Text(), "=")
-				if len(sp) != 2 || r.Text()[0] == '#' {
-					continue
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			raw := value[1:]
+			start := lineNum
+			end := closingQuote(raw, quote)
+			for end < 0 {
+				if !sc.Scan() {
+					return vars, fmt.Errorf("line %d: unterminated quoted value", start)
 				}
-				sp[0] = strings.TrimSpace(sp[0])
-				sp[1] = strings.TrimSpace(sp[1])
-				err := os.Setenv(sp[0], sp[1])
-				logger.CheckError(err)
+				lineNum++
+				raw += "\n" + sc.Text()
+				end = closingQuote(raw, quote)
+			}
+			if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != '#' {
+				return vars, fmt.Errorf("line %d: unexpected %q after quoted value", lineNum, rest)
+			}
+			raw = raw[:end]
+			if quote == '\'' {
+				vars[key] = raw
+			} else {
+				vars[key] = expandQuoted(raw, expandLookup)
+			}
+			continue
+		}
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		vars[key] = value
+	}
+	return vars, sc.Err()
+}
+
+// closingQuote return the index of the closing quote in s, -1 if not found
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// expandQuoted replace escapes and ${VAR} or $VAR of a double quoted value in a single pass, so an escaped \$ stay a '$',
+// unknown variables are replaced by an empty string
+func expandQuoted(s string, lookup func(string) (string, bool)) string {
+	if !strings.ContainsAny(s, "\\$") {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i < len(s)-1:
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
 			}
-		}(env)
+		case s[i] == '$' && i < len(s)-1:
+			name, n := varName(s[i+1:])
+			if n == 0 {
+				b.WriteByte('$')
+				continue
+			}
+			v, _ := lookup(name)
+			b.WriteString(v)
+			i += n
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// varName return the variable name at the start of s, given as {NAME} or NAME, and the number of bytes it use
+func varName(s string) (string, int) {
+	if s[0] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 2 {
+			return "", 0
+		}
+		return s[1:end], end + 1
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 0 && s[n] >= '0' && s[n] <= '9') {
+		n++
 	}
-	wg.Wait()
+	return s[:n], n
 }
 
 // FillStructFromEnv fill the struct from env
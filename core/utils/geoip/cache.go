@@ -0,0 +1,56 @@
+package geoip
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry struct {
+	key    string
+	record Record
+}
+
+// lru keep the last looked up records
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lru) get(key string) (Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.list.MoveToFront(e)
+		return e.Value.(*entry).record, true
+	}
+	return Record{}, false
+}
+
+func (c *lru) add(key string, record Record) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.list.MoveToFront(e)
+		e.Value.(*entry).record = record
+		return
+	}
+	c.items[key] = c.list.PushFront(&entry{key, record})
+	if c.list.Len() > c.size {
+		last := c.list.Back()
+		c.list.Remove(last)
+		delete(c.items, last.Value.(*entry).key)
+	}
+}
@@ -0,0 +1,140 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// CacheSize is the number of ips kept in memory, set it before Load
+var CacheSize = 4096
+
+// ErrNotLoaded is returned by Lookup when no database is loaded
+var ErrNotLoaded = errors.New("geoip: no database loaded, set GEOIP_FILE")
+
+// Record is the location of an ip, fields are empty when not in the databases
+type Record struct {
+	Country       string // iso code 'FR'
+	CountryName   string
+	Continent     string // code 'EU'
+	ContinentName string
+	ASN           uint
+	Organization  string
+}
+
+var (
+	mu      sync.RWMutex
+	readers []*Reader
+	cache   = newLRU(CacheSize)
+)
+
+// Load open MaxMind DB files replacing the loaded ones, a country or city database and an ASN database can be combined
+//
+//	geoip.Load("GeoLite2-Country.mmdb", "GeoLite2-ASN.mmdb")
+func Load(files ...string) error {
+	loaded := make([]*Reader, 0, len(files))
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		r, err := Open(f)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, r)
+	}
+	Use(loaded...)
+	return nil
+}
+
+// Use replace the loaded databases by readers
+func Use(r ...*Reader) {
+	mu.Lock()
+	defer mu.Unlock()
+	readers = r
+	cache = newLRU(CacheSize)
+}
+
+// Loaded return true if a database is loaded
+func Loaded() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(readers) > 0
+}
+
+// Lookup return the location of ip, ip can contain a port or be a list of forwarded ips, the first one is used
+func Lookup(ip string) (Record, error) {
+	mu.RLock()
+	rs, c := readers, cache
+	mu.RUnlock()
+	if len(rs) == 0 {
+		return Record{}, ErrNotLoaded
+	}
+	parsed := ParseIP(ip)
+	if parsed == nil {
+		return Record{}, errors.New("geoip: invalid ip " + ip)
+	}
+	key := parsed.String()
+	if rec, ok := c.get(key); ok {
+		return rec, nil
+	}
+	rec := Record{}
+	for _, r := range rs {
+		v, err := r.Lookup(parsed)
+		if err != nil {
+			return Record{}, err
+		}
+		if m, ok := v.(map[string]any); ok {
+			fill(&rec, m)
+		}
+	}
+	c.add(key, rec)
+	return rec, nil
+}
+
+// Country return the iso code of the country of ip, empty if unknown
+func Country(ip string) string {
+	rec, err := Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	return rec.Country
+}
+
+// ParseIP parse '1.2.3.4', '1.2.3.4:80', '[::1]:80' or '1.2.3.4, 10.0.0.1'
+func ParseIP(ip string) net.IP {
+	ip, _, _ = strings.Cut(ip, ",")
+	ip = strings.TrimSpace(ip)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed
+	}
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+func fill(rec *Record, m map[string]any) {
+	country, ok := m["country"].(map[string]any)
+	if !ok {
+		country, _ = m["registered_country"].(map[string]any)
+	}
+	if rec.Country == "" && country != nil {
+		rec.Country = toString(country["iso_code"])
+		rec.CountryName = englishName(country)
+	}
+	if continent, ok := m["continent"].(map[string]any); ok && rec.Continent == "" {
+		rec.Continent = toString(continent["code"])
+		rec.ContinentName = englishName(continent)
+	}
+	if asn := toUint(m["autonomous_system_number"]); asn != 0 && rec.ASN == 0 {
+		rec.ASN = uint(asn)
+		rec.Organization = toString(m["autonomous_system_organization"])
+	}
+}
+
+func englishName(m map[string]any) string {
+	names, _ := m["names"].(map[string]any)
+	return toString(names["en"])
+}
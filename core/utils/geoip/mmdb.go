@@ -0,0 +1,335 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// ErrInvalidDatabase is returned when a file is not a valid MaxMind DB
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+// Metadata describe a MaxMind DB
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint64
+	Languages    []string
+}
+
+// Reader read a MaxMind DB (.mmdb) file loaded in memory
+type Reader struct {
+	Metadata  Metadata
+	buf       []byte
+	data      []byte
+	treeSize  uint
+	ipv4Start uint
+}
+
+// Open read the MaxMind DB file at path
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := FromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// FromBytes read a MaxMind DB from b
+func FromBytes(b []byte) (*Reader, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i == -1 {
+		return nil, ErrInvalidDatabase
+	}
+	d := decoder{buf: b[i+len(metadataMarker):]}
+	v, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	meta := Metadata{
+		DatabaseType: toString(m["database_type"]),
+		IPVersion:    uint(toUint(m["ip_version"])),
+		NodeCount:    uint(toUint(m["node_count"])),
+		RecordSize:   uint(toUint(m["record_size"])),
+		BuildEpoch:   toUint(m["build_epoch"]),
+	}
+	if langs, ok := m["languages"].([]any); ok {
+		for _, l := range langs {
+			meta.Languages = append(meta.Languages, toString(l))
+		}
+	}
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, meta.RecordSize)
+	}
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, ErrInvalidDatabase
+	}
+	r := &Reader{
+		Metadata: meta,
+		buf:      b,
+		data:     b[treeSize+16 : i],
+		treeSize: treeSize,
+	}
+	if meta.IPVersion == 6 {
+		// ipv4 addresses are stored in ::/96
+		node := uint(0)
+		for j := 0; j < 96 && node < meta.NodeCount; j++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup return the data of the network containing ip, nil if not found
+func (r *Reader) Lookup(ip net.IP) (any, error) {
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		node = r.ipv4Start
+	} else {
+		if r.Metadata.IPVersion == 4 {
+			return nil, fmt.Errorf("ipv6 address %s in an ipv4 database", ip)
+		}
+		bits = ip.To16()
+	}
+	count := r.Metadata.NodeCount
+	for i := 0; i < len(bits)*8 && node < count; i++ {
+		bit := uint(bits[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == count {
+		return nil, nil
+	}
+	if node < count {
+		return nil, ErrInvalidDatabase
+	}
+	offset := node - count - 16
+	if offset >= uint(len(r.data)) {
+		return nil, ErrInvalidDatabase
+	}
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset, 0)
+	return v, err
+}
+
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.buf
+	switch r.Metadata.RecordSize {
+	case 24:
+		o := node*6 + bit*3
+		return uint(b[o])<<16 | uint(b[o+1])<<8 | uint(b[o+2])
+	case 28:
+		o := node * 7
+		if bit == 0 {
+			return (uint(b[o+3])&0xf0)<<20 | uint(b[o])<<16 | uint(b[o+1])<<8 | uint(b[o+2])
+		}
+		return (uint(b[o+3])&0x0f)<<24 | uint(b[o+4])<<16 | uint(b[o+5])<<8 | uint(b[o+6])
+	default:
+		o := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[o : o+4]))
+	}
+}
+
+const maxDepth = 32
+
+type decoder struct {
+	buf []byte
+}
+
+// decode the value at offset, return it and the offset following it
+func (d *decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", ErrInvalidDatabase)
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == 1 {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(pointer, depth+1)
+		return v, next, err
+	}
+	end := offset + size
+	switch typ {
+	case 7, 11, 13, 14:
+	default:
+		if end > uint(len(d.buf)) {
+			return nil, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+		}
+	}
+	switch typ {
+	case 2:
+		return string(d.buf[offset:end]), end, nil
+	case 3:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(d.buf[offset:end])), end, nil
+	case 4:
+		return append([]byte{}, d.buf[offset:end]...), end, nil
+	case 5, 6, 9:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: uint of size %d", ErrInvalidDatabase, size)
+		}
+		var n uint64
+		for _, c := range d.buf[offset:end] {
+			n = n<<8 | uint64(c)
+		}
+		return n, end, nil
+	case 8:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: int32 of size %d", ErrInvalidDatabase, size)
+		}
+		var n uint32
+		for _, c := range d.buf[offset:end] {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), end, nil
+	case 10:
+		return new(big.Int).SetBytes(d.buf[offset:end]), end, nil
+	case 15:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of size %d", ErrInvalidDatabase, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(d.buf[offset:end]))), end, nil
+	case 14:
+		return size != 0, offset, nil
+	case 7:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidDatabase)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case 11:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrInvalidDatabase, typ)
+	}
+}
+
+// control read the control byte at offset, return the type, the size and the offset of the value
+func (d *decoder) control(offset uint) (byte, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := ctrl >> 5
+	if typ == 0 {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+		}
+		typ = 7 + d.buf[offset]
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if typ == 1 || size < 29 {
+		return typ, size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+	var extra uint
+	for _, c := range d.buf[offset : offset+n] {
+		extra = extra<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return typ, size, offset + n, nil
+}
+
+// pointer return the offset targeted by a pointer of control size bits, and the offset following it
+func (d *decoder) pointer(size, offset uint) (uint, uint, error) {
+	n := (size>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+	var p uint
+	if n != 4 {
+		p = size & 0x7
+	}
+	for _, c := range d.buf[offset : offset+n] {
+		p = p<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
+
+func toString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func toUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/kamux/geoblock"
+	"github.com/kamalshkeir/kago/core/utils/geoip"
+)
+
+// encode write v in the MaxMind DB data format
+func encode(buf *bytes.Buffer, v any) {
+	control := func(typ byte, size int) {
+		var ext []byte
+		switch {
+		case size < 29:
+		case size < 285:
+			ext = []byte{byte(size - 29)}
+			size = 29
+		default:
+			ext = []byte{byte((size - 285) >> 8), byte(size - 285)}
+			size = 30
+		}
+		if typ > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(typ - 7)
+		} else {
+			buf.WriteByte(typ<<5 | byte(size))
+		}
+		buf.Write(ext)
+	}
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		b = bytes.TrimLeft(b, "\x00")
+		control(6, len(b))
+		buf.Write(b)
+	case uint16:
+		control(5, 2)
+		buf.Write([]byte{byte(v >> 8), byte(v)})
+	case []any:
+		control(11, len(v))
+		for _, e := range v {
+			encode(buf, e)
+		}
+	case map[string]any:
+		control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	}
+}
+
+type node struct {
+	children [2]*node
+	data     int
+}
+
+// writeDB build an ipv6 database with 24 bits records, ipv4 networks are stored in ::/96
+func writeDB(t *testing.T, networks map[string]map[string]any) string {
+	root := &node{data: -1}
+	data := bytes.Buffer{}
+	// larger networks first, their data is pushed down when a smaller one is inserted inside
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Slice(cidrs, func(i, j int) bool {
+		_, a, _ := net.ParseCIDR(cidrs[i])
+		_, b, _ := net.ParseCIDR(cidrs[j])
+		onesA, _ := a.Mask.Size()
+		onesB, _ := b.Mask.Size()
+		return onesA < onesB
+	})
+	for _, cidr := range cidrs {
+		record := networks[cidr]
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := n.Mask.Size()
+		ip := n.IP.To16()
+		if n.IP.To4() != nil {
+			ip = append(make(net.IP, 12), n.IP.To4()...)
+			ones += 96
+		}
+		offset := data.Len()
+		encode(&data, record)
+		cur := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if cur.data != -1 {
+				cur.children = [2]*node{{data: cur.data}, {data: cur.data}}
+				cur.data = -1
+			}
+			if cur.children[bit] == nil {
+				cur.children[bit] = &node{data: -1}
+			}
+			cur = cur.children[bit]
+		}
+		cur.data = offset
+	}
+	// number nodes breadth first
+	nodes := []*node{root}
+	index := map[*node]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, c := range nodes[i].children {
+			if c != nil && c.data == -1 {
+				index[c] = len(nodes)
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	count := len(nodes)
+	out := bytes.Buffer{}
+	for _, n := range nodes {
+		for _, c := range n.children {
+			v := count
+			if c != nil && c.data == -1 {
+				v = index[c]
+			} else if c != nil {
+				v = count + 16 + c.data
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&out, map[string]any{
+		"database_type": "Test-Country",
+		"ip_version":    uint16(6),
+		"node_count":    uint32(count),
+		"record_size":   uint16(24),
+		"languages":     []any{"en"},
+	})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func country(iso, name, continent string) map[string]any {
+	return map[string]any{
+		"country":   map[string]any{"iso_code": iso, "names": map[string]any{"en": name, "fr": name + " (fr)"}},
+		"continent": map[string]any{"code": continent, "names": map[string]any{"en": "Europe"}},
+	}
+}
+
+func TestLookup(t *testing.T) {
+	countries := writeDB(t, map[string]map[string]any{
+		"81.0.0.0/8":       country("FR", "France", "EU"),
+		"81.2.69.0/24":     country("GB", "United Kingdom", "EU"),
+		"2a01:e00::/26":    country("FR", "France", "EU"),
+		"5.0.0.0/8":        {"registered_country": map[string]any{"iso_code": "DE"}},
+		"200.200.200.0/24": country("BR", "Brazil (a long name to use an extended size for the string value in this record)", "SA"),
+	})
+	asn := writeDB(t, map[string]map[string]any{
+		"81.0.0.0/8": {"autonomous_system_number": uint32(3215), "autonomous_system_organization": "Orange"},
+	})
+	if err := geoip.Load(countries, asn); err != nil {
+		t.Fatal(err)
+	}
+	defer geoip.Use()
+
+	cases := []struct {
+		ip   string
+		want geoip.Record
+	}{
+		{"81.1.2.3", geoip.Record{Country: "FR", CountryName: "France", Continent: "EU", ContinentName: "Europe", ASN: 3215, Organization: "Orange"}},
+		{"81.2.69.160:4321", geoip.Record{Country: "GB", CountryName: "United Kingdom", Continent: "EU", ContinentName: "Europe", ASN: 3215, Organization: "Orange"}},
+		{"[2a01:e00::1]:80", geoip.Record{Country: "FR", CountryName: "France", Continent: "EU", ContinentName: "Europe"}},
+		{"5.6.7.8, 10.0.0.1", geoip.Record{Country: "DE"}},
+		{"8.8.8.8", geoip.Record{}},
+	}
+	for _, c := range cases {
+		for i := 0; i < 2; i++ { // second time from the cache
+			got, err := geoip.Lookup(c.ip)
+			if err != nil {
+				t.Fatal(c.ip, err)
+			}
+			if got != c.want {
+				t.Errorf("%s: got %+v, want %+v", c.ip, got, c.want)
+			}
+		}
+	}
+	if got, _ := geoip.Lookup("200.200.200.1"); got.Country != "BR" || len(got.CountryName) < 29 {
+		t.Error(got)
+	}
+	if _, err := geoip.Lookup("not an ip"); err == nil {
+		t.Error("invalid ip should fail")
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.mmdb")
+	os.WriteFile(path, []byte("not a database"), 0644)
+	if err := geoip.Load(path); err == nil {
+		t.Error("invalid database should fail")
+	}
+	geoip.Use()
+	if _, err := geoip.Lookup("1.1.1.1"); err != geoip.ErrNotLoaded {
+		t.Error(err)
+	}
+}
+
+func TestGeoBlock(t *testing.T) {
+	defer func() {
+		geoblock.BLOCKED_COUNTRIES, geoblock.ALLOWED_COUNTRIES, geoblock.BLOCK_UNKNOWN = nil, nil, false
+	}()
+	geoblock.BLOCKED_COUNTRIES = []string{"ru"}
+	if geoblock.Allowed("RU") || !geoblock.Allowed("FR") || !geoblock.Allowed("") {
+		t.Error("blocked countries")
+	}
+	geoblock.ALLOWED_COUNTRIES = []string{"FR", "BE"}
+	geoblock.BLOCK_UNKNOWN = true
+	if !geoblock.Allowed("be") || geoblock.Allowed("US") || geoblock.Allowed("") {
+		t.Error("allowed countries")
+	}
+}
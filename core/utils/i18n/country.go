@@ -0,0 +1,31 @@
+package i18n
+
+import "strings"
+
+// CountryLanguages map the iso code of a country to its main language, used to choose a language from the location of the user
+var CountryLanguages = map[string]string{
+	"AD": "ca", "AE": "ar", "AF": "fa", "AL": "sq", "AM": "hy", "AO": "pt", "AR": "es", "AT": "de", "AU": "en", "AZ": "az",
+	"BA": "bs", "BD": "bn", "BE": "nl", "BF": "fr", "BG": "bg", "BH": "ar", "BI": "fr", "BJ": "fr", "BO": "es", "BR": "pt-br",
+	"BY": "be", "CA": "en", "CD": "fr", "CF": "fr", "CG": "fr", "CH": "de", "CI": "fr", "CL": "es", "CM": "fr", "CN": "zh",
+	"CO": "es", "CR": "es", "CU": "es", "CY": "el", "CZ": "cs", "DE": "de", "DJ": "fr", "DK": "da", "DO": "es", "DZ": "ar",
+	"EC": "es", "EE": "et", "EG": "ar", "ES": "es", "ET": "am", "FI": "fi", "FR": "fr", "GA": "fr", "GB": "en", "GE": "ka",
+	"GN": "fr", "GR": "el", "GT": "es", "HK": "zh", "HN": "es", "HR": "hr", "HT": "fr", "HU": "hu", "ID": "id", "IE": "en",
+	"IL": "he", "IN": "hi", "IQ": "ar", "IR": "fa", "IS": "is", "IT": "it", "JO": "ar", "JP": "ja", "KE": "sw", "KG": "ky",
+	"KH": "km", "KR": "ko", "KW": "ar", "KZ": "kk", "LA": "lo", "LB": "ar", "LI": "de", "LK": "si", "LT": "lt", "LU": "fr",
+	"LV": "lv", "LY": "ar", "MA": "ar", "MC": "fr", "MD": "ro", "ME": "sr", "MG": "fr", "MK": "mk", "ML": "fr", "MM": "my",
+	"MN": "mn", "MR": "ar", "MT": "mt", "MX": "es", "MY": "ms", "MZ": "pt", "NE": "fr", "NG": "en", "NI": "es", "NL": "nl",
+	"NO": "no", "NP": "ne", "NZ": "en", "OM": "ar", "PA": "es", "PE": "es", "PH": "en", "PK": "ur", "PL": "pl", "PR": "es",
+	"PS": "ar", "PT": "pt-pt", "PY": "es", "QA": "ar", "RO": "ro", "RS": "sr", "RU": "ru", "RW": "rw", "SA": "ar", "SD": "ar",
+	"SE": "sv", "SG": "en", "SI": "sl", "SK": "sk", "SN": "fr", "SO": "so", "SV": "es", "SY": "ar", "TD": "fr", "TG": "fr",
+	"TH": "th", "TJ": "tg", "TN": "ar", "TR": "tr", "TW": "zh", "TZ": "sw", "UA": "uk", "UG": "en", "US": "en", "UY": "es",
+	"UZ": "uz", "VE": "es", "VN": "vi", "YE": "ar", "ZA": "en",
+}
+
+// FromCountry return the available language spoken in country, false if none
+func FromCountry(country string) (string, bool) {
+	lang, ok := CountryLanguages[strings.ToUpper(country)]
+	if !ok {
+		return "", false
+	}
+	return Match(lang)
+}
@@ -0,0 +1,371 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/settings"
+)
+
+// Param is the query param and Cookie the cookie used to choose the language
+var (
+	Param  = "lang"
+	Cookie = "lang"
+)
+
+// Fallbacks are languages tried when a key is missing, before the base language ('pt' for 'pt-br') and the default language
+//
+//	i18n.Fallbacks["ca"] = []string{"es"}
+var Fallbacks = map[string][]string{}
+
+var (
+	mu        sync.RWMutex
+	languages []string
+)
+
+// Load read every json file of dir, the file name is the language: en.json, fr.json, pt-BR.json
+func Load(dir string) error {
+	loaded := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		v := map[string]any{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		lang := Normalize(strings.TrimSuffix(d.Name(), ".json"))
+		settings.Translations.Set(lang, v)
+		loaded = append(loaded, lang)
+		return nil
+	})
+	Add(loaded...)
+	return err
+}
+
+// Add make languages available, their translations are set in settings.Translations
+func Add(langs ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, l := range langs {
+		l = Normalize(l)
+		found := false
+		for _, existing := range languages {
+			if existing == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			languages = append(languages, l)
+		}
+	}
+	sort.Strings(languages)
+	settings.Languages = append([]string{}, languages...)
+}
+
+// Languages return available languages
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string{}, languages...)
+}
+
+// Default return the default language, settings.Config.DefaultLanguage or 'en'
+func Default() string {
+	if settings.Config.DefaultLanguage != "" {
+		return Normalize(settings.Config.DefaultLanguage)
+	}
+	return "en"
+}
+
+// Normalize lower case a language tag and use '-' as separator: pt_BR -> pt-br
+func Normalize(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+func base(lang string) string {
+	b, _, _ := strings.Cut(lang, "-")
+	return b
+}
+
+// Match return the available language matching lang: exact, then base language, then a region of the same base language
+func Match(lang string) (string, bool) {
+	lang = Normalize(lang)
+	if lang == "" || lang == "*" {
+		return "", false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(languages) == 0 {
+		return lang, true
+	}
+	for _, l := range languages {
+		if l == lang {
+			return l, true
+		}
+	}
+	b := base(lang)
+	for _, l := range languages {
+		if l == b {
+			return l, true
+		}
+	}
+	for _, l := range languages {
+		if base(l) == b {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// Resolve return the first available language from param, cookie, the Accept-Language header, then the default language
+func Resolve(param, cookie, acceptLanguage string) string {
+	if l, ok := negotiate(param, cookie, acceptLanguage); ok {
+		return l
+	}
+	return Default()
+}
+
+func negotiate(param, cookie, acceptLanguage string) (string, bool) {
+	for _, candidate := range []string{param, cookie} {
+		if l, ok := Match(candidate); ok {
+			return l, true
+		}
+	}
+	for _, candidate := range ParseAcceptLanguage(acceptLanguage) {
+		if l, ok := Match(candidate); ok {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// FromRequest resolve the language of r from the Param query param, the Cookie cookie and the Accept-Language header
+func FromRequest(r *http.Request) string {
+	if l, ok := Requested(r); ok {
+		return l
+	}
+	return Default()
+}
+
+// Requested return the available language asked by r using the Param query param, the Cookie cookie or the Accept-Language header,
+// false if none match
+func Requested(r *http.Request) (string, bool) {
+	cookie := ""
+	if c, err := r.Cookie(Cookie); err == nil {
+		cookie = c.Value
+	}
+	return negotiate(r.URL.Query().Get(Param), cookie, r.Header.Get("Accept-Language"))
+}
+
+// ParseAcceptLanguage return languages of an Accept-Language header sorted by quality, q=0 are excluded
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	list := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	langs := make([]string, len(list))
+	for i, w := range list {
+		langs[i] = w.lang
+	}
+	return langs
+}
+
+// chain return languages where a key is searched: lang, its fallbacks, its base language, then the default language
+func chain(lang string) []string {
+	lang = Normalize(lang)
+	langs := []string{lang}
+	langs = append(langs, Fallbacks[lang]...)
+	if b := base(lang); b != lang {
+		langs = append(langs, Fallbacks[b]...)
+		langs = append(langs, b)
+	}
+	langs = append(langs, Default())
+	seen := map[string]bool{}
+	unique := langs[:0]
+	for _, l := range langs {
+		l = Normalize(l)
+		if !seen[l] {
+			seen[l] = true
+			unique = append(unique, l)
+		}
+	}
+	return unique
+}
+
+// lookup find a nested key 'a.b.c' in the translations of lang, a key containing dots is found too
+func lookup(lang, key string) (any, bool) {
+	data, ok := settings.Translations.Get(lang)
+	if !ok {
+		return nil, false
+	}
+	if v, ok := data[key]; ok {
+		return v, true
+	}
+	var cur any = data
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// T translate key in lang, args are a map[string]any or name value pairs replacing {name} in the message,
+// if 'count' is given and the message is an object of plural forms (zero, one, two, few, many, other),
+// the form is chosen by the plural rules of lang, the key is returned if not found
+//
+//	T("fr", "cart.items", "count", 3) // {"cart": {"items": {"one": "{count} article", "other": "{count} articles"}}}
+func T(lang, key string, args ...any) string {
+	params := toParams(args)
+	for _, l := range chain(lang) {
+		v, ok := lookup(l, key)
+		if !ok {
+			continue
+		}
+		switch msg := v.(type) {
+		case string:
+			return interpolate(msg, params)
+		case map[string]any:
+			count, ok := params["count"]
+			if !ok {
+				continue
+			}
+			if form, ok := msg[PluralCategory(l, count)].(string); ok {
+				return interpolate(form, params)
+			}
+			if form, ok := msg["other"].(string); ok {
+				return interpolate(form, params)
+			}
+		default:
+			return interpolate(fmt.Sprint(msg), params)
+		}
+	}
+	return key
+}
+
+func toParams(args []any) map[string]any {
+	if len(args) == 1 {
+		switch m := args[0].(type) {
+		case map[string]any:
+			return m
+		case map[string]string:
+			params := make(map[string]any, len(m))
+			for k, v := range m {
+				params[k] = v
+			}
+			return params
+		}
+	}
+	params := make(map[string]any, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		params[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return params
+}
+
+func interpolate(msg string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// Missing return keys found in at least one language and missing in others, by language
+func Missing() map[string][]string {
+	all := map[string]bool{}
+	byLang := map[string]map[string]bool{}
+	for _, lang := range Languages() {
+		data, _ := settings.Translations.Get(lang)
+		keys := map[string]bool{}
+		flatten("", data, keys)
+		byLang[lang] = keys
+		for k := range keys {
+			all[k] = true
+		}
+	}
+	missing := map[string][]string{}
+	for lang, keys := range byLang {
+		for k := range all {
+			if !keys[k] {
+				missing[lang] = append(missing[lang], k)
+			}
+		}
+		sort.Strings(missing[lang])
+	}
+	return missing
+}
+
+// flatten collect leaf keys, plural forms are a single key
+func flatten(prefix string, data map[string]any, keys map[string]bool) {
+	for k, v := range data {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if m, ok := v.(map[string]any); ok && !isPlural(m) {
+			flatten(key, m, keys)
+			continue
+		}
+		keys[key] = true
+	}
+}
+
+func isPlural(m map[string]any) bool {
+	if _, ok := m["other"]; !ok {
+		return false
+	}
+	for k := range m {
+		switch k {
+		case "zero", "one", "two", "few", "many", "other":
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+)
+
+// PluralCategory return the CLDR plural category of count in lang: zero, one, two, few, many or other
+func PluralCategory(lang string, count any) string {
+	n, integer := number(count)
+	i := int64(math.Abs(n))
+	lang = Normalize(lang)
+	switch base(lang) {
+	case "ja", "zh", "ko", "vi", "th", "id", "ms", "lo", "my", "km":
+		return "other"
+	case "fr", "hy", "kab":
+		if integer && (i == 0 || i == 1) || !integer && n >= 0 && n < 2 {
+			return "one"
+		}
+		if integer && i != 0 && i%1000000 == 0 {
+			return "many"
+		}
+		return "other"
+	case "pt":
+		if lang == "pt-pt" {
+			if integer && i == 1 {
+				return "one"
+			}
+			return "other"
+		}
+		if integer && (i == 0 || i == 1) {
+			return "one"
+		}
+		return "other"
+	case "ru", "uk", "be":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i%10 == 1 && i%100 != 11:
+			return "one"
+		case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i == 1:
+			return "one"
+		case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "cs", "sk":
+		switch {
+		case !integer:
+			return "many"
+		case i == 1:
+			return "one"
+		case i >= 2 && i <= 4:
+			return "few"
+		default:
+			return "other"
+		}
+	case "ro":
+		switch {
+		case integer && i == 1:
+			return "one"
+		case !integer || i == 0 || (i%100 >= 2 && i%100 <= 19):
+			return "few"
+		default:
+			return "other"
+		}
+	case "ar":
+		if !integer {
+			return "other"
+		}
+		switch {
+		case i == 0:
+			return "zero"
+		case i == 1:
+			return "one"
+		case i == 2:
+			return "two"
+		case i%100 >= 3 && i%100 <= 10:
+			return "few"
+		case i%100 >= 11 && i%100 <= 99:
+			return "many"
+		default:
+			return "other"
+		}
+	case "he", "iw":
+		switch {
+		case integer && i == 1:
+			return "one"
+		case integer && i == 2:
+			return "two"
+		default:
+			return "other"
+		}
+	case "lt":
+		if !integer {
+			return "many"
+		}
+		switch {
+		case i%10 == 1 && (i%100 < 11 || i%100 > 19):
+			return "one"
+		case i%10 >= 2 && (i%100 < 11 || i%100 > 19):
+			return "few"
+		default:
+			return "other"
+		}
+	default:
+		// en, de, es, it, nl, sv, da, no, fi, el, hu, tr, bg, ca and most languages
+		if integer && i == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// number convert count to float64, integer is false for fractions or unsupported types
+func number(count any) (float64, bool) {
+	var n float64
+	switch v := count.(type) {
+	case int:
+		n = float64(v)
+	case int8:
+		n = float64(v)
+	case int16:
+		n = float64(v)
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case uint:
+		n = float64(v)
+	case uint8:
+		n = float64(v)
+	case uint16:
+		n = float64(v)
+	case uint32:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	case float32:
+		n = float64(v)
+	case float64:
+		n = v
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+		n = f
+	default:
+		return 0, false
+	}
+	return n, n == math.Trunc(n)
+}
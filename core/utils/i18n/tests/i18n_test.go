@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kamalshkeir/kago/core/utils/i18n"
+)
+
+func loadTranslations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"en.json":    `{"hello":"Hello {name}","cart":{"items":{"one":"{count} item","other":"{count} items"}},"only_en":"english"}`,
+		"fr.json":    `{"hello":"Bonjour {name}","cart":{"items":{"one":"{count} article","other":"{count} articles"}}}`,
+		"pt.json":    `{"hello":"Olá {name}","bye":"Tchau"}`,
+		"pt-BR.json": `{"hello":"Oi {name}"}`,
+		"ru.json":    `{"cart":{"items":{"one":"{count} товар","few":"{count} товара","many":"{count} товаров","other":"{count} товара"}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := i18n.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := i18n.ParseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0, *;q=0.5")
+	want := []string{"fr-CH", "fr", "en", "*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	loadTranslations(t)
+	cases := []struct {
+		param, cookie, header, want string
+	}{
+		{"fr", "pt", "ru", "fr"},
+		{"", "pt", "ru", "pt"},
+		{"xx", "", "de;q=0.9, ru;q=0.5", "ru"},
+		{"", "", "pt-PT", "pt"},
+		{"", "", "pt_br", "pt-br"},
+		{"", "", "de", "en"},
+	}
+	for _, c := range cases {
+		if got := i18n.Resolve(c.param, c.cookie, c.header); got != c.want {
+			t.Errorf("Resolve(%q, %q, %q) = %q, want %q", c.param, c.cookie, c.header, got, c.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	loadTranslations(t)
+	cases := []struct {
+		lang, key string
+		args      []any
+		want      string
+	}{
+		{"fr", "hello", []any{"name", "kago"}, "Bonjour kago"},
+		{"pt-br", "hello", []any{map[string]any{"name": "kago"}}, "Oi kago"},
+		{"pt-br", "bye", nil, "Tchau"},
+		{"fr", "only_en", nil, "english"},
+		{"fr", "unknown.key", nil, "unknown.key"},
+		{"en", "cart.items", []any{"count", 1}, "1 item"},
+		{"fr", "cart.items", []any{"count", 0}, "0 article"},
+		{"fr", "cart.items", []any{"count", 2}, "2 articles"},
+		{"ru", "cart.items", []any{"count", 21}, "21 товар"},
+		{"ru", "cart.items", []any{"count", 3}, "3 товара"},
+		{"ru", "cart.items", []any{"count", 11}, "11 товаров"},
+	}
+	for _, c := range cases {
+		if got := i18n.T(c.lang, c.key, c.args...); got != c.want {
+			t.Errorf("T(%q, %q, %v) = %q, want %q", c.lang, c.key, c.args, got, c.want)
+		}
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	loadTranslations(t)
+	i18n.Fallbacks["ca"] = []string{"fr"}
+	defer delete(i18n.Fallbacks, "ca")
+	if got := i18n.T("ca", "hello", "name", "kago"); got != "Bonjour kago" {
+		t.Error(got)
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	cases := []struct {
+		lang  string
+		count any
+		want  string
+	}{
+		{"en", 1, "one"}, {"en", 0, "other"}, {"en", 1.5, "other"},
+		{"fr", 0, "one"}, {"fr", 1.5, "one"}, {"fr", 2, "other"}, {"fr", 1000000, "many"},
+		{"ru", 1, "one"}, {"ru", 22, "few"}, {"ru", 12, "many"}, {"ru", 1.5, "other"},
+		{"pl", 1, "one"}, {"pl", 24, "few"}, {"pl", 21, "many"},
+		{"ar", 0, "zero"}, {"ar", 2, "two"}, {"ar", 105, "few"}, {"ar", 111, "many"}, {"ar", 100, "other"},
+		{"ja", 1, "other"},
+		{"cs", "3", "few"},
+	}
+	for _, c := range cases {
+		if got := i18n.PluralCategory(c.lang, c.count); got != c.want {
+			t.Errorf("PluralCategory(%q, %v) = %q, want %q", c.lang, c.count, got, c.want)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	loadTranslations(t)
+	missing := i18n.Missing()
+	if !reflect.DeepEqual(missing["fr"], []string{"bye", "only_en"}) {
+		t.Error("fr:", missing["fr"])
+	}
+	if !reflect.DeepEqual(missing["ru"], []string{"bye", "hello", "only_en"}) {
+		t.Error("ru:", missing["ru"])
+	}
+}
+
+func TestFromCountry(t *testing.T) {
+	loadTranslations(t)
+	cases := map[string]string{"br": "pt-br", "PT": "pt", "CA": "en", "RU": "ru"}
+	for country, want := range cases {
+		if got, ok := i18n.FromCountry(country); !ok || got != want {
+			t.Errorf("FromCountry(%q) = %q, want %q", country, got, want)
+		}
+	}
+	if _, ok := i18n.FromCountry("JP"); ok {
+		t.Error("ja is not available")
+	}
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/kamalshkeir/kago/core/settings"
+)
+
+// Message is a single html email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer is used by the framework to send every email, replace Default to use another provider or to capture emails in tests
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var Default Mailer = &Smtp{}
+
+// Send send an html body to one or more emails using Default mailer
+func Send(subject, body string, to ...string) error {
+	if Default == nil {
+		return errors.New("mailer: no Default mailer set")
+	}
+	if len(to) == 0 {
+		return errors.New("mailer: no recipient given")
+	}
+	return Default.Send(Message{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+}
+
+// Smtp send emails using settings.Config.Smtp
+type Smtp struct{}
+
+func (s *Smtp) Send(msg Message) error {
+	conf := settings.Config.Smtp
+	if conf.Host == "" || conf.Email == "" {
+		return errors.New("mailer: SMTP_HOST and SMTP_EMAIL are not set")
+	}
+	port := conf.Port
+	if port == "" {
+		port = "587"
+	}
+	var body bytes.Buffer
+	body.WriteString("From: " + conf.Email + "\r\n")
+	body.WriteString("To: " + strings.Join(msg.To, ",") + "\r\n")
+	body.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	body.WriteString("MIME-version: 1.0\r\nContent-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	auth := smtp.PlainAuth("", conf.Email, conf.Pass, conf.Host)
+	return smtp.SendMail(conf.Host+":"+port, auth, conf.Email, msg.To, body.Bytes())
+}
+
+// Outbox keep sent messages in memory instead of sending them, useful for tests and local development
+type Outbox struct {
+	mu       sync.Mutex
+	Messages []Message
+}
+
+func (o *Outbox) Send(msg Message) error {
+	o.mu.Lock()
+	o.Messages = append(o.Messages, msg)
+	o.mu.Unlock()
+	return nil
+}
+
+// Last return the last message sent to email
+func (o *Outbox) Last(email string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.Messages) - 1; i >= 0; i-- {
+		for _, to := range o.Messages[i].To {
+			if strings.EqualFold(to, email) {
+				return o.Messages[i], true
+			}
+		}
+	}
+	return Message{}, false
+}
+
+// Flush remove all captured messages
+func (o *Outbox) Flush() {
+	o.mu.Lock()
+	o.Messages = nil
+	o.mu.Unlock()
+}
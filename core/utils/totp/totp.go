@@ -0,0 +1,100 @@
+// Package totp implement time based one time passwords (RFC 6238) compatible with authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	PERIOD = 30 * time.Second
+	DIGITS = 6
+	// SKEW is the number of periods accepted before and after the current one, to tolerate clock drift
+	SKEW = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret return a new random base32 secret of 160 bits
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// URI return the otpauth:// uri to put in a QR code, issuer is the app name and account usually the user email
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(DIGITS))
+	v.Set("period", fmt.Sprint(int(PERIOD.Seconds())))
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Counter return the time step of t
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(PERIOD.Seconds())
+}
+
+// Code return the code of secret at time t
+func Code(secret string, t time.Time) (string, error) {
+	return CodeAt(secret, Counter(t))
+}
+
+// CodeAt return the code of secret for a time step counter (RFC 4226 HOTP)
+func CodeAt(secret string, counter int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.ReplaceAll(secret, " ", "")))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < DIGITS; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", DIGITS, value%mod), nil
+}
+
+// Validate check code against secret at time t allowing SKEW periods, it return the matched counter,
+// store it and reject codes with a counter lower or equal to prevent replay
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != DIGITS {
+		return 0, false
+	}
+	now := Counter(t)
+	for i := -SKEW; i <= SKEW; i++ {
+		expected, err := CodeAt(secret, now+int64(i))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return now + int64(i), true
+		}
+	}
+	return 0, false
+}
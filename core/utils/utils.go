@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/rand"
 	"encoding/base64"
@@ -17,7 +16,6 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -26,6 +24,7 @@ import (
 	"unicode"
 
 	"github.com/kamalshkeir/kago/core/settings"
+	"github.com/kamalshkeir/kago/core/utils/geoip"
 	"github.com/kamalshkeir/kago/core/utils/logger"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
@@ -257,14 +256,6 @@ func CopyDir(source, destination string) error {
 	return err
 }
 
-// Graceful Shutdown
-func GracefulShutdown(f func() error) error {
-	s := make(chan os.Signal, 1)
-	signal.Notify(s, os.Interrupt)
-	<-s
-	return f()
-}
-
 func SliceContains[T comparable](elems []T, vs ...T) bool {
 	for _, s := range elems {
 		for _, v := range vs {
@@ -520,26 +511,9 @@ func OpenBrowser(url string) {
 	_ = err
 }
 
+// GetIpCountry return the iso code of the country of ip using the geoip database set by GEOIP_FILE, empty if unknown
 func GetIpCountry(ip string) string {
-	cmd := exec.Command("nmap", "-n", "-sn", "-Pn", "--script", "ip-geolocation-geoplugin", ip)
-	d, err := cmd.Output()
-	if err != nil {
-		return ""
-	}
-	bReader := bytes.NewReader(d)
-	scanner := bufio.NewScanner(bReader)
-	var line string
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), "_location") {
-			line = scanner.Text()
-			sp := strings.Split(line, "location:")
-			line = strings.TrimSpace(sp[len(sp)-1])
-			spl := strings.Split(line, ",")
-			spl[1] = strings.TrimSpace(spl[1])
-			return spl[1]
-		}
-	}
-	return ""
+	return geoip.Country(ip)
 }
 
 func IsUpper(s string) bool {
@@ -2,12 +2,16 @@ package kago
 
 import (
 	"github.com/kamalshkeir/kago/core/admin"
+	"github.com/kamalshkeir/kago/core/auth"
+	"github.com/kamalshkeir/kago/core/auth/oauth"
 	"github.com/kamalshkeir/kago/core/kamux"
 )
 
 func New() *kamux.Router {
 	app := kamux.New()
 	admin.UrlPatterns(app)
+	auth.UrlPatterns(app)
+	oauth.UrlPatterns(app)
 	return app
 }
 